@@ -1,6 +1,38 @@
 package apiserver
 
+import "time"
+
 type ApiConfig interface {
   GetApiCredential() map[string]string
   GetApiPort() int
+  GetRiemannTransport() string
+  GetRiemannUDPServices() []string
+  GetMetricMaxPast() time.Duration
+  GetMetricMaxFuture() time.Duration
+  GetMetricStates() []string
+  GetMetricMaxTags() int
+  GetMetricMaxTagLength() int
+  GetMetricMaxAttributes() int
+  GetMetricMaxAttributeKeyLength() int
+  GetMetricMaxAttributeValueLength() int
+  GetAttributeNames() []string
+  GetAttributeAliases() map[string]string
+  GetAttributeLowercaseKeys() bool
+  GetCerberusRejectIncomplete() bool
+  GetPrometheusHostLabel() string
+  GetStatsdAddress() string
+  GetStatsdFlushInterval() time.Duration
+  GetStatsdHost() string
+  GetOtlpHostAttributes() []string
+  GetOtlpResourceAttributes() []string
+  GetOtlpLogs() bool
+  GetOtlpLogService() string
+  GetGraphiteAddress() string
+  GetGraphiteHost() string
+  GetGraphiteReadTimeout() time.Duration
+  GetGraphiteMaxConnections() int
+  GetInfluxEnabled() bool
+  GetInfluxHost() string
+  GetQueryAllow() map[string][]string
+  GetStreamKeepalive() time.Duration
 }
@@ -5,7 +5,6 @@ import (
   "log"
   "net/http"
 
-  riemann "github.com/riemann/riemann-go-client"
   "github.com/go-redis/redis/v8"
 
   "github.com/go-chi/chi/v5"
@@ -13,17 +12,30 @@ import (
   "github.com/go-chi/render"
 
   "riemannhttp/domain/metric"
+  "riemannhttp/domain/prometheus"
+  "riemannhttp/domain/passthrough"
+  "riemannhttp/domain/otlp"
+  "riemannhttp/domain/statsd"
+  "riemannhttp/domain/graphite"
+  "riemannhttp/domain/influx"
+  "riemannhttp/domain/query"
+  "riemannhttp/domain/stream"
   "riemannhttp/domain/asn"
   "riemannhttp/domain/cerberus"
+  "riemannhttp/domain/delivery"
+  "riemannhttp/domain/enrich"
 )
 
 type Server struct {
   app *chi.Mux
   cfg ApiConfig
   guardian *cerberus.Cerberus
+  statsd *statsd.Listener
+  graphite *graphite.Listener
+  hub *stream.Hub
 }
 
-func NewServer(rc *riemann.TCPClient, guardian *cerberus.Cerberus, redisClient *redis.Client, cfg ApiConfig) *Server {
+func NewServer(queue *delivery.Queue, backends *delivery.Backends, udp *delivery.UDPPublisher, pipeline *enrich.Pipeline, transformer *metric.Transformer, thresholds *metric.Thresholds, aggregator *metric.Aggregator, hub *stream.Hub, guardian *cerberus.Cerberus, redisClient *redis.Client, cfg ApiConfig) *Server {
   creds := cfg.GetApiCredential()
   app := chi.NewRouter()
   app.Use(middleware.Logger)
@@ -34,9 +46,88 @@ func NewServer(rc *riemann.TCPClient, guardian *cerberus.Cerberus, redisClient *
   asnHttp := asn.NewHTTP(asnSvc)
   app.Get("/asn", asnHttp.Get)
 
-  metricSvc := metric.NewService(rc, asnSvc, guardian)
-  metricHttp := metric.NewHTTP(metricSvc)
+  transports := metric.NewTransports(queue, cfg.GetRiemannTransport(), cfg.GetRiemannUDPServices())
+  if udp != nil {
+    transports.UDP = udp
+  }
+  limits := &metric.Limits{
+    MaxPast:                 cfg.GetMetricMaxPast(),
+    MaxFuture:               cfg.GetMetricMaxFuture(),
+    States:                  cfg.GetMetricStates(),
+    MaxTags:                 cfg.GetMetricMaxTags(),
+    MaxTagLength:            cfg.GetMetricMaxTagLength(),
+    MaxAttributes:           cfg.GetMetricMaxAttributes(),
+    MaxAttributeKeyLength:   cfg.GetMetricMaxAttributeKeyLength(),
+    MaxAttributeValueLength: cfg.GetMetricMaxAttributeValueLength(),
+  }
+  metricSvc := metric.NewService(metric.Options{
+    Transports:       transports,
+    Normalizer:       metric.NewNormalizer(cfg.GetAttributeAliases(), cfg.GetAttributeNames(), cfg.GetAttributeLowercaseKeys()),
+    Enricher:         pipeline,
+    Limits:           limits,
+    Guardian:         guardian,
+    Thresholds:       thresholds,
+    Transformer:      transformer,
+    Aggregator:       aggregator,
+    Stream:           hub,
+    RejectIncomplete: cfg.GetCerberusRejectIncomplete(),
+  })
+  metricHttp := metric.NewHTTP(metricSvc, limits)
   app.Post("/metric", metricHttp.Create)
+  app.Post("/metrics", metricHttp.CreateBatch)
+
+  passthroughHttp := passthrough.NewHTTP(metricSvc, limits)
+  app.Post("/riemann", passthroughHttp.Send)
+
+  prometheusHttp := prometheus.NewHTTP(metricSvc, limits, cfg.GetPrometheusHostLabel())
+  app.Post("/prometheus/write", prometheusHttp.Write)
+
+  otlpHttp := otlp.NewHTTP(metricSvc, limits, &otlp.Converter{
+    HostAttributes:     cfg.GetOtlpHostAttributes(),
+    ResourceAttributes: cfg.GetOtlpResourceAttributes(),
+    LogService:         cfg.GetOtlpLogService(),
+  })
+  app.Post("/v1/metrics", otlpHttp.Metrics)
+  if cfg.GetOtlpLogs() {
+    app.Post("/v1/logs", otlpHttp.Logs)
+  }
+
+  if cfg.GetInfluxEnabled() {
+    influxHttp := influx.NewHTTP(metricSvc, limits, cfg.GetInfluxHost())
+    app.Post("/influx/write", influxHttp.Write)
+  }
+
+  queryHttp := query.NewHTTP(query.NewService(backends, cfg.GetQueryAllow()))
+  app.Get("/query", queryHttp.Get)
+
+  streamHttp := stream.NewHTTP(hub, cfg.GetStreamKeepalive(), cfg.GetQueryAllow())
+  app.Get("/stream", streamHttp.Events)
+  app.Get("/stream/ws", streamHttp.WebSocket)
+
+  deliveryHttp := delivery.NewHTTP(queue, backends, udp)
+  app.Get("/delivery/stats", deliveryHttp.Stats)
+
+  cerberusHttp := cerberus.NewHTTP(guardian)
+  app.Get("/cerberus/stats", cerberusHttp.Stats)
+
+  var statsdListener *statsd.Listener
+  if address := cfg.GetStatsdAddress(); address != "" {
+    statsdListener = statsd.NewListener(metricSvc, limits, statsd.Options{
+      Address:       address,
+      FlushInterval: cfg.GetStatsdFlushInterval(),
+      Host:          cfg.GetStatsdHost(),
+    })
+  }
+
+  var graphiteListener *graphite.Listener
+  if address := cfg.GetGraphiteAddress(); address != "" {
+    graphiteListener = graphite.NewListener(metricSvc, limits, graphite.Options{
+      Address:        address,
+      Host:           cfg.GetGraphiteHost(),
+      ReadTimeout:    cfg.GetGraphiteReadTimeout(),
+      MaxConnections: cfg.GetGraphiteMaxConnections(),
+    })
+  }
 
   log.Print("Server ready")
 
@@ -44,11 +135,35 @@ func NewServer(rc *riemann.TCPClient, guardian *cerberus.Cerberus, redisClient *
     app: app,
     cfg: cfg,
     guardian: guardian,
+    statsd: statsdListener,
+    graphite: graphiteListener,
+    hub: hub,
   }
 }
 
 func (s Server) Run() error {
   httpPort := s.cfg.GetApiPort()
   s.guardian.Start()
+  if s.statsd != nil {
+    if err := s.statsd.Start(); err != nil {
+      return err
+    }
+  }
+  if s.graphite != nil {
+    if err := s.graphite.Start(); err != nil {
+      return err
+    }
+  }
   return http.ListenAndServe(fmt.Sprintf(":%d", httpPort), s.app)
 }
+
+// Close sends the metrics received by the listeners and ends the streams
+func (s Server) Close() {
+  s.hub.Close()
+  if s.statsd != nil {
+    s.statsd.Stop()
+  }
+  if s.graphite != nil {
+    s.graphite.Stop()
+  }
+}
@@ -1,81 +1,156 @@
 package main
 
 import (
+	"crypto/tls"
+	"errors"
+	"flag"
 	"log"
 	"os"
+	"os/signal"
 	"riemannhttp/apiserver"
+	"riemannhttp/domain/asn"
 	"riemannhttp/domain/cerberus"
+	"riemannhttp/domain/delivery"
+	"riemannhttp/domain/enrich"
+	"riemannhttp/domain/metric"
+	"riemannhttp/domain/stream"
 	config "riemannhttp/internal"
 
 	"context"
+	"syscall"
+
 	"github.com/go-redis/redis/v8"
-	riemann "github.com/riemann/riemann-go-client"
 )
 
-func createCerberus(rc *riemann.TCPClient, cfg *config.Config) *cerberus.Cerberus {
-	cubaAsn := "27725"
+func createActions(backends *delivery.Backends, hub *stream.Hub, cfg *config.Config) map[string]cerberus.Action {
 	jenkins := cerberus.Jenkins{
 		BaseUrl:  cfg.GetJenkinsBaseUrl(),
 		Username: cfg.GetJenkinsUsername(),
 		Token:    cfg.GetJenkinsToken(),
 		Password: cfg.GetJenkinsPassword(),
 	}
-	guardian := cerberus.NewCerberus(&cerberus.Options{
-		Rules: []cerberus.RuleOpts{
-			{
-				Name:   "ip",
-				Type:   cerberus.IpRule,
-				Window: cerberus.WindowOpts{Size: 600, Tick: 5}, // 10 minutes window (600 seconds) with tick every 5 seconds
-				Trigger: cerberus.LoginTriggerOpts{ // Min 15 requests, 90% of login requests, 90% of login errors
-					MinRequests:       15,
-					MinRateLogin:      0.9,
-					MinRateLoginError: 0.9,
-					Action: &cerberus.BlockIp{
-						Client:  rc,
-						Jenkins: &jenkins,
-					},
-				},
-			},
-			{
-				Name:   "asn-low",
-				Type:   cerberus.AsnRule,
-				Window: cerberus.WindowOpts{Size: 300, Tick: 5}, // 5 minutes window (300 seconds) with tick every 5 seconds
-				Trigger: cerberus.RateTriggerOpts{ // Min 30 requests, 80% of errors
-					MinRequests:  30,
-					MinRateError: 0.8,
-					Action: &cerberus.BlockAsn{
-						Client:  rc,
-						Jenkins: &jenkins,
-					},
-				},
-				Ignored: []string{cubaAsn},
-			},
-			{
-				Name:   "asn-high",
-				Type:   cerberus.AsnRule,
-				Window: cerberus.WindowOpts{Size: 30, Tick: 1}, // 30 seconds window with tick every 1 second
-				Trigger: cerberus.RateTriggerOpts{ // Min 30 requests, 80% of errors
-					MinRequests:  30,
-					MinRateError: 0.8,
-					Action: &cerberus.BlockAsn{
-						Client:  rc,
-						Jenkins: &jenkins,
-					},
-				},
-				Ignored: []string{cubaAsn},
-			},
+	// The alerts are streamed before they are sent
+	alerts := hub.Alerts(backends)
+	actions := map[string]cerberus.Action{
+		cerberus.BlockIpAction: &cerberus.BlockIp{
+			Client:  alerts,
+			Jenkins: &jenkins,
 		},
-	})
-	return guardian
+		cerberus.BlockAsnAction: &cerberus.BlockAsn{
+			Client:  alerts,
+			Jenkins: &jenkins,
+		},
+	}
+	return actions
+}
+
+func createCerberus(backends *delivery.Backends, hub *stream.Hub, cfg *config.Config) (*cerberus.Cerberus, error) {
+	actions := createActions(backends, hub, cfg)
+	options, err := cerberus.LoadOptions(cfg.GetCerberusRulesFile(), actions)
+	if err != nil {
+		return nil, err
+	}
+	guardian := cerberus.NewCerberus(options)
+
+	reloader := cerberus.NewReloader(cfg.GetCerberusRulesFile(), actions, guardian)
+	if interval := cfg.GetCerberusRulesWatchInterval(); interval > 0 {
+		go reloader.Watch(interval)
+	}
+
+	// Reload the rules on SIGHUP
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			log.Printf("SIGHUP received, reloading rules\n")
+			if err := reloader.Reload(); err != nil {
+				log.Printf("Error reloading rules: %s\n", err)
+			}
+		}
+	}()
+	return guardian, nil
+}
+
+func createBackends(cfg *config.Config) (*delivery.Backends, error) {
+	mode, err := delivery.ParseMode(cfg.GetRiemannMode())
+	if err != nil {
+		return nil, err
+	}
+	selection, err := delivery.ParseSelection(cfg.GetRiemannPoolSelection())
+	if err != nil {
+		return nil, err
+	}
+
+	var tlsConfig *tls.Config
+	if cfg.GetRiemannTLSEnabled() {
+		tlsConfig, err = delivery.LoadTLSConfig(
+			cfg.GetRiemannTLSCAFile(),
+			cfg.GetRiemannTLSCertFile(),
+			cfg.GetRiemannTLSKeyFile(),
+			cfg.GetRiemannTLSServerName(),
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	backends := []*delivery.Backend{}
+	for _, backendCfg := range cfg.GetRiemannBackends() {
+		dial := delivery.TCPDialer(backendCfg.Address, cfg.GetRiemannConnectTimeout())
+		if tlsConfig != nil {
+			dial = delivery.TLSDialer(backendCfg.Address, tlsConfig, cfg.GetRiemannConnectTimeout())
+		}
+		pool := delivery.NewPool(dial, delivery.PoolOptions{
+			Size:                cfg.GetRiemannPoolSize(),
+			Selection:           selection,
+			HealthCheckInterval: cfg.GetRiemannHealthCheckInterval(),
+		})
+		backend := &delivery.Backend{
+			Name:    backendCfg.Name,
+			Address: backendCfg.Address,
+			Pool:    pool,
+		}
+		// Riemann does not support UDP with TLS
+		if tlsConfig == nil {
+			backend.UDP = delivery.UDPDialer(backendCfg.Address, cfg.GetRiemannConnectTimeout())
+		}
+		backends = append(backends, backend)
+	}
+	return delivery.NewBackends(mode, backends), nil
+}
+
+func createQueue(sender delivery.Sender, spool *delivery.Spool, cfg *config.Config) (*delivery.Queue, error) {
+	fullPolicy, err := delivery.ParseFullPolicy(cfg.GetDeliveryFullPolicy())
+	if err != nil {
+		return nil, err
+	}
+	return delivery.NewQueue(sender, spool, delivery.Options{
+		QueueSize:     cfg.GetDeliveryQueueSize(),
+		BatchSize:     cfg.GetDeliveryBatchSize(),
+		FlushInterval: cfg.GetDeliveryFlushInterval(),
+		FullPolicy:    fullPolicy,
+		BackoffMin:    cfg.GetDeliveryBackoffMin(),
+		BackoffMax:    cfg.GetDeliveryBackoffMax(),
+	}), nil
 }
 
 func main() {
-	cfg := config.GetConfig()
-	rc := riemann.NewTCPClient(cfg.GetRiemannAddress(), cfg.GetRiemannConnectTimeout())
-	if err := rc.Connect(); err != nil {
-		log.Printf("Failed to connect to riemann server. %s\n", err)
+	cfg, err := config.GetConfig()
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+	if err != nil {
+		log.Printf("Failed to load config. %s\n", err)
+		os.Exit(1)
+	}
+
+	backends, err := createBackends(cfg)
+	if err != nil {
+		log.Printf("Failed to create riemann backends. %s\n", err)
 		os.Exit(1)
 	}
+	// The events are queued until riemann is reachable
+	backends.Connect()
 
 	redisClient := redis.NewClient(&redis.Options{
 		Addr:     cfg.GetRedisAddress(),
@@ -89,8 +164,86 @@ func main() {
 		os.Exit(1)
 	}
 
-	guardian := createCerberus(rc, cfg)
-	server := apiserver.NewServer(rc, guardian, redisClient, cfg)
+	var spool *delivery.Spool
+	if dir := cfg.GetDeliverySpoolDir(); dir != "" {
+		spool, err = delivery.OpenSpool(delivery.SpoolOptions{
+			Dir:            dir,
+			MaxSegmentSize: cfg.GetDeliverySpoolMaxSegmentSize(),
+			MaxSize:        cfg.GetDeliverySpoolMaxSize(),
+		})
+		if err != nil {
+			log.Printf("Failed to open delivery spool. %s\n", err)
+			os.Exit(1)
+		}
+	}
+	queue, err := createQueue(backends, spool, cfg)
+	if err != nil {
+		log.Printf("Failed to create delivery queue. %s\n", err)
+		os.Exit(1)
+	}
+	queue.Start()
+
+	aggregations, err := metric.LoadAggregations(cfg.GetAggregateFile())
+	if err != nil {
+		log.Printf("Failed to load aggregations. %s\n", err)
+		os.Exit(1)
+	}
+	aggregator := metric.NewAggregator(aggregations, queue)
+	aggregator.Start()
+
+	hub := stream.NewHub(stream.Options{
+		BufferSize:     cfg.GetStreamBufferSize(),
+		MaxSubscribers: cfg.GetStreamMaxSubscribers(),
+	})
+
+	guardian, err := createCerberus(backends, hub, cfg)
+	if err != nil {
+		log.Printf("Failed to load cerberus rules. %s\n", err)
+		os.Exit(1)
+	}
+
+	var udp *delivery.UDPPublisher
+	if !cfg.GetRiemannTLSEnabled() {
+		udp = delivery.NewUDPPublisher(backends, queue)
+	}
+
+	pipeline, err := enrich.Load(cfg.GetEnrichFile(), asn.NewService(redisClient))
+	if err != nil {
+		log.Printf("Failed to load enrichers. %s\n", err)
+		os.Exit(1)
+	}
+
+	transformer, err := metric.LoadTransformer(cfg.GetTransformFile(), cfg.GetMetricStates())
+	if err != nil {
+		log.Printf("Failed to load transforms. %s\n", err)
+		os.Exit(1)
+	}
+
+	thresholds, err := metric.LoadThresholds(cfg.GetThresholdFile())
+	if err != nil {
+		log.Printf("Failed to load thresholds. %s\n", err)
+		os.Exit(1)
+	}
+
+	server := apiserver.NewServer(queue, backends, udp, pipeline, transformer, thresholds, aggregator, hub, guardian, redisClient, cfg)
+
+	// Keep the queued events in the spool on shutdown
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-stop
+		log.Printf("Shutting down\n")
+		// The current intervals are queued before the queue is closed
+		server.Close()
+		aggregator.Stop()
+		queue.Close()
+		backends.Close()
+		if spool != nil {
+			spool.Close()
+		}
+		os.Exit(0)
+	}()
+
 	if err := server.Run(); err != nil {
 		log.Fatalf("Error starting http server <%s>", err)
 		os.Exit(1)
@@ -8,32 +8,46 @@ import (
 )
 
 func fetchASNFromDNS(ip string) (string, error) {
+  info, err := fetchInfoFromDNS(ip)
+  if err != nil {
+    return "", err
+  }
+  return info.ASN, nil
+}
+
+func fetchInfoFromDNS(ip string) (*Info, error) {
   // Invert the IP address
   reversedIP, err := reverseIP(ip)
   if err != nil {
-    return "", err
+    return nil, err
   }
 
   // Perform a DNS query to get the ASN
   log.Printf("Lookup to: %s", reversedIP)
   answers, err := net.LookupTXT(reversedIP)
   if err != nil {
-    return "", err
+    return nil, err
   }
 
   if len(answers) == 0 {
-    return "Unknown", nil
+    return &Info{ASN: "Unknown"}, nil
   }
 
-  asn, _, _, _, err := parseASNData(answers[0])
+  asn, network, country, registry, createDate, err := parseASNData(answers[0])
   if err != nil {
-    return "", err
+    return nil, err
   }
 
-  return asn, nil
+  return &Info{
+    ASN: asn,
+    Network: network,
+    Country: country,
+    Registry: registry,
+    Created: createDate,
+  }, nil
 }
 
-func parseASNData(data string) (asn, network, country, createDate string, err error) {
+func parseASNData(data string) (asn, network, country, registry, createDate string, err error) {
   // ASN, network, country, name, createDate
   // 8151 | 2806:108e:13::/48 | MX | lacnic | 2011-03-01
   // 397630 | 154.83.10.0/24 | SC | afrinic | 2013-07-24
@@ -41,17 +55,18 @@ func parseASNData(data string) (asn, network, country, createDate string, err er
   log.Printf("Received: %s", data)
   matches := strings.Split(data, "|")
   if len(matches) < 5 {
-    return "", "", "", "", fmt.Errorf("formato no válido")
+    return "", "", "", "", "", fmt.Errorf("formato no válido")
   }
 
   // Asignar los valores extraídos
   asn = strings.TrimSpace(matches[0])
   network = strings.TrimSpace(matches[1])
   country = strings.TrimSpace(matches[2])
+  registry = strings.TrimSpace(matches[3])
   createDate = strings.TrimSpace(matches[4])
 
   log.Printf("ASN: %s, Red: %s, País: %s, Fecha de Creación: %s", asn, network, country, createDate)
-  return asn, network, country, createDate, nil
+  return asn, network, country, registry, createDate, nil
 }
 
 func reverseIP(ip string) (string, error) {
@@ -5,6 +5,15 @@ import (
   "github.com/go-chi/render"
 )
 
+// Info is the data of the ASN announcing an IP
+type Info struct {
+  ASN string      `json:"asn"`
+  Network string  `json:"network"`
+  Country string  `json:"country"`
+  Registry string `json:"registry"`
+  Created string  `json:"created"`
+}
+
 type ASNResponse struct {
   ASN string `json:"asn"`
   IP string  `json:"ip"`
@@ -3,6 +3,7 @@ package asn
 import (
   "log"
   "context"
+  "encoding/json"
   "time"
   "github.com/go-redis/redis/v8"
 )
@@ -11,6 +12,7 @@ var ctx = context.Background()
 
 type Service interface {
   GetASNForIP(string) (string, error)
+  GetInfoForIP(string) (*Info, error)
 }
 
 func NewService(redisClient *redis.Client) Service {
@@ -46,3 +48,27 @@ func (s *svc) GetASNForIP(ip string) (string, error) {
 
     return asn, nil
 }
+
+func (s *svc) GetInfoForIP(ip string) (*Info, error) {
+  key := "asn-info:" + ip
+  if data, err := s.redisClient.Get(ctx, key).Bytes(); err == nil {
+    info := &Info{}
+    if err := json.Unmarshal(data, info); err == nil {
+      return info, nil
+    }
+  }
+
+  info, err := fetchInfoFromDNS(ip)
+  if err != nil {
+    return nil, err
+  }
+
+  data, err := json.Marshal(info)
+  if err != nil {
+    return nil, err
+  }
+  if err := s.redisClient.Set(ctx, key, data, 7*24*time.Hour).Err(); err != nil {
+    return nil, err
+  }
+  return info, nil
+}
@@ -6,11 +6,16 @@ import (
 	"time"
 )
 
-func sendMetric(rc *riemann.TCPClient, name, ip string) error {
+// EventSender delivers events to riemann
+type EventSender interface {
+	Send(events []riemann.Event) error
+}
+
+func sendMetric(sender EventSender, name, ip string) error {
 	atts := make(map[string]string)
 	atts["ip-asn"] = ip
 	atts["name"] = name
-	e := &riemann.Event{
+	e := riemann.Event{
 		Service:     "cerberus.alert",
 		Description: "",
 		Metric:      1,
@@ -19,23 +24,11 @@ func sendMetric(rc *riemann.TCPClient, name, ip string) error {
 		TTL:         time.Duration(1) * time.Minute,
 		Attributes:  atts,
 	}
-	if _, err := riemann.SendEvent(rc, e); err == nil {
-		return nil
-	}
-
-	// If fail to send event retry the connection
-	if err := rc.Connect(); err != nil {
-		return err
-	}
-
-	if _, err := riemann.SendEvent(rc, e); err != nil {
-		return err
-	}
-	return nil
+	return sender.Send([]riemann.Event{e})
 }
 
 type BlockIp struct {
-	Client  *riemann.TCPClient
+	Client  EventSender
 	Jenkins *Jenkins
 }
 
@@ -47,7 +40,7 @@ func (b *BlockIp) Send(name, ip string) error {
 }
 
 type BlockAsn struct {
-	Client  *riemann.TCPClient
+	Client  EventSender
 	Jenkins *Jenkins
 }
 
@@ -1,6 +1,10 @@
 package cerberus
 
-import "log"
+import (
+	"log"
+	"sync"
+	"sync/atomic"
+)
 
 type RuleType int
 
@@ -28,16 +32,33 @@ type RuleOpts struct {
 
 type Options struct {
 	Rules []RuleOpts
+	// Classifier of the metrics, DefaultClassifier if nil
+	Classifier *Classifier
 }
 
 type Rule struct {
-	Type    RuleType
-	Window  *Window
-	Ignored []string
+	Name        string
+	Type        RuleType
+	Window      *Window
+	TriggerOpts TriggerOpts
+	Ignored     []string
 }
 
 type Cerberus struct {
-	rules []*Rule
+	mu         sync.RWMutex
+	rules      []*Rule
+	classifier *Classifier
+	started    bool
+	analyzed   int64
+	incomplete int64
+}
+
+type Stats struct {
+	// Analyzed is the number of requests counted by the rules
+	Analyzed int64 `json:"analyzed"`
+	// Incomplete is the number of metrics of the source services that could
+	// not be classified, usually because of missing attributes
+	Incomplete int64 `json:"incomplete"`
 }
 
 func contains(slice []string, val string) bool {
@@ -49,32 +70,158 @@ func contains(slice []string, val string) bool {
 	return false
 }
 
+func (c *Cerberus) getClassifier() *Classifier {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.classifier
+}
+
+// Check reports whether the metric can be classified. The metrics of other
+// services are always valid. The failures are counted as incomplete.
+func (c *Cerberus) Check(service string, attributes map[string]string) error {
+	classifier := c.getClassifier()
+	if !classifier.IsSource(service) {
+		return nil
+	}
+	if _, err := classifier.Classify(attributes); err != nil {
+		atomic.AddInt64(&c.incomplete, 1)
+		return err
+	}
+	return nil
+}
+
+// AnalyzeMetric classifies the metric and analyzes the request. The metrics
+// of other services are ignored.
+func (c *Cerberus) AnalyzeMetric(service string, attributes map[string]string) error {
+	classifier := c.getClassifier()
+	if !classifier.IsSource(service) {
+		return nil
+	}
+	r, err := classifier.Classify(attributes)
+	if err != nil {
+		return err
+	}
+	atomic.AddInt64(&c.analyzed, 1)
+	c.Analyze(*r)
+	return nil
+}
+
+func (c *Cerberus) Stats() Stats {
+	return Stats{
+		Analyzed:   atomic.LoadInt64(&c.analyzed),
+		Incomplete: atomic.LoadInt64(&c.incomplete),
+	}
+}
+
 // Analyze is the function that will analyze the metrics and apply the rules
-func (c Cerberus) Analyze(ip string, asn string, isLogin bool, isUnauthorized bool) {
+func (c *Cerberus) Analyze(r Request) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
 	for _, rule := range c.rules {
 		if rule.Type == IpRule {
-			if contains(rule.Ignored, ip) {
+			if contains(rule.Ignored, r.IP) {
 				// If the IP is ignored, we skip the rule
 				continue
 			}
 			// Increment IP metrics
-			rule.Window.Inc(ip, isLogin, isUnauthorized)
+			rule.Window.Inc(r.IP, r)
 		} else {
-			if contains(rule.Ignored, asn) {
+			if contains(rule.Ignored, r.ASN) {
 				// If the ASN is ignored, we skip the rule
 				continue
 			}
 			// Increment ASN metrics
-			rule.Window.Inc(asn, isLogin, isUnauthorized)
+			rule.Window.Inc(r.ASN, r)
 		}
 	}
 }
 
-func (c Cerberus) Start() {
+// Start launches the windows of every rule. The windows stopped by Stop are
+// replaced by empty ones, their counters are lost.
+func (c *Cerberus) Start() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.started {
+		return
+	}
 	// Start the metrics
 	for _, rule := range c.rules {
+		if rule.Window.stopped() {
+			rule.Window = rule.Window.renew()
+		}
 		rule.Window.Start()
 	}
+	c.started = true
+}
+
+// Stop terminates the windows of every rule.
+func (c *Cerberus) Stop() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, rule := range c.rules {
+		rule.Window.Stop()
+	}
+	c.started = false
+}
+
+// Reload replaces the rule set. Rules with the same name, type and window
+// geometry keep their window counters (and their trigger if it did not
+// change), removed rules are stopped and new rules are started.
+func (c *Cerberus) Reload(options *Options) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	current := make(map[string]*Rule, len(c.rules))
+	for _, rule := range c.rules {
+		current[rule.Name] = rule
+	}
+
+	rules := make([]*Rule, len(options.Rules))
+	for i, ruleOption := range options.Rules {
+		old, found := current[ruleOption.Name]
+		if !found || old.Type != ruleOption.Type || !old.Window.HasGeometry(ruleOption.Window) {
+			log.Printf("Added rule %s\n", ruleOption.Name)
+			rules[i] = newRule(ruleOption)
+			if c.started {
+				rules[i].Window.Start()
+			}
+			continue
+		}
+
+		delete(current, ruleOption.Name)
+		if old.TriggerOpts != ruleOption.Trigger {
+			log.Printf("Updated trigger of rule %s\n", ruleOption.Name)
+			old.Window.SetConsumer(ruleOption.Trigger.NewTrigger())
+		}
+		rules[i] = &Rule{
+			Name:        ruleOption.Name,
+			Type:        ruleOption.Type,
+			Window:      old.Window,
+			TriggerOpts: ruleOption.Trigger,
+			Ignored:     ruleOption.Ignored,
+		}
+	}
+
+	for name, rule := range current {
+		log.Printf("Removed rule %s\n", name)
+		rule.Window.Stop()
+	}
+
+	c.rules = rules
+	c.classifier = classifierOf(options)
+	log.Printf("%d Rules loaded\n", len(rules))
+}
+
+func newRule(ruleOption RuleOpts) *Rule {
+	trigger := ruleOption.Trigger.NewTrigger()
+	window := NewWindow(ruleOption.Name, ruleOption.Window.Tick, ruleOption.Window.Size, trigger)
+	return &Rule{
+		Name:        ruleOption.Name,
+		Type:        ruleOption.Type,
+		Window:      window,
+		TriggerOpts: ruleOption.Trigger,
+		Ignored:     ruleOption.Ignored,
+	}
 }
 
 func NewCerberus(options *Options) *Cerberus {
@@ -82,15 +229,18 @@ func NewCerberus(options *Options) *Cerberus {
 	rules := make([]*Rule, len(options.Rules))
 	for i, ruleOption := range options.Rules {
 		log.Printf("Added rule %s\n", ruleOption.Name)
-		trigger := ruleOption.Trigger.NewTrigger()
-		window := NewWindow(ruleOption.Name, ruleOption.Window.Tick, ruleOption.Window.Size, trigger)
-		rule := &Rule{
-			Type:    ruleOption.Type,
-			Window:  window,
-			Ignored: ruleOption.Ignored,
-		}
-		rules[i] = rule
+		rules[i] = newRule(ruleOption)
+	}
+
+	return &Cerberus{
+		rules:      rules,
+		classifier: classifierOf(options),
 	}
+}
 
-	return &Cerberus{rules: rules}
+func classifierOf(options *Options) *Classifier {
+	if options.Classifier == nil {
+		return DefaultClassifier()
+	}
+	return options.Classifier
 }
@@ -0,0 +1,146 @@
+package cerberus
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+type testAction struct {
+	mu   sync.Mutex
+	sent []string
+}
+
+func (a *testAction) Send(name string, ip string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.sent = append(a.sent, name+" "+ip)
+	return nil
+}
+
+func (a *testAction) count() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return len(a.sent)
+}
+
+func testRule(name string, size uint16, minRateError float32, action Action) RuleOpts {
+	return RuleOpts{
+		Name:   name,
+		Type:   IpRule,
+		Window: WindowOpts{Size: size, Tick: 10},
+		Trigger: RateTriggerOpts{
+			MinRequests:  1,
+			MinRateError: minRateError,
+			Action:       action,
+		},
+	}
+}
+
+// waitCounters waits until the window counted the requests of key
+func waitCounters(t *testing.T, w *Window, key string, total uint32) Counters {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for {
+		w.mu.Lock()
+		ipMap, ok := w.ipMap[key]
+		var counters Counters
+		if ok {
+			counters = ipMap.Counters
+		}
+		w.mu.Unlock()
+		if counters.TotalOk+counters.TotalError == total {
+			return counters
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("window %s counted %+v for %s, want %d requests", w.name, counters, key, total)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestReloadRules(t *testing.T) {
+	action := &testAction{}
+	c := NewCerberus(&Options{Rules: []RuleOpts{
+		testRule("kept", 60, 0.5, action),
+		testRule("resized", 60, 0.5, action),
+		testRule("removed", 60, 0.5, action),
+	}})
+	c.Start()
+	defer c.Stop()
+	c.Analyze(Request{IP: "10.0.0.1", Unauthorized: true})
+	windows := make(map[string]*Window)
+	for _, rule := range c.rules {
+		waitCounters(t, rule.Window, "10.0.0.1", 1)
+		windows[rule.Name] = rule.Window
+	}
+
+	c.Reload(&Options{Rules: []RuleOpts{
+		testRule("kept", 60, 0.9, action),
+		testRule("resized", 120, 0.5, action),
+		testRule("added", 60, 0.5, action),
+	}})
+
+	if len(c.rules) != 3 {
+		t.Fatalf("%d rules after reload, want 3", len(c.rules))
+	}
+	kept, resized, added := c.rules[0].Window, c.rules[1].Window, c.rules[2].Window
+	if kept != windows["kept"] {
+		t.Error("the window with the same geometry was replaced")
+	}
+	if counters := waitCounters(t, kept, "10.0.0.1", 1); counters.TotalError != 1 {
+		t.Errorf("kept window counters %+v, want 1 error", counters)
+	}
+	if resized == windows["resized"] || !windows["resized"].stopped() {
+		t.Error("the window with another geometry was not replaced and stopped")
+	}
+	if !windows["removed"].stopped() {
+		t.Error("the window of the removed rule was not stopped")
+	}
+
+	// The new windows are started
+	c.Analyze(Request{IP: "10.0.0.1"})
+	waitCounters(t, kept, "10.0.0.1", 2)
+	waitCounters(t, resized, "10.0.0.1", 1)
+	waitCounters(t, added, "10.0.0.1", 1)
+}
+
+func TestReloadKeepsTriggerCache(t *testing.T) {
+	action := &testAction{}
+	c := NewCerberus(&Options{Rules: []RuleOpts{testRule("rule", 60, 0.5, action)}})
+	counters := Counters{TotalError: 2, LastError: 100}
+
+	c.rules[0].Window.consumer.Handle("rule", "10.0.0.1", counters)
+	if action.count() != 1 {
+		t.Fatalf("action sent %d times, want 1", action.count())
+	}
+
+	c.Reload(&Options{Rules: []RuleOpts{testRule("rule", 60, 0.9, action)}})
+	c.rules[0].Window.consumer.Handle("rule", "10.0.0.1", counters)
+	if action.count() != 1 {
+		t.Fatalf("action sent %d times after the reload, want 1", action.count())
+	}
+
+	// A new error triggers the rule again
+	counters.LastError = 101
+	c.rules[0].Window.consumer.Handle("rule", "10.0.0.1", counters)
+	if action.count() != 2 {
+		t.Fatalf("action sent %d times after a new error, want 2", action.count())
+	}
+}
+
+func TestStartAfterStop(t *testing.T) {
+	c := NewCerberus(&Options{Rules: []RuleOpts{testRule("rule", 60, 0.5, &testAction{})}})
+	c.Start()
+	stopped := c.rules[0].Window
+	c.Stop()
+	c.Start()
+	defer c.Stop()
+
+	w := c.rules[0].Window
+	if w == stopped {
+		t.Fatal("the stopped window was not replaced")
+	}
+	c.Analyze(Request{IP: "10.0.0.1"})
+	waitCounters(t, w, "10.0.0.1", 1)
+}
@@ -0,0 +1,188 @@
+package cerberus
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Request is a classified request of an ip
+type Request struct {
+	IP           string
+	ASN          string
+	Login        bool
+	Unauthorized bool
+	RateLimited  bool
+	ServerError  bool
+}
+
+// LoginMatcher matches the login urls by one of exact, prefix or regex. If
+// Method is set the method of the request must be the same.
+type LoginMatcher struct {
+	Exact  string
+	Prefix string
+	Regex  *regexp.Regexp
+	Method string
+}
+
+func (lm *LoginMatcher) Matches(url, method string) bool {
+	if lm.Method != "" && !strings.EqualFold(lm.Method, method) {
+		return false
+	}
+	switch {
+	case lm.Exact != "":
+		return url == lm.Exact
+	case lm.Prefix != "":
+		return strings.HasPrefix(url, lm.Prefix)
+	case lm.Regex != nil:
+		return lm.Regex.MatchString(url)
+	}
+	return false
+}
+
+type statusRange struct {
+	min, max int
+}
+
+// StatusSet is a set of http status codes
+type StatusSet []statusRange
+
+// ParseStatusSet parses codes (401), classes (5xx) and ranges (500-504)
+func ParseStatusSet(items []string) (StatusSet, error) {
+	set := StatusSet{}
+	for _, item := range items {
+		item = strings.TrimSpace(item)
+		switch {
+		case len(item) == 3 && strings.HasSuffix(strings.ToLower(item), "xx"):
+			class, err := strconv.Atoi(item[:1])
+			if err != nil || class < 1 || class > 5 {
+				return nil, fmt.Errorf("invalid status class %q", item)
+			}
+			set = append(set, statusRange{class * 100, class*100 + 99})
+		case strings.Contains(item, "-"):
+			parts := strings.SplitN(item, "-", 2)
+			min, errMin := strconv.Atoi(parts[0])
+			max, errMax := strconv.Atoi(parts[1])
+			if errMin != nil || errMax != nil || min > max {
+				return nil, fmt.Errorf("invalid status range %q", item)
+			}
+			set = append(set, statusRange{min, max})
+		default:
+			code, err := strconv.Atoi(item)
+			if err != nil {
+				return nil, fmt.Errorf("invalid status %q", item)
+			}
+			set = append(set, statusRange{code, code})
+		}
+	}
+	return set, nil
+}
+
+func (set StatusSet) Contains(status int) bool {
+	for _, r := range set {
+		if status >= r.min && status <= r.max {
+			return true
+		}
+	}
+	return false
+}
+
+// Attributes are the names of the metric attributes read by the Classifier
+type Attributes struct {
+	IP         string
+	ASN        string
+	URL        string
+	StatusCode string
+	Method     string
+}
+
+// Classifier turns the metrics of the source services into requests
+type Classifier struct {
+	Services     []string
+	Attributes   Attributes
+	Logins       []LoginMatcher
+	Unauthorized StatusSet
+	RateLimited  StatusSet
+	ServerError  StatusSet
+}
+
+// DefaultClassifier classifies the response times of the core api
+func DefaultClassifier() *Classifier {
+	return &Classifier{
+		Services: []string{"core_api.response_time"},
+		Attributes: Attributes{
+			IP:         "ip",
+			ASN:        "asn",
+			URL:        "url",
+			StatusCode: "status_code",
+			Method:     "method",
+		},
+		Logins: []LoginMatcher{
+			{Exact: "/api/v2/access/login"},
+			{Exact: "/api/access/login"},
+		},
+		Unauthorized: StatusSet{{401, 401}, {403, 403}},
+		RateLimited:  StatusSet{{429, 429}},
+		ServerError:  StatusSet{{500, 599}},
+	}
+}
+
+func (c *Classifier) IsSource(service string) bool {
+	return contains(c.Services, service)
+}
+
+// MissingAttributesError lists the attributes required by the Classifier
+// that a metric does not have
+type MissingAttributesError struct {
+	Missing []string
+}
+
+func (e *MissingAttributesError) Error() string {
+	return fmt.Sprintf("Missing attributes: %s", strings.Join(e.Missing, ", "))
+}
+
+// Classify builds the request of a metric of a source service
+func (c *Classifier) Classify(attributes map[string]string) (*Request, error) {
+	var missing []string
+	get := func(name string) string {
+		value, found := attributes[name]
+		if !found {
+			missing = append(missing, name)
+		}
+		return value
+	}
+	ip := get(c.Attributes.IP)
+	asn := get(c.Attributes.ASN)
+	url := get(c.Attributes.URL)
+	statusCode := get(c.Attributes.StatusCode)
+	if len(missing) > 0 {
+		return nil, &MissingAttributesError{Missing: missing}
+	}
+
+	if i := strings.IndexByte(url, '?'); i >= 0 {
+		url = url[:i]
+	}
+	status, err := strconv.Atoi(statusCode)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid status code %q", statusCode)
+	}
+
+	method := attributes[c.Attributes.Method]
+	isLogin := false
+	for i := range c.Logins {
+		if c.Logins[i].Matches(url, method) {
+			isLogin = true
+			break
+		}
+	}
+
+	return &Request{
+		IP:           ip,
+		ASN:          asn,
+		Login:        isLogin,
+		Unauthorized: c.Unauthorized.Contains(status),
+		RateLimited:  c.RateLimited.Contains(status),
+		ServerError:  c.ServerError.Contains(status),
+	}, nil
+}
@@ -0,0 +1,160 @@
+package cerberus
+
+import (
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+func TestParseStatusSet(t *testing.T) {
+	tests := []struct {
+		items []string
+		in    []int
+		out   []int
+		err   bool
+	}{
+		{[]string{"401", "403"}, []int{401, 403}, []int{400, 402, 404}, false},
+		{[]string{"4xx"}, []int{400, 451, 499}, []int{399, 500}, false},
+		{[]string{" 5XX "}, []int{500, 599}, []int{499, 600}, false},
+		{[]string{"500-599"}, []int{500, 550, 599}, []int{499, 600}, false},
+		{[]string{"429", "502-504"}, []int{429, 502, 504}, []int{501, 505}, false},
+		{[]string{"6xx"}, nil, nil, true},
+		{[]string{"axx"}, nil, nil, true},
+		{[]string{"599-500"}, nil, nil, true},
+		{[]string{"500-"}, nil, nil, true},
+		{[]string{"5x"}, nil, nil, true},
+		{[]string{"ok"}, nil, nil, true},
+	}
+	for _, tt := range tests {
+		set, err := ParseStatusSet(tt.items)
+		if (err != nil) != tt.err {
+			t.Errorf("ParseStatusSet(%q) error = %v", tt.items, err)
+			continue
+		}
+		for _, status := range tt.in {
+			if !set.Contains(status) {
+				t.Errorf("ParseStatusSet(%q) does not contain %d", tt.items, status)
+			}
+		}
+		for _, status := range tt.out {
+			if set.Contains(status) {
+				t.Errorf("ParseStatusSet(%q) contains %d", tt.items, status)
+			}
+		}
+	}
+}
+
+func TestLoginMatcher(t *testing.T) {
+	tests := []struct {
+		name    string
+		matcher LoginMatcher
+		url     string
+		method  string
+		want    bool
+	}{
+		{"exact", LoginMatcher{Exact: "/login"}, "/login", "GET", true},
+		{"exact other url", LoginMatcher{Exact: "/login"}, "/login/2fa", "GET", false},
+		{"prefix", LoginMatcher{Prefix: "/auth/"}, "/auth/token", "GET", true},
+		{"prefix other url", LoginMatcher{Prefix: "/auth/"}, "/api/auth/token", "GET", false},
+		{"regex", LoginMatcher{Regex: regexp.MustCompile(`^/v[0-9]+/login$`)}, "/v2/login", "GET", true},
+		{"regex other url", LoginMatcher{Regex: regexp.MustCompile(`^/v[0-9]+/login$`)}, "/v2/logout", "GET", false},
+		{"method", LoginMatcher{Exact: "/login", Method: "POST"}, "/login", "post", true},
+		{"other method", LoginMatcher{Exact: "/login", Method: "POST"}, "/login", "GET", false},
+		{"missing method", LoginMatcher{Exact: "/login", Method: "POST"}, "/login", "", false},
+		{"empty", LoginMatcher{}, "/login", "GET", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.matcher.Matches(tt.url, tt.method); got != tt.want {
+				t.Fatalf("Matches(%q, %q) = %v, want %v", tt.url, tt.method, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClassify(t *testing.T) {
+	c := DefaultClassifier()
+	c.Logins = append(c.Logins, LoginMatcher{Prefix: "/auth/", Method: "POST"})
+	attributes := func(url, status, method string) map[string]string {
+		return map[string]string{"ip": "10.0.0.1", "asn": "64500", "url": url, "status_code": status, "method": method}
+	}
+	tests := []struct {
+		name       string
+		attributes map[string]string
+		want       *Request
+		err        bool
+	}{
+		{"ok", attributes("/api/items", "200", "GET"), &Request{IP: "10.0.0.1", ASN: "64500"}, false},
+		{"login", attributes("/api/access/login", "200", "GET"), &Request{IP: "10.0.0.1", ASN: "64500", Login: true}, false},
+		{"login with query string", attributes("/api/access/login?next=/home", "401", "POST"), &Request{IP: "10.0.0.1", ASN: "64500", Login: true, Unauthorized: true}, false},
+		{"login with method", attributes("/auth/token", "403", "POST"), &Request{IP: "10.0.0.1", ASN: "64500", Login: true, Unauthorized: true}, false},
+		{"login with other method", attributes("/auth/token", "200", "GET"), &Request{IP: "10.0.0.1", ASN: "64500"}, false},
+		{"rate limited", attributes("/api/items", "429", "GET"), &Request{IP: "10.0.0.1", ASN: "64500", RateLimited: true}, false},
+		{"server error", attributes("/api/items", "503", "GET"), &Request{IP: "10.0.0.1", ASN: "64500", ServerError: true}, false},
+		{"invalid status", attributes("/api/items", "ok", "GET"), nil, true},
+		{"missing attributes", map[string]string{"ip": "10.0.0.1", "url": "/"}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := c.Classify(tt.attributes)
+			if (err != nil) != tt.err {
+				t.Fatalf("Classify() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("Classify() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	_, err := c.Classify(map[string]string{"ip": "10.0.0.1", "url": "/"})
+	missing, ok := err.(*MissingAttributesError)
+	if !ok || !reflect.DeepEqual(missing.Missing, []string{"asn", "status_code"}) {
+		t.Fatalf("Classify() error = %v, want the missing asn and status_code", err)
+	}
+}
+
+func TestRateTriggerCounter(t *testing.T) {
+	counters := Counters{
+		TotalOk:         6,
+		TotalError:      4,
+		RateLimited:     5,
+		ServerError:     1,
+		LastError:       1,
+		LastRateLimited: 2,
+		LastServerError: 3,
+	}
+	tests := []struct {
+		counter      Counter
+		minRateError float32
+		sent         bool
+	}{
+		{"", 0.4, true},
+		{"", 0.5, false},
+		{UnauthorizedCounter, 0.4, true},
+		{RateLimitedCounter, 0.5, true},
+		{RateLimitedCounter, 0.6, false},
+		{ServerErrorCounter, 0.1, true},
+		{ServerErrorCounter, 0.2, false},
+	}
+	for _, tt := range tests {
+		action := &testAction{}
+		trigger := RateTriggerOpts{MinRequests: 10, MinRateError: tt.minRateError, Counter: tt.counter, Action: action}.NewTrigger()
+		trigger.Handle("rule", "10.0.0.1", counters)
+		if sent := action.count() == 1; sent != tt.sent {
+			t.Errorf("counter %q with a min rate of %.1f sent = %v, want %v", tt.counter, tt.minRateError, sent, tt.sent)
+		}
+
+		// The same error is sent once
+		trigger.Handle("rule", "10.0.0.1", counters)
+		if action.count() > 1 {
+			t.Errorf("counter %q sent the same error twice", tt.counter)
+		}
+	}
+
+	// Too few requests
+	action := &testAction{}
+	RateTriggerOpts{MinRequests: 11, Counter: ServerErrorCounter, Action: action}.NewTrigger().Handle("rule", "10.0.0.1", counters)
+	if action.count() != 0 {
+		t.Fatal("sent below the min requests")
+	}
+}
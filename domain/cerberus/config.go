@@ -0,0 +1,304 @@
+package cerberus
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	BlockIpAction  = "block-ip"
+	BlockAsnAction = "block-asn"
+)
+
+type WindowConfig struct {
+	Size uint16 `yaml:"size"`
+	Tick uint16 `yaml:"tick"`
+}
+
+type TriggerConfig struct {
+	Kind              string  `yaml:"kind"`
+	MinRequests       uint16  `yaml:"min_requests"`
+	MinRateLogin      float32 `yaml:"min_rate_login"`
+	MinRateLoginError float32 `yaml:"min_rate_login_error"`
+	MinRateError      float32 `yaml:"min_rate_error"`
+	// Counter of the errors of a rate trigger: unauthorized (default),
+	// rate-limited or server-error
+	Counter string `yaml:"counter"`
+}
+
+type RuleConfig struct {
+	Name    string        `yaml:"name"`
+	Type    string        `yaml:"type"`
+	Window  WindowConfig  `yaml:"window"`
+	Trigger TriggerConfig `yaml:"trigger"`
+	Action  string        `yaml:"action"`
+	Ignored []string      `yaml:"ignored"`
+}
+
+type AttributesConfig struct {
+	IP         string `yaml:"ip"`
+	ASN        string `yaml:"asn"`
+	URL        string `yaml:"url"`
+	StatusCode string `yaml:"status_code"`
+	Method     string `yaml:"method"`
+}
+
+type LoginConfig struct {
+	Exact  string `yaml:"exact"`
+	Prefix string `yaml:"prefix"`
+	Regex  string `yaml:"regex"`
+	Method string `yaml:"method"`
+}
+
+// ClassificationConfig overrides the DefaultClassifier, the empty fields keep
+// their default.
+type ClassificationConfig struct {
+	Services     []string         `yaml:"services"`
+	Attributes   AttributesConfig `yaml:"attributes"`
+	Logins       []LoginConfig    `yaml:"logins"`
+	Unauthorized []string         `yaml:"unauthorized"`
+	RateLimited  []string         `yaml:"rate_limited"`
+	ServerError  []string         `yaml:"server_error"`
+}
+
+// RulesConfig is the content of a rules file. JSON files are accepted too
+// since JSON is a subset of YAML.
+type RulesConfig struct {
+	Classification ClassificationConfig `yaml:"classification"`
+	Rules          []RuleConfig         `yaml:"rules"`
+}
+
+// LoadOptions reads the rules file in path and maps it onto Options. The
+// action of every rule is looked up by name in actions.
+func LoadOptions(path string, actions map[string]Action) (*Options, error) {
+	rc, err := ReadRules(path)
+	if err != nil {
+		return nil, err
+	}
+	return rc.Options(actions)
+}
+
+// ReadRules parses the rules file in path. Unknown fields are rejected.
+func ReadRules(path string) (*RulesConfig, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot open rules file: %s", err)
+	}
+	defer f.Close()
+
+	rc := &RulesConfig{}
+	decoder := yaml.NewDecoder(f)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(rc); err != nil {
+		return nil, fmt.Errorf("Invalid rules file %s: %s", path, err)
+	}
+	return rc, nil
+}
+
+// Options validates every rule and builds the Cerberus options. All the
+// validation errors are reported at once.
+func (rc *RulesConfig) Options(actions map[string]Action) (*Options, error) {
+	var errs []string
+	if len(rc.Rules) == 0 {
+		errs = append(errs, "no rules defined")
+	}
+
+	names := make(map[string]bool)
+	rules := make([]RuleOpts, 0, len(rc.Rules))
+	for i, r := range rc.Rules {
+		opts, ruleErrs := r.options(actions)
+		name := r.Name
+		if name == "" {
+			name = fmt.Sprintf("#%d", i)
+		} else if names[name] {
+			ruleErrs = append(ruleErrs, "duplicated name")
+		}
+		names[name] = true
+
+		for _, e := range ruleErrs {
+			errs = append(errs, fmt.Sprintf("rule %s: %s", name, e))
+		}
+		rules = append(rules, opts)
+	}
+
+	classifier, classificationErrs := rc.Classification.classifier()
+	for _, e := range classificationErrs {
+		errs = append(errs, fmt.Sprintf("classification: %s", e))
+	}
+
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("Invalid rules: %s", strings.Join(errs, "; "))
+	}
+	return &Options{Rules: rules, Classifier: classifier}, nil
+}
+
+func (cc ClassificationConfig) classifier() (*Classifier, []string) {
+	var errs []string
+	c := DefaultClassifier()
+	if len(cc.Services) > 0 {
+		c.Services = cc.Services
+	}
+
+	setName := func(name *string, value string) {
+		if value != "" {
+			*name = value
+		}
+	}
+	setName(&c.Attributes.IP, cc.Attributes.IP)
+	setName(&c.Attributes.ASN, cc.Attributes.ASN)
+	setName(&c.Attributes.URL, cc.Attributes.URL)
+	setName(&c.Attributes.StatusCode, cc.Attributes.StatusCode)
+	setName(&c.Attributes.Method, cc.Attributes.Method)
+
+	if len(cc.Logins) > 0 {
+		c.Logins = make([]LoginMatcher, 0, len(cc.Logins))
+		for i, l := range cc.Logins {
+			matcher, err := l.matcher()
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("login #%d: %s", i, err))
+				continue
+			}
+			c.Logins = append(c.Logins, matcher)
+		}
+	}
+
+	setStatus := func(field string, set *StatusSet, items []string) {
+		if len(items) == 0 {
+			return
+		}
+		parsed, err := ParseStatusSet(items)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %s", field, err))
+			return
+		}
+		*set = parsed
+	}
+	setStatus("unauthorized", &c.Unauthorized, cc.Unauthorized)
+	setStatus("rate_limited", &c.RateLimited, cc.RateLimited)
+	setStatus("server_error", &c.ServerError, cc.ServerError)
+	return c, errs
+}
+
+func (l LoginConfig) matcher() (LoginMatcher, error) {
+	matcher := LoginMatcher{Exact: l.Exact, Prefix: l.Prefix, Method: l.Method}
+	set := 0
+	for _, v := range []string{l.Exact, l.Prefix, l.Regex} {
+		if v != "" {
+			set++
+		}
+	}
+	if set != 1 {
+		return matcher, fmt.Errorf("exactly one of exact, prefix or regex is required")
+	}
+	if l.Regex != "" {
+		regex, err := regexp.Compile(l.Regex)
+		if err != nil {
+			return matcher, fmt.Errorf("invalid regex: %s", err)
+		}
+		matcher.Regex = regex
+	}
+	return matcher, nil
+}
+
+func (r RuleConfig) options(actions map[string]Action) (RuleOpts, []string) {
+	var errs []string
+	if r.Name == "" {
+		errs = append(errs, "name is required")
+	}
+
+	ruleType, err := parseRuleType(r.Type)
+	if err != nil {
+		errs = append(errs, err.Error())
+	}
+
+	if r.Window.Tick == 0 {
+		errs = append(errs, "window tick must be greater than 0")
+	} else if r.Window.Size < r.Window.Tick {
+		errs = append(errs, "window size must be greater or equal than the tick")
+	} else if r.Window.Size%r.Window.Tick != 0 {
+		errs = append(errs, "window size must be a multiple of the tick")
+	}
+
+	action, hasAction := actions[r.Action]
+	if r.Action == "" {
+		errs = append(errs, "action is required")
+	} else if !hasAction {
+		errs = append(errs, fmt.Sprintf("unknown action %q", r.Action))
+	}
+
+	trigger, triggerErrs := r.Trigger.options(action)
+	errs = append(errs, triggerErrs...)
+
+	return RuleOpts{
+		Name:    r.Name,
+		Type:    ruleType,
+		Window:  WindowOpts{Size: r.Window.Size, Tick: r.Window.Tick},
+		Trigger: trigger,
+		Ignored: r.Ignored,
+	}, errs
+}
+
+func (t TriggerConfig) options(action Action) (TriggerOpts, []string) {
+	var errs []string
+	checkRate := func(field string, value float32) {
+		if value < 0 || value > 1 {
+			errs = append(errs, fmt.Sprintf("trigger %s must be between 0 and 1", field))
+		}
+	}
+
+	switch t.Kind {
+	case "login":
+		if t.MinRateError != 0 {
+			errs = append(errs, "trigger min_rate_error is not supported by login triggers")
+		}
+		if t.Counter != "" {
+			errs = append(errs, "trigger counter is not supported by login triggers")
+		}
+		checkRate("min_rate_login", t.MinRateLogin)
+		checkRate("min_rate_login_error", t.MinRateLoginError)
+		return LoginTriggerOpts{
+			MinRequests:       t.MinRequests,
+			MinRateLogin:      t.MinRateLogin,
+			MinRateLoginError: t.MinRateLoginError,
+			Action:            action,
+		}, errs
+	case "rate":
+		if t.MinRateLogin != 0 || t.MinRateLoginError != 0 {
+			errs = append(errs, "trigger min_rate_login and min_rate_login_error are not supported by rate triggers")
+		}
+		checkRate("min_rate_error", t.MinRateError)
+		counter := Counter(t.Counter)
+		switch counter {
+		case "", UnauthorizedCounter, RateLimitedCounter, ServerErrorCounter:
+		default:
+			errs = append(errs, fmt.Sprintf("unknown trigger counter %q", t.Counter))
+		}
+		return RateTriggerOpts{
+			MinRequests:  t.MinRequests,
+			MinRateError: t.MinRateError,
+			Counter:      counter,
+			Action:       action,
+		}, errs
+	case "":
+		return nil, append(errs, "trigger kind is required")
+	default:
+		return nil, append(errs, fmt.Sprintf("unknown trigger kind %q", t.Kind))
+	}
+}
+
+func parseRuleType(s string) (RuleType, error) {
+	switch s {
+	case "ip":
+		return IpRule, nil
+	case "asn":
+		return AsnRule, nil
+	case "":
+		return 0, fmt.Errorf("type is required")
+	default:
+		return 0, fmt.Errorf("unknown type %q", s)
+	}
+}
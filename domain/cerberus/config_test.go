@@ -0,0 +1,130 @@
+package cerberus
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func validRuleConfig() RuleConfig {
+	return RuleConfig{
+		Name:    "ip",
+		Type:    "ip",
+		Window:  WindowConfig{Size: 60, Tick: 10},
+		Trigger: TriggerConfig{Kind: "rate", MinRequests: 10, MinRateError: 0.5},
+		Action:  BlockIpAction,
+	}
+}
+
+func TestRulesConfigOptions(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(rc *RulesConfig)
+		err    string
+	}{
+		{"valid", func(rc *RulesConfig) {}, ""},
+		{"no rules", func(rc *RulesConfig) { rc.Rules = nil }, "no rules defined"},
+		{"no name", func(rc *RulesConfig) { rc.Rules[0].Name = "" }, "rule #0: name is required"},
+		{"duplicated name", func(rc *RulesConfig) {
+			rc.Rules = append(rc.Rules, validRuleConfig())
+		}, "rule ip: duplicated name"},
+		{"no type", func(rc *RulesConfig) { rc.Rules[0].Type = "" }, "type is required"},
+		{"unknown type", func(rc *RulesConfig) { rc.Rules[0].Type = "host" }, `unknown type "host"`},
+		{"asn type", func(rc *RulesConfig) { rc.Rules[0].Type = "asn" }, ""},
+		{"no tick", func(rc *RulesConfig) { rc.Rules[0].Window.Tick = 0 }, "window tick must be greater than 0"},
+		{"size below tick", func(rc *RulesConfig) { rc.Rules[0].Window.Size = 5 }, "window size must be greater or equal than the tick"},
+		{"size not a multiple", func(rc *RulesConfig) { rc.Rules[0].Window.Size = 65 }, "window size must be a multiple of the tick"},
+		{"size equal to tick", func(rc *RulesConfig) { rc.Rules[0].Window.Size = 10 }, ""},
+		{"no action", func(rc *RulesConfig) { rc.Rules[0].Action = "" }, "action is required"},
+		{"unknown action", func(rc *RulesConfig) { rc.Rules[0].Action = "block-host" }, `unknown action "block-host"`},
+		{"no trigger kind", func(rc *RulesConfig) { rc.Rules[0].Trigger.Kind = "" }, "trigger kind is required"},
+		{"unknown trigger kind", func(rc *RulesConfig) { rc.Rules[0].Trigger.Kind = "burst" }, `unknown trigger kind "burst"`},
+		{"rate counter", func(rc *RulesConfig) { rc.Rules[0].Trigger.Counter = "server-error" }, ""},
+		{"unknown counter", func(rc *RulesConfig) { rc.Rules[0].Trigger.Counter = "timeout" }, `unknown trigger counter "timeout"`},
+		{"rate above 1", func(rc *RulesConfig) { rc.Rules[0].Trigger.MinRateError = 1.5 }, "trigger min_rate_error must be between 0 and 1"},
+		{"negative rate", func(rc *RulesConfig) { rc.Rules[0].Trigger.MinRateError = -0.1 }, "trigger min_rate_error must be between 0 and 1"},
+		{"login rates on rate trigger", func(rc *RulesConfig) { rc.Rules[0].Trigger.MinRateLogin = 0.5 }, "not supported by rate triggers"},
+		{"login trigger", func(rc *RulesConfig) {
+			rc.Rules[0].Trigger = TriggerConfig{Kind: "login", MinRequests: 10, MinRateLogin: 0.5, MinRateLoginError: 0.8}
+		}, ""},
+		{"login rate above 1", func(rc *RulesConfig) {
+			rc.Rules[0].Trigger = TriggerConfig{Kind: "login", MinRateLogin: 2}
+		}, "trigger min_rate_login must be between 0 and 1"},
+		{"error rate on login trigger", func(rc *RulesConfig) {
+			rc.Rules[0].Trigger = TriggerConfig{Kind: "login", MinRateError: 0.5}
+		}, "trigger min_rate_error is not supported by login triggers"},
+		{"counter on login trigger", func(rc *RulesConfig) {
+			rc.Rules[0].Trigger = TriggerConfig{Kind: "login", Counter: "unauthorized"}
+		}, "trigger counter is not supported by login triggers"},
+		{"login matchers", func(rc *RulesConfig) {
+			rc.Classification.Logins = []LoginConfig{{Exact: "/login", Method: "POST"}, {Prefix: "/auth/"}, {Regex: "^/v[0-9]+/login$"}}
+		}, ""},
+		{"login without matcher", func(rc *RulesConfig) {
+			rc.Classification.Logins = []LoginConfig{{Method: "POST"}}
+		}, "classification: login #0: exactly one of exact, prefix or regex is required"},
+		{"login with two matchers", func(rc *RulesConfig) {
+			rc.Classification.Logins = []LoginConfig{{Exact: "/login"}, {Exact: "/login", Prefix: "/auth/"}}
+		}, "classification: login #1: exactly one of exact, prefix or regex is required"},
+		{"invalid login regex", func(rc *RulesConfig) {
+			rc.Classification.Logins = []LoginConfig{{Regex: "(login"}}
+		}, "classification: login #0: invalid regex"},
+		{"invalid status", func(rc *RulesConfig) {
+			rc.Classification.ServerError = []string{"5xy"}
+		}, "classification: server_error:"},
+		{"every error", func(rc *RulesConfig) {
+			rc.Rules[0].Window.Tick = 0
+			rc.Rules[0].Action = ""
+		}, "Invalid rules: rule ip: window tick must be greater than 0; rule ip: action is required"},
+	}
+	actions := map[string]Action{BlockIpAction: &testAction{}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rc := &RulesConfig{Rules: []RuleConfig{validRuleConfig()}}
+			tt.change(rc)
+			options, err := rc.Options(actions)
+			if tt.err == "" {
+				if err != nil {
+					t.Fatalf("Options: %s", err)
+				}
+				if len(options.Rules) != len(rc.Rules) || options.Classifier == nil {
+					t.Fatalf("Options() = %+v", options)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("Options() error = %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestReadRulesUnknownField(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.yaml")
+	writeRules(t, path, strings.Replace(testRules, "min_requests", "min_request", 1))
+	_, err := ReadRules(path)
+	if err == nil || !strings.Contains(err.Error(), "min_request") {
+		t.Fatalf("ReadRules() error = %v, want the unknown field rejected", err)
+	}
+}
+
+func TestLoadOptions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.yaml")
+	writeRules(t, path, testRules)
+	action := &testAction{}
+	options, err := LoadOptions(path, map[string]Action{BlockIpAction: action})
+	if err != nil {
+		t.Fatalf("LoadOptions: %s", err)
+	}
+	rule := options.Rules[0]
+	trigger, ok := rule.Trigger.(RateTriggerOpts)
+	if rule.Name != "ip" || rule.Type != IpRule || rule.Window != (WindowOpts{Size: 60, Tick: 10}) || !ok {
+		t.Fatalf("rule = %+v", rule)
+	}
+	if trigger.MinRequests != 10 || trigger.MinRateError != 0.5 || trigger.Action != action {
+		t.Fatalf("trigger = %+v", trigger)
+	}
+
+	if _, err := LoadOptions(filepath.Join(t.TempDir(), "missing.yaml"), nil); err == nil {
+		t.Fatal("LoadOptions() accepted a missing file")
+	}
+}
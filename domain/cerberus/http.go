@@ -0,0 +1,35 @@
+package cerberus
+
+import (
+	"net/http"
+
+	"github.com/go-chi/render"
+)
+
+type StatsResponse struct {
+	*Stats
+}
+
+func (sr *StatsResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	render.Status(r, http.StatusOK)
+	return nil
+}
+
+type HttpTransport interface {
+	Stats(w http.ResponseWriter, r *http.Request)
+}
+
+type httpTransport struct {
+	guardian *Cerberus
+}
+
+func NewHTTP(guardian *Cerberus) HttpTransport {
+	return &httpTransport{
+		guardian: guardian,
+	}
+}
+
+func (h httpTransport) Stats(w http.ResponseWriter, r *http.Request) {
+	stats := h.guardian.Stats()
+	render.Render(w, r, &StatsResponse{Stats: &stats})
+}
@@ -0,0 +1,75 @@
+package cerberus
+
+import (
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// Reloader rebuilds the rules of a Cerberus from its rules file.
+type Reloader struct {
+	path     string
+	actions  map[string]Action
+	guardian *Cerberus
+	mu       sync.Mutex
+	modTime  time.Time
+	size     int64
+}
+
+func NewReloader(path string, actions map[string]Action, guardian *Cerberus) *Reloader {
+	r := &Reloader{
+		path:     path,
+		actions:  actions,
+		guardian: guardian,
+	}
+	if info, err := os.Stat(path); err == nil {
+		r.modTime = info.ModTime()
+		r.size = info.Size()
+	}
+	return r
+}
+
+// Reload reads the rules file and applies it. If the file is not valid the
+// current rules are kept.
+func (r *Reloader) Reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if info, err := os.Stat(r.path); err == nil {
+		r.modTime = info.ModTime()
+		r.size = info.Size()
+	}
+
+	options, err := LoadOptions(r.path, r.actions)
+	if err != nil {
+		return err
+	}
+	r.guardian.Reload(options)
+	return nil
+}
+
+func (r *Reloader) changed() bool {
+	info, err := os.Stat(r.path)
+	if err != nil {
+		return false
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return !info.ModTime().Equal(r.modTime) || info.Size() != r.size
+}
+
+// Watch polls the rules file every interval and reloads it when it changes.
+func (r *Reloader) Watch(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if !r.changed() {
+			continue
+		}
+		log.Printf("Rules file %s changed, reloading\n", r.path)
+		if err := r.Reload(); err != nil {
+			log.Printf("Error reloading rules: %s\n", err)
+		}
+	}
+}
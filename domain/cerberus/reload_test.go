@@ -0,0 +1,90 @@
+package cerberus
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const testRules = `
+rules:
+  - name: ip
+    type: ip
+    window: {size: 60, tick: 10}
+    trigger: {kind: rate, min_requests: 10, min_rate_error: 0.5}
+    action: block-ip
+`
+
+func writeRules(t *testing.T, path string, content string) {
+	t.Helper()
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("WriteFile: %s", err)
+	}
+}
+
+func TestReloaderChanged(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.yaml")
+	writeRules(t, path, testRules)
+	actions := map[string]Action{BlockIpAction: &testAction{}}
+	options, err := LoadOptions(path, actions)
+	if err != nil {
+		t.Fatalf("LoadOptions: %s", err)
+	}
+	c := NewCerberus(options)
+	r := NewReloader(path, actions, c)
+
+	if r.changed() {
+		t.Fatal("changed without writing the file")
+	}
+
+	// Same size, newer modification time
+	writeRules(t, path, testRules)
+	future := time.Now().Add(time.Hour)
+	if err := os.Chtimes(path, future, future); err != nil {
+		t.Fatalf("Chtimes: %s", err)
+	}
+	if !r.changed() {
+		t.Fatal("modification time change not detected")
+	}
+	if err := r.Reload(); err != nil {
+		t.Fatalf("Reload: %s", err)
+	}
+	if r.changed() {
+		t.Fatal("changed after the reload")
+	}
+
+	// Another rule, the size changes
+	writeRules(t, path, testRules+`
+  - name: asn
+    type: asn
+    window: {size: 60, tick: 10}
+    trigger: {kind: rate, min_requests: 10, min_rate_error: 0.5}
+    action: block-ip
+`)
+	if err := os.Chtimes(path, future, future); err != nil {
+		t.Fatalf("Chtimes: %s", err)
+	}
+	if !r.changed() {
+		t.Fatal("size change not detected")
+	}
+	if err := r.Reload(); err != nil {
+		t.Fatalf("Reload: %s", err)
+	}
+	if len(c.rules) != 2 {
+		t.Fatalf("%d rules after the reload, want 2", len(c.rules))
+	}
+
+	// An invalid file keeps the rules
+	writeRules(t, path, "rules: []\n")
+	if err := r.Reload(); err == nil {
+		t.Fatal("Reload of an invalid file succeeded")
+	}
+	if len(c.rules) != 2 {
+		t.Fatalf("%d rules after an invalid reload, want 2", len(c.rules))
+	}
+	if r.changed() {
+		t.Fatal("an invalid file is reloaded again before it changes")
+	}
+}
@@ -9,7 +9,36 @@ import (
 )
 
 type Trigger interface {
-	Handle(name string, ip string, reqOk uint32, reqError uint32, lastError int64, loginOk uint32, loginError uint32, lastLoginError int64)
+	Handle(name string, ip string, c Counters)
+}
+
+// Counter selects the requests counted as errors by a rate trigger
+type Counter string
+
+const (
+	UnauthorizedCounter = Counter("unauthorized")
+	RateLimitedCounter  = Counter("rate-limited")
+	ServerErrorCounter  = Counter("server-error")
+)
+
+// errors returns the number of errors and the time of the last one
+func (counter Counter) errors(c Counters) (uint32, int64) {
+	switch counter {
+	case RateLimitedCounter:
+		return c.RateLimited, c.LastRateLimited
+	case ServerErrorCounter:
+		return c.ServerError, c.LastServerError
+	default:
+		return c.TotalError, c.LastError
+	}
+}
+
+// cacher is implemented by the triggers that remember the ips or asns they
+// already sent to the action. The cache is moved to the trigger replacing
+// them, so a reload does not send them again.
+type cacher interface {
+	triggerCache() *cache.Cache
+	setTriggerCache(c *cache.Cache)
 }
 
 type Action interface {
@@ -24,8 +53,9 @@ type LoginTrigger struct {
 	action               Action
 }
 
-func (r *LoginTrigger) Handle(name string, ip string, reqOk uint32, reqError uint32, lastError int64, loginOk uint32, loginError uint32, lastLoginError int64) {
-	total := reqOk + reqError
+func (r *LoginTrigger) Handle(name string, ip string, c Counters) {
+	loginOk, loginError, lastLoginError := c.LoginOk, c.LoginError, c.LastLoginError
+	total := c.TotalOk + c.TotalError
 	if total == 0 || loginError == 0 {
 		return
 	}
@@ -54,6 +84,9 @@ func (r *LoginTrigger) Handle(name string, ip string, reqOk uint32, reqError uin
 	}
 }
 
+func (r *LoginTrigger) triggerCache() *cache.Cache     { return r.cache }
+func (r *LoginTrigger) setTriggerCache(c *cache.Cache) { r.cache = c }
+
 type LoginTriggerOpts struct {
 	MinRequests       uint16
 	MinRateLogin      float32
@@ -68,7 +101,7 @@ func (o LoginTriggerOpts) NewTrigger() Trigger {
 	return &LoginTrigger{
 		cache:                c,
 		numMinRequests:       o.MinRequests,
-		minRateLoginReq:      o.MinRateLoginError,
+		minRateLoginReq:      o.MinRateLogin,
 		minRateLoginErrorReq: o.MinRateLoginError,
 		action:               o.Action,
 	}
@@ -77,12 +110,14 @@ func (o LoginTriggerOpts) NewTrigger() Trigger {
 type RateTrigger struct {
 	numMinRequests  uint16
 	minRateErrorReq float32
+	counter         Counter
 	cache           *cache.Cache
 	action          Action
 }
 
-func (r *RateTrigger) Handle(name string, ip string, reqOk uint32, reqError uint32, lastError int64, loginOk uint32, loginError uint32, lastLoginError int64) {
-	total := reqOk + reqError
+func (r *RateTrigger) Handle(name string, ip string, c Counters) {
+	reqError, lastError := r.counter.errors(c)
+	total := c.TotalOk + c.TotalError
 	if total == 0 || reqError == 0 {
 		return
 	}
@@ -101,26 +136,36 @@ func (r *RateTrigger) Handle(name string, ip string, reqOk uint32, reqError uint
 		return
 	}
 
-	log.Printf("Rule triggered for %s %s Req: %d Errors: %d\n", name, ip, total, reqError)
+	log.Printf("Rule triggered for %s %s Req: %d Errors (%s): %d\n", name, ip, total, r.counter, reqError)
 	if err := r.action.Send(name, ip); err == nil {
 		r.cache.Set(key, lastError, cache.DefaultExpiration)
 	}
 }
 
+func (r *RateTrigger) triggerCache() *cache.Cache     { return r.cache }
+func (r *RateTrigger) setTriggerCache(c *cache.Cache) { r.cache = c }
+
 type RateTriggerOpts struct {
 	MinRequests  uint16
 	MinRateError float32
-	Action       Action
+	// Counter of the errors, UnauthorizedCounter if empty
+	Counter Counter
+	Action  Action
 }
 
 func (o RateTriggerOpts) NewTrigger() Trigger {
 	// Create a cache with a default expiration time of 10 minutes, and which
 	// purges expired items every 10 minutes
 	c := cache.New(10*time.Minute, 10*time.Minute)
+	counter := o.Counter
+	if counter == "" {
+		counter = UnauthorizedCounter
+	}
 	return &RateTrigger{
 		cache:           c,
 		numMinRequests:  o.MinRequests,
 		minRateErrorReq: o.MinRateError,
+		counter:         counter,
 		action:          o.Action,
 	}
 }
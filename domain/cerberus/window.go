@@ -6,167 +6,113 @@ import (
 	"time"
 )
 
+// Counters are the requests of an ip or asn in the window. Every request is
+// counted as ok or error (unauthorized), the rate limited and server error
+// requests are counted again on their own.
+type Counters struct {
+	TotalOk         uint32
+	TotalError      uint32
+	LoginOk         uint32
+	LoginError      uint32
+	RateLimited     uint32
+	ServerError     uint32
+	LastError       int64
+	LastLoginError  int64
+	LastRateLimited int64
+	LastServerError int64
+}
+
 type IpMap struct {
-	LoginOk          uint32
-	LoginError       uint32
-	TotalOk          uint32
-	TotalError       uint32
-	LoginOkWindow    []uint16
-	LoginErrorWindow []uint16
-	TotalOkWindow    []uint16
-	TotalErrorWindow []uint16
-	LastError        int64
-	LastLoginError   int64
+	Counters
+	LoginOkWindow     []uint16
+	LoginErrorWindow  []uint16
+	TotalOkWindow     []uint16
+	TotalErrorWindow  []uint16
+	RateLimitedWindow []uint16
+	ServerErrorWindow []uint16
+}
+
+type inc struct {
+	key     string
+	request Request
 }
 
 type Window struct {
-	name                 string
-	ipMap                map[string]*IpMap
-	index                uint16
-	size                 uint16
-	tick                 uint16
-	mu                   sync.Mutex
-	channelIncOk         chan string
-	channelIncError      chan string
-	channelIncLoginOk    chan string
-	channelIncLoginError chan string
-	consumer             Trigger
+	name     string
+	ipMap    map[string]*IpMap
+	index    uint16
+	size     uint16
+	tick     uint16
+	mu       sync.Mutex
+	incs     chan inc
+	consumer Trigger
+	done     chan struct{}
+	stopOnce sync.Once
 }
 
 func (w *Window) Display() {
 	log.Printf("%s: %d\n", w.name, len(w.ipMap))
 }
 
-func (w *Window) Inc(ip string, isLogin bool, isUnauthorized bool) {
-	if isLogin {
-		if isUnauthorized {
-			w.channelIncLoginError <- ip
-		} else {
-			w.channelIncLoginOk <- ip
-		}
-	} else {
-		if isUnauthorized {
-			w.channelIncError <- ip
-		} else {
-			w.channelIncOk <- ip
-		}
-	}
+// Inc counts the request for the ip or asn in key
+func (w *Window) Inc(key string, r Request) {
+	w.incs <- inc{key: key, request: r}
 }
 
 func (w *Window) read() {
 	for {
 		select {
-		case ip := <-w.channelIncOk:
-			w.incOk(ip)
-		case ip := <-w.channelIncError:
-			w.incError(ip)
-		case ip := <-w.channelIncLoginOk:
-			w.incLoginOk(ip)
-		case ip := <-w.channelIncLoginError:
-			w.incLoginError(ip)
+		case <-w.done:
+			return
+		case i := <-w.incs:
+			w.inc(i.key, i.request)
 		}
 	}
 }
 
-func (w *Window) incOk(ip string) {
+func (w *Window) inc(key string, r Request) {
+	now := time.Now().Unix()
 	w.mu.Lock()
 	defer w.mu.Unlock()
-	if ipMap, ok := w.ipMap[ip]; ok {
-		ipMap.TotalOk += 1
-		ipMap.TotalOkWindow[w.index] += 1
-	} else {
-		ipMap := IpMap{
-			LoginOk:          0,
-			LoginError:       0,
-			TotalOk:          1,
-			TotalError:       0,
-			LoginOkWindow:    make([]uint16, w.size),
-			LoginErrorWindow: make([]uint16, w.size),
-			TotalOkWindow:    make([]uint16, w.size),
-			TotalErrorWindow: make([]uint16, w.size),
+	ipMap, ok := w.ipMap[key]
+	if !ok {
+		ipMap = &IpMap{
+			LoginOkWindow:     make([]uint16, w.size),
+			LoginErrorWindow:  make([]uint16, w.size),
+			TotalOkWindow:     make([]uint16, w.size),
+			TotalErrorWindow:  make([]uint16, w.size),
+			RateLimitedWindow: make([]uint16, w.size),
+			ServerErrorWindow: make([]uint16, w.size),
 		}
-		ipMap.TotalOkWindow[w.index] += 1
-		w.ipMap[ip] = &ipMap
+		w.ipMap[key] = ipMap
 	}
-}
 
-func (w *Window) incError(ip string) {
-	now := time.Now().Unix()
-	w.mu.Lock()
-	defer w.mu.Unlock()
-	if ipMap, ok := w.ipMap[ip]; ok {
+	if r.Unauthorized {
 		ipMap.TotalError += 1
 		ipMap.TotalErrorWindow[w.index] += 1
 		ipMap.LastError = now
-	} else {
-		ipMap := IpMap{
-			LoginOk:          0,
-			LoginError:       0,
-			TotalOk:          0,
-			TotalError:       1,
-			LastError:        now,
-			LoginOkWindow:    make([]uint16, w.size),
-			LoginErrorWindow: make([]uint16, w.size),
-			TotalOkWindow:    make([]uint16, w.size),
-			TotalErrorWindow: make([]uint16, w.size),
+		if r.Login {
+			ipMap.LoginError += 1
+			ipMap.LoginErrorWindow[w.index] += 1
+			ipMap.LastLoginError = now
 		}
-		ipMap.TotalErrorWindow[w.index] += 1
-		w.ipMap[ip] = &ipMap
-	}
-}
-
-func (w *Window) incLoginOk(ip string) {
-	w.mu.Lock()
-	defer w.mu.Unlock()
-	if ipMap, ok := w.ipMap[ip]; ok {
+	} else {
 		ipMap.TotalOk += 1
-		ipMap.LoginOk += 1
 		ipMap.TotalOkWindow[w.index] += 1
-		ipMap.LoginOkWindow[w.index] += 1
-	} else {
-		ipMap := IpMap{
-			LoginOk:          1,
-			LoginError:       0,
-			TotalOk:          1,
-			TotalError:       0,
-			LoginOkWindow:    make([]uint16, w.size),
-			LoginErrorWindow: make([]uint16, w.size),
-			TotalOkWindow:    make([]uint16, w.size),
-			TotalErrorWindow: make([]uint16, w.size),
+		if r.Login {
+			ipMap.LoginOk += 1
+			ipMap.LoginOkWindow[w.index] += 1
 		}
-		ipMap.TotalOkWindow[w.index] += 1
-		ipMap.LoginOkWindow[w.index] += 1
-		w.ipMap[ip] = &ipMap
 	}
-}
-
-func (w *Window) incLoginError(ip string) {
-	now := time.Now().Unix()
-	w.mu.Lock()
-	defer w.mu.Unlock()
-	if ipMap, ok := w.ipMap[ip]; ok {
-		ipMap.TotalError += 1
-		ipMap.LoginError += 1
-		ipMap.TotalErrorWindow[w.index] += 1
-		ipMap.LoginErrorWindow[w.index] += 1
-		ipMap.LastError = now
-		ipMap.LastLoginError = now
-	} else {
-		ipMap := IpMap{
-			LoginOk:          0,
-			LoginError:       1,
-			TotalOk:          0,
-			TotalError:       1,
-			LastError:        now,
-			LastLoginError:   now,
-			LoginOkWindow:    make([]uint16, w.size),
-			LoginErrorWindow: make([]uint16, w.size),
-			TotalOkWindow:    make([]uint16, w.size),
-			TotalErrorWindow: make([]uint16, w.size),
-		}
-		ipMap.TotalErrorWindow[w.index] += 1
-		ipMap.LoginErrorWindow[w.index] += 1
-		w.ipMap[ip] = &ipMap
+	if r.RateLimited {
+		ipMap.RateLimited += 1
+		ipMap.RateLimitedWindow[w.index] += 1
+		ipMap.LastRateLimited = now
+	}
+	if r.ServerError {
+		ipMap.ServerError += 1
+		ipMap.ServerErrorWindow[w.index] += 1
+		ipMap.LastServerError = now
 	}
 }
 
@@ -176,7 +122,7 @@ func (w *Window) step() {
 	w.index = (w.index + 1) % w.size
 	for ip, ipMap := range w.ipMap {
 		// Call consumer
-		go w.consumer.Handle(w.name, ip, ipMap.TotalOk, ipMap.TotalError, ipMap.LastError, ipMap.LoginOk, ipMap.LoginError, ipMap.LastLoginError)
+		go w.consumer.Handle(w.name, ip, ipMap.Counters)
 
 		// Remove oldest values
 		ipMap.TotalOk -= uint32(ipMap.TotalOkWindow[w.index])       // remove the oldest value
@@ -188,13 +134,17 @@ func (w *Window) step() {
 			continue
 		}
 
-		ipMap.LoginOk -= uint32(ipMap.LoginOkWindow[w.index])       // remove the oldest value
-		ipMap.LoginError -= uint32(ipMap.LoginErrorWindow[w.index]) // remove the oldest value
+		ipMap.LoginOk -= uint32(ipMap.LoginOkWindow[w.index])         // remove the oldest value
+		ipMap.LoginError -= uint32(ipMap.LoginErrorWindow[w.index])   // remove the oldest value
+		ipMap.RateLimited -= uint32(ipMap.RateLimitedWindow[w.index]) // remove the oldest value
+		ipMap.ServerError -= uint32(ipMap.ServerErrorWindow[w.index]) // remove the oldest value
 
 		ipMap.TotalOkWindow[w.index] = 0
 		ipMap.TotalErrorWindow[w.index] = 0
 		ipMap.LoginOkWindow[w.index] = 0
 		ipMap.LoginErrorWindow[w.index] = 0
+		ipMap.RateLimitedWindow[w.index] = 0
+		ipMap.ServerErrorWindow[w.index] = 0
 	}
 }
 
@@ -204,6 +154,8 @@ func (w *Window) startTick() {
 
 	for {
 		select {
+		case <-w.done:
+			return
 		case <-ticker.C:
 			w.step()
 		}
@@ -216,6 +168,8 @@ func (w *Window) startDisplay() {
 
 	for {
 		select {
+		case <-w.done:
+			return
 		case <-ticker.C:
 			w.Display()
 		}
@@ -228,19 +182,61 @@ func (w *Window) Start() {
 	go w.startDisplay()
 }
 
+// Stop terminates the goroutines launched by Start. A stopped window can not
+// be started again, see renew.
+func (w *Window) Stop() {
+	w.stopOnce.Do(func() {
+		close(w.done)
+	})
+}
+
+func (w *Window) stopped() bool {
+	select {
+	case <-w.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// renew returns an empty window with the geometry and the trigger of w, to
+// replace it once stopped.
+func (w *Window) renew() *Window {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return NewWindow(w.name, w.tick, w.size*w.tick, w.consumer)
+}
+
+// SetConsumer replaces the trigger called on every step keeping the counters.
+// The new trigger keeps the cache of the ips and asns already sent to the
+// action.
+func (w *Window) SetConsumer(consumer Trigger) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if old, ok := w.consumer.(cacher); ok {
+		if c, ok := consumer.(cacher); ok {
+			c.setTriggerCache(old.triggerCache())
+		}
+	}
+	w.consumer = consumer
+}
+
+// HasGeometry reports whether the window was created with the given options.
+func (w *Window) HasGeometry(opts WindowOpts) bool {
+	return opts.Tick != 0 && w.tick == opts.Tick && w.size == opts.Size/opts.Tick
+}
+
 func NewWindow(name string, tickSecs uint16, windowSecs uint16, consumer Trigger) *Window {
 	size := windowSecs / tickSecs
 	return &Window{
-		name:                 name,
-		ipMap:                make(map[string]*IpMap),
-		index:                0,
-		size:                 size,
-		tick:                 tickSecs,
-		mu:                   sync.Mutex{},
-		channelIncOk:         make(chan string, 1000),
-		channelIncError:      make(chan string, 1000),
-		channelIncLoginOk:    make(chan string, 1000),
-		channelIncLoginError: make(chan string, 1000),
-		consumer:             consumer,
+		name:     name,
+		ipMap:    make(map[string]*IpMap),
+		index:    0,
+		size:     size,
+		tick:     tickSecs,
+		mu:       sync.Mutex{},
+		incs:     make(chan inc, 4000),
+		consumer: consumer,
+		done:     make(chan struct{}),
 	}
 }
@@ -0,0 +1,296 @@
+package delivery
+
+import (
+	"fmt"
+	"hash/fnv"
+	"log"
+	"sync"
+	"sync/atomic"
+
+	riemann "github.com/riemann/riemann-go-client"
+)
+
+type Mode string
+
+const (
+	// FanOut sends every event to all the backends
+	FanOut = Mode("fan-out")
+	// Failover sends to the first healthy backend in order
+	Failover = Mode("failover")
+	// Shard sends every event to a backend chosen by its host and service
+	Shard = Mode("shard")
+)
+
+func ParseMode(s string) (Mode, error) {
+	switch m := Mode(s); m {
+	case FanOut, Failover, Shard:
+		return m, nil
+	default:
+		return "", fmt.Errorf("unknown backends mode %q", s)
+	}
+}
+
+type Backend struct {
+	Name    string
+	Address string
+	Pool    *Pool
+	// UDP dials the client used for the UDP events, nil disables them
+	UDP         Dialer
+	udpMu       sync.Mutex
+	udpClient   riemann.Client
+	sent        int64
+	failures    int64
+	lost        int64
+	udpSent     int64
+	udpFailures int64
+}
+
+func (b *Backend) send(events []riemann.Event) error {
+	if err := b.Pool.Send(events); err != nil {
+		atomic.AddInt64(&b.failures, 1)
+		log.Printf("Error sending %d events to riemann backend %s: %s\n", len(events), b.Name, err)
+		return err
+	}
+	atomic.AddInt64(&b.sent, int64(len(events)))
+	return nil
+}
+
+func (b *Backend) sendUDP(events []riemann.Event) error {
+	if b.UDP == nil {
+		return ErrNoConnection
+	}
+	b.udpMu.Lock()
+	defer b.udpMu.Unlock()
+
+	if b.udpClient == nil {
+		client, err := b.UDP()
+		if err != nil {
+			atomic.AddInt64(&b.udpFailures, 1)
+			return err
+		}
+		b.udpClient = client
+	}
+	if _, err := riemann.SendEvents(b.udpClient, &events); err != nil {
+		atomic.AddInt64(&b.udpFailures, 1)
+		closeClient(b.udpClient)
+		b.udpClient = nil
+		return err
+	}
+	atomic.AddInt64(&b.udpSent, int64(len(events)))
+	return nil
+}
+
+type BackendStats struct {
+	Name     string `json:"name"`
+	Address  string `json:"address"`
+	Healthy  bool   `json:"healthy"`
+	Sent     int64  `json:"sent"`
+	Failures int64  `json:"failures"`
+	// Lost are the fan-out events other backends received but this one did
+	// not, they are not sent again
+	Lost        int64       `json:"lost"`
+	UDPSent     int64       `json:"udp_sent"`
+	UDPFailures int64       `json:"udp_failures"`
+	Connections []ConnStats `json:"connections"`
+}
+
+// Backends is a Sender over several riemann servers.
+type Backends struct {
+	mode     Mode
+	backends []*Backend
+}
+
+func NewBackends(mode Mode, backends []*Backend) *Backends {
+	return &Backends{
+		mode:     mode,
+		backends: backends,
+	}
+}
+
+type sendFunc func(backend *Backend, events []riemann.Event) error
+
+func (b *Backends) Send(events []riemann.Event) error {
+	return b.route(events, (*Backend).send)
+}
+
+// SendUDP sends the events over UDP following the same mode. The health of
+// the TCP connections is used to choose the backend.
+func (b *Backends) SendUDP(events []riemann.Event) error {
+	return b.route(events, (*Backend).sendUDP)
+}
+
+func (b *Backends) route(events []riemann.Event, send sendFunc) error {
+	switch b.mode {
+	case FanOut:
+		return b.fanOut(events, send)
+	case Shard:
+		return b.shard(events, send)
+	default:
+		return b.failover(b.backends, events, send)
+	}
+}
+
+// fanOut sends the events to all the backends at the same time. It only
+// fails if no backend received the events, then all of them are sent again.
+// Otherwise the events of the failed backends are counted as lost, sending
+// them again would duplicate them in the rest.
+func (b *Backends) fanOut(events []riemann.Event, send sendFunc) error {
+	var wg sync.WaitGroup
+	errs := make([]error, len(b.backends))
+	for i, backend := range b.backends {
+		wg.Add(1)
+		go func(i int, backend *Backend) {
+			defer wg.Done()
+			errs[i] = send(backend, events)
+		}(i, backend)
+	}
+	wg.Wait()
+
+	failed := 0
+	for _, err := range errs {
+		if err != nil {
+			failed++
+		}
+	}
+	if failed == len(b.backends) {
+		return errs[0]
+	}
+	for i, err := range errs {
+		if err != nil {
+			atomic.AddInt64(&b.backends[i].lost, int64(len(events)))
+			log.Printf("%d events lost in riemann backend %s: %s\n", len(events), b.backends[i].Name, err)
+		}
+	}
+	return nil
+}
+
+// failover sends the events to the first healthy backend. If it fails the
+// next backends are tried in order.
+func (b *Backends) failover(backends []*Backend, events []riemann.Event, send sendFunc) error {
+	err := ErrNoConnection
+	tried := make([]bool, len(backends))
+	for i, backend := range backends {
+		if !backend.Pool.Healthy() {
+			continue
+		}
+		tried[i] = true
+		if err = send(backend, events); err == nil {
+			return nil
+		}
+	}
+
+	// No healthy backend accepted the events, try the rest as a last resort
+	for i, backend := range backends {
+		if tried[i] {
+			continue
+		}
+		if err = send(backend, events); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// Query runs the index query. In shard mode every backend has part of the
+// events, so all of them are queried and the results merged. Otherwise the
+// first healthy backend that answers is used.
+func (b *Backends) Query(q string) ([]riemann.Event, error) {
+	if b.mode == Shard {
+		events := []riemann.Event{}
+		for _, backend := range b.backends {
+			backendEvents, err := backend.Pool.Query(q)
+			if err != nil {
+				return nil, fmt.Errorf("riemann backend %s: %s", backend.Name, err)
+			}
+			events = append(events, backendEvents...)
+		}
+		return events, nil
+	}
+
+	err := ErrNoConnection
+	for _, healthy := range []bool{true, false} {
+		for _, backend := range b.backends {
+			if backend.Pool.Healthy() != healthy {
+				continue
+			}
+			var events []riemann.Event
+			if events, err = backend.Pool.Query(q); err == nil {
+				return events, nil
+			}
+		}
+	}
+	return nil, err
+}
+
+// shard groups the events by the hash of their host and service. If the
+// backend of a group fails, the group fails over to the next backends. When
+// only some groups fail a PartialError with their events is returned.
+func (b *Backends) shard(events []riemann.Event, send sendFunc) error {
+	groups := make([][]riemann.Event, len(b.backends))
+	for _, e := range events {
+		h := fnv.New32a()
+		h.Write([]byte(e.Host))
+		h.Write([]byte{0})
+		h.Write([]byte(e.Service))
+		i := int(h.Sum32() % uint32(len(b.backends)))
+		groups[i] = append(groups[i], e)
+	}
+
+	var lastErr error
+	failed := []riemann.Event{}
+	for i, group := range groups {
+		if len(group) == 0 {
+			continue
+		}
+		order := append(append([]*Backend{}, b.backends[i:]...), b.backends[:i]...)
+		if err := b.failover(order, group, send); err != nil {
+			lastErr = err
+			failed = append(failed, group...)
+		}
+	}
+	if lastErr == nil || len(failed) == len(events) {
+		return lastErr
+	}
+	return &PartialError{Events: failed, Err: lastErr}
+}
+
+func (b *Backends) Connect() error {
+	var lastErr error
+	for _, backend := range b.backends {
+		if err := backend.Pool.Connect(); err != nil {
+			log.Printf("Failed to connect to riemann backend %s: %s\n", backend.Name, err)
+			lastErr = err
+		}
+	}
+	return lastErr
+}
+
+func (b *Backends) Close() {
+	for _, backend := range b.backends {
+		backend.Pool.Close()
+		backend.udpMu.Lock()
+		if backend.udpClient != nil {
+			closeClient(backend.udpClient)
+			backend.udpClient = nil
+		}
+		backend.udpMu.Unlock()
+	}
+}
+
+func (b *Backends) Stats() []BackendStats {
+	stats := make([]BackendStats, len(b.backends))
+	for i, backend := range b.backends {
+		stats[i] = BackendStats{
+			Name:        backend.Name,
+			Address:     backend.Address,
+			Healthy:     backend.Pool.Healthy(),
+			Sent:        atomic.LoadInt64(&backend.sent),
+			Failures:    atomic.LoadInt64(&backend.failures),
+			Lost:        atomic.LoadInt64(&backend.lost),
+			UDPSent:     atomic.LoadInt64(&backend.udpSent),
+			UDPFailures: atomic.LoadInt64(&backend.udpFailures),
+			Connections: backend.Pool.Stats(),
+		}
+	}
+	return stats
+}
@@ -0,0 +1,93 @@
+package delivery
+
+import (
+	"errors"
+	"testing"
+
+	riemann "github.com/riemann/riemann-go-client"
+)
+
+func testBackends(mode Mode, names ...string) *Backends {
+	backends := make([]*Backend, len(names))
+	for i, name := range names {
+		dial := func() (riemann.Client, error) { return nil, ErrNoConnection }
+		backends[i] = &Backend{Name: name, Pool: NewPool(dial, PoolOptions{Size: 1})}
+	}
+	return NewBackends(mode, backends)
+}
+
+func TestShardPartialFailure(t *testing.T) {
+	tests := []struct {
+		name string
+		// accepted is the number of sends that succeed before every send fails
+		accepted int
+		partial  bool
+		err      bool
+	}{
+		{"every group sent", 2, false, false},
+		{"one group failed", 1, true, true},
+		{"every group failed", 0, false, true},
+	}
+	events := testEvents("s", 20)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := testBackends(Shard, "a", "b")
+			sends := 0
+			sent := 0
+			send := func(backend *Backend, group []riemann.Event) error {
+				if sends >= tt.accepted {
+					return errors.New("down")
+				}
+				sends++
+				sent += len(group)
+				return nil
+			}
+
+			err := b.shard(events, send)
+			if (err != nil) != tt.err {
+				t.Fatalf("err = %v", err)
+			}
+			var partial *PartialError
+			if errors.As(err, &partial) != tt.partial {
+				t.Fatalf("err = %v, partial %v expected", err, tt.partial)
+			}
+			if got := len(unsent(events, err)); err != nil && got+sent != len(events) {
+				t.Fatalf("%d unsent and %d sent events, want %d", got, sent, len(events))
+			}
+		})
+	}
+}
+
+func TestFanOutCountsLostEvents(t *testing.T) {
+	tests := []struct {
+		name string
+		down map[string]bool
+		err  bool
+		lost []int64
+	}{
+		{"every backend sent", map[string]bool{}, false, []int64{0, 0}},
+		{"one backend failed", map[string]bool{"b": true}, false, []int64{0, 3}},
+		{"every backend failed", map[string]bool{"a": true, "b": true}, true, []int64{0, 0}},
+	}
+	events := testEvents("s", 3)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := testBackends(FanOut, "a", "b")
+			send := func(backend *Backend, group []riemann.Event) error {
+				if tt.down[backend.Name] {
+					return errors.New("down")
+				}
+				return nil
+			}
+
+			if err := b.fanOut(events, send); (err != nil) != tt.err {
+				t.Fatalf("err = %v", err)
+			}
+			for i, stats := range b.Stats() {
+				if stats.Lost != tt.lost[i] {
+					t.Fatalf("backend %s lost %d events, want %d", stats.Name, stats.Lost, tt.lost[i])
+				}
+			}
+		})
+	}
+}
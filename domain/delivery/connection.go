@@ -0,0 +1,132 @@
+package delivery
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"time"
+
+	riemann "github.com/riemann/riemann-go-client"
+)
+
+// Sender delivers a batch of events to Riemann.
+type Sender interface {
+	Send(events []riemann.Event) error
+}
+
+// PartialError is returned by a Sender that delivered only part of the batch.
+// Events are the ones not sent, only they must be sent again.
+type PartialError struct {
+	Events []riemann.Event
+	Err    error
+}
+
+func (e *PartialError) Error() string {
+	return fmt.Sprintf("%d events not sent: %s", len(e.Events), e.Err)
+}
+
+func (e *PartialError) Unwrap() error {
+	return e.Err
+}
+
+// unsent returns the events of the batch that were not sent because of err
+func unsent(batch []riemann.Event, err error) []riemann.Event {
+	var partial *PartialError
+	if errors.As(err, &partial) {
+		return partial.Events
+	}
+	return batch
+}
+
+// Dialer creates a new connected riemann client.
+type Dialer func() (riemann.Client, error)
+
+func TCPDialer(address string, timeout time.Duration) Dialer {
+	return func() (riemann.Client, error) {
+		client := riemann.NewTCPClient(address, timeout)
+		if err := client.Connect(); err != nil {
+			closeClient(client)
+			return nil, err
+		}
+		return client, nil
+	}
+}
+
+func UDPDialer(address string, timeout time.Duration) Dialer {
+	return func() (riemann.Client, error) {
+		client := riemann.NewUDPClient(address, timeout)
+		if err := client.Connect(); err != nil {
+			closeClient(client)
+			return nil, err
+		}
+		return client, nil
+	}
+}
+
+// TLSDialer connects with TLS. If the config has no server name the host of
+// the address is used.
+func TLSDialer(address string, tlsConfig *tls.Config, timeout time.Duration) Dialer {
+	config := tlsConfig.Clone()
+	if config.ServerName == "" {
+		if host, _, err := net.SplitHostPort(address); err == nil {
+			config.ServerName = host
+		}
+	}
+	return func() (riemann.Client, error) {
+		client, err := riemann.NewTLSClient(address, config, timeout)
+		if err != nil {
+			return nil, err
+		}
+		if err := client.Connect(); err != nil {
+			closeClient(client)
+			return nil, err
+		}
+		return client, nil
+	}
+}
+
+// LoadTLSConfig builds the TLS config of the riemann connections. Without a
+// CA file the system roots are used, the client certificate is optional.
+func LoadTLSConfig(caFile, certFile, keyFile, serverName string) (*tls.Config, error) {
+	config := &tls.Config{
+		ServerName: serverName,
+		MinVersion: tls.VersionTLS12,
+	}
+
+	if caFile != "" {
+		ca, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("Cannot read CA file: %s", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("No certificates found in CA file %s", caFile)
+		}
+		config.RootCAs = pool
+	}
+
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("Cannot load client certificate: %s", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+// closeClient releases a riemann client. The upstream clients panic when
+// they are closed without an established connection, so that panic is
+// ignored.
+func closeClient(client riemann.Client) {
+	defer func() {
+		recover()
+	}()
+	if err := client.Close(); err != nil {
+		log.Printf("Error closing riemann client: %s\n", err)
+	}
+}
@@ -0,0 +1,49 @@
+package delivery
+
+import (
+	"net/http"
+
+	"github.com/go-chi/render"
+)
+
+type StatsResponse struct {
+	*Stats
+	Backends []BackendStats `json:"backends"`
+	UDP      *UDPStats      `json:"udp,omitempty"`
+}
+
+func (sr *StatsResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	render.Status(r, http.StatusOK)
+	return nil
+}
+
+type HttpTransport interface {
+	Stats(w http.ResponseWriter, r *http.Request)
+}
+
+type httpTransport struct {
+	queue    *Queue
+	backends *Backends
+	udp      *UDPPublisher
+}
+
+func NewHTTP(queue *Queue, backends *Backends, udp *UDPPublisher) HttpTransport {
+	return &httpTransport{
+		queue:    queue,
+		backends: backends,
+		udp:      udp,
+	}
+}
+
+func (h httpTransport) Stats(w http.ResponseWriter, r *http.Request) {
+	stats := h.queue.Stats()
+	response := &StatsResponse{
+		Stats:    &stats,
+		Backends: h.backends.Stats(),
+	}
+	if h.udp != nil {
+		udpStats := h.udp.Stats()
+		response.UDP = &udpStats
+	}
+	render.Render(w, r, response)
+}
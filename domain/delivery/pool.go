@@ -0,0 +1,342 @@
+package delivery
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	riemann "github.com/riemann/riemann-go-client"
+)
+
+var ErrNoConnection = errors.New("no riemann connection available")
+
+// ErrQueryNotSupported is returned by the clients without index queries
+var ErrQueryNotSupported = errors.New("riemann queries are not supported by the connection")
+
+// healthQuery matches no event, it is only used to check the connection
+const healthQuery = `service = "riemann-http.health-check"`
+
+type Selection string
+
+const (
+	RoundRobin = Selection("round-robin")
+	LeastBusy  = Selection("least-busy")
+)
+
+func ParseSelection(s string) (Selection, error) {
+	switch sel := Selection(s); sel {
+	case RoundRobin, LeastBusy:
+		return sel, nil
+	default:
+		return "", fmt.Errorf("unknown pool selection %q", s)
+	}
+}
+
+type PoolOptions struct {
+	Size                int
+	Selection           Selection
+	HealthCheckInterval time.Duration
+}
+
+type ConnStats struct {
+	Healthy  bool  `json:"healthy"`
+	Inflight int64 `json:"inflight"`
+	Sent     int64 `json:"sent"`
+	Failures int64 `json:"failures"`
+}
+
+type poolConn struct {
+	mu       sync.Mutex
+	dial     Dialer
+	client   riemann.Client
+	healthy  int32
+	inflight int64
+	sent     int64
+	failures int64
+}
+
+func (c *poolConn) isHealthy() bool {
+	return atomic.LoadInt32(&c.healthy) == 1
+}
+
+func (c *poolConn) setHealthy(healthy bool) {
+	if healthy {
+		atomic.StoreInt32(&c.healthy, 1)
+	} else {
+		atomic.StoreInt32(&c.healthy, 0)
+	}
+}
+
+// connect dials the client if there is none. Must be called with the lock.
+func (c *poolConn) connect() error {
+	if c.client != nil {
+		return nil
+	}
+	client, err := c.dial()
+	if err != nil {
+		c.setHealthy(false)
+		return err
+	}
+	c.client = client
+	c.setHealthy(true)
+	return nil
+}
+
+// reset closes the broken client. Must be called with the lock.
+func (c *poolConn) reset() {
+	c.setHealthy(false)
+	if c.client != nil {
+		closeClient(c.client)
+		c.client = nil
+	}
+}
+
+func (c *poolConn) send(events []riemann.Event) error {
+	atomic.AddInt64(&c.inflight, 1)
+	defer atomic.AddInt64(&c.inflight, -1)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.connect(); err != nil {
+		atomic.AddInt64(&c.failures, 1)
+		return err
+	}
+	if _, err := riemann.SendEvents(c.client, &events); err != nil {
+		atomic.AddInt64(&c.failures, 1)
+		c.reset()
+		return err
+	}
+	atomic.AddInt64(&c.sent, int64(len(events)))
+	return nil
+}
+
+func (c *poolConn) query(q string) ([]riemann.Event, error) {
+	atomic.AddInt64(&c.inflight, 1)
+	defer atomic.AddInt64(&c.inflight, -1)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.connect(); err != nil {
+		return nil, err
+	}
+	indexClient, ok := c.client.(riemann.IndexClient)
+	if !ok {
+		return nil, ErrQueryNotSupported
+	}
+	events, err := indexClient.QueryIndex(q)
+	if err != nil {
+		c.reset()
+		return nil, err
+	}
+	return events, nil
+}
+
+// check queries the client and replaces it if it is broken. The new client
+// is dialed without the lock, so the sends do not wait for the dial.
+func (c *poolConn) check() {
+	c.mu.Lock()
+	if indexClient, ok := c.client.(riemann.IndexClient); ok {
+		if _, err := indexClient.QueryIndex(healthQuery); err != nil {
+			log.Printf("Riemann connection health check failed: %s\n", err)
+			c.reset()
+		}
+	}
+	connected := c.client != nil
+	c.mu.Unlock()
+	if connected {
+		return
+	}
+
+	client, err := c.dial()
+	if err != nil {
+		c.setHealthy(false)
+		log.Printf("Failed to replace riemann connection: %s\n", err)
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.client != nil {
+		// A send connected it meanwhile
+		closeClient(client)
+		return
+	}
+	c.client = client
+	c.setHealthy(true)
+}
+
+// Pool is a Sender over a fixed number of riemann connections. It can be
+// used concurrently, every connection is used by one send at a time. Broken
+// connections are replaced on the next send or health check.
+type Pool struct {
+	opts  PoolOptions
+	conns []*poolConn
+	next  uint32
+	done  chan struct{}
+	// healthOnce starts the health checks on the first Connect
+	healthOnce sync.Once
+	closeOnce  sync.Once
+}
+
+func NewPool(dial Dialer, opts PoolOptions) *Pool {
+	conns := make([]*poolConn, opts.Size)
+	for i := range conns {
+		conns[i] = &poolConn{dial: dial}
+	}
+	return &Pool{
+		opts:  opts,
+		conns: conns,
+		done:  make(chan struct{}),
+	}
+}
+
+// Connect dials every connection and starts the health checks, only once
+// if it is called again. It fails if no connection could be established.
+func (p *Pool) Connect() error {
+	var lastErr error
+	connected := 0
+	for _, c := range p.conns {
+		c.mu.Lock()
+		if err := c.connect(); err != nil {
+			lastErr = err
+		} else {
+			connected++
+		}
+		c.mu.Unlock()
+	}
+
+	if p.opts.HealthCheckInterval > 0 {
+		p.healthOnce.Do(func() {
+			go p.healthCheck()
+		})
+	}
+	if connected == 0 {
+		return lastErr
+	}
+	return nil
+}
+
+// Close stops the health checks and closes the connections. It can be called
+// more than once.
+func (p *Pool) Close() {
+	p.closeOnce.Do(func() {
+		close(p.done)
+	})
+	for _, c := range p.conns {
+		c.mu.Lock()
+		c.reset()
+		c.mu.Unlock()
+	}
+}
+
+func (p *Pool) healthCheck() {
+	ticker := time.NewTicker(p.opts.HealthCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-ticker.C:
+			for _, c := range p.conns {
+				c.check()
+			}
+		}
+	}
+}
+
+// pick selects a healthy connection, or any connection if none is healthy
+func (p *Pool) pick(exclude *poolConn) *poolConn {
+	var selected *poolConn
+	if p.opts.Selection == LeastBusy {
+		for _, c := range p.conns {
+			if c == exclude || !c.isHealthy() {
+				continue
+			}
+			if selected == nil || atomic.LoadInt64(&c.inflight) < atomic.LoadInt64(&selected.inflight) {
+				selected = c
+			}
+		}
+	} else {
+		start := atomic.AddUint32(&p.next, 1)
+		for i := 0; i < len(p.conns); i++ {
+			c := p.conns[(int(start)+i)%len(p.conns)]
+			if c != exclude && c.isHealthy() {
+				selected = c
+				break
+			}
+		}
+	}
+
+	if selected == nil {
+		for _, c := range p.conns {
+			if c != exclude {
+				return c
+			}
+		}
+	}
+	return selected
+}
+
+// Send sends the events through one of the connections. If it fails the
+// events are sent again through another connection.
+func (p *Pool) Send(events []riemann.Event) error {
+	c := p.pick(nil)
+	if c == nil {
+		return ErrNoConnection
+	}
+	err := c.send(events)
+	if err == nil {
+		return nil
+	}
+
+	retry := p.pick(c)
+	if retry == nil {
+		return err
+	}
+	return retry.send(events)
+}
+
+// Query runs the index query through one of the connections. If it fails the
+// query is run again through another connection.
+func (p *Pool) Query(q string) ([]riemann.Event, error) {
+	c := p.pick(nil)
+	if c == nil {
+		return nil, ErrNoConnection
+	}
+	events, err := c.query(q)
+	if err == nil {
+		return events, nil
+	}
+
+	retry := p.pick(c)
+	if retry == nil {
+		return nil, err
+	}
+	return retry.query(q)
+}
+
+// Healthy reports whether any connection is healthy
+func (p *Pool) Healthy() bool {
+	for _, c := range p.conns {
+		if c.isHealthy() {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Pool) Stats() []ConnStats {
+	stats := make([]ConnStats, len(p.conns))
+	for i, c := range p.conns {
+		stats[i] = ConnStats{
+			Healthy:  c.isHealthy(),
+			Inflight: atomic.LoadInt64(&c.inflight),
+			Sent:     atomic.LoadInt64(&c.sent),
+			Failures: atomic.LoadInt64(&c.failures),
+		}
+	}
+	return stats
+}
@@ -0,0 +1,207 @@
+package delivery
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	riemann "github.com/riemann/riemann-go-client"
+	"github.com/riemann/riemann-go-client/proto"
+)
+
+type fakeClient struct {
+	mu     sync.Mutex
+	fail   bool
+	sends  int
+	closed bool
+}
+
+func (c *fakeClient) Send(message *proto.Msg) (*proto.Msg, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.fail {
+		return nil, errors.New("broken connection")
+	}
+	c.sends++
+	return &proto.Msg{}, nil
+}
+
+func (c *fakeClient) QueryIndex(q string) ([]riemann.Event, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.fail {
+		return nil, errors.New("broken connection")
+	}
+	return nil, nil
+}
+
+func (c *fakeClient) Connect() error { return nil }
+
+func (c *fakeClient) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	return nil
+}
+
+func (c *fakeClient) sent() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.sends
+}
+
+// fakeDialer returns a new fakeClient on every dial
+type fakeDialer struct {
+	mu      sync.Mutex
+	clients []*fakeClient
+}
+
+func (d *fakeDialer) dial() (riemann.Client, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	c := &fakeClient{}
+	d.clients = append(d.clients, c)
+	return c, nil
+}
+
+func (d *fakeDialer) client(i int) *fakeClient {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.clients[i]
+}
+
+func TestPoolRoundRobin(t *testing.T) {
+	dialer := &fakeDialer{}
+	p := NewPool(dialer.dial, PoolOptions{Size: 3, Selection: RoundRobin})
+	if err := p.Connect(); err != nil {
+		t.Fatalf("Connect: %s", err)
+	}
+	defer p.Close()
+
+	for i := 0; i < 6; i++ {
+		if err := p.Send(testEvents("s", 1)); err != nil {
+			t.Fatalf("Send: %s", err)
+		}
+	}
+	for i := 0; i < 3; i++ {
+		if sent := dialer.client(i).sent(); sent != 2 {
+			t.Errorf("connection %d sent %d batches, want 2", i, sent)
+		}
+	}
+}
+
+func TestPoolLeastBusy(t *testing.T) {
+	dialer := &fakeDialer{}
+	p := NewPool(dialer.dial, PoolOptions{Size: 3, Selection: LeastBusy})
+	if err := p.Connect(); err != nil {
+		t.Fatalf("Connect: %s", err)
+	}
+	defer p.Close()
+
+	atomic.StoreInt64(&p.conns[0].inflight, 2)
+	atomic.StoreInt64(&p.conns[1].inflight, 0)
+	atomic.StoreInt64(&p.conns[2].inflight, 1)
+	if c := p.pick(nil); c != p.conns[1] {
+		t.Fatal("the least busy connection was not picked")
+	}
+	p.conns[1].setHealthy(false)
+	if c := p.pick(nil); c != p.conns[2] {
+		t.Fatal("the least busy healthy connection was not picked")
+	}
+	if c := p.pick(p.conns[2]); c != p.conns[0] {
+		t.Fatal("the excluded connection was picked")
+	}
+}
+
+func TestPoolReplacesBrokenConnection(t *testing.T) {
+	dialer := &fakeDialer{}
+	p := NewPool(dialer.dial, PoolOptions{Size: 2, Selection: RoundRobin})
+	if err := p.Connect(); err != nil {
+		t.Fatalf("Connect: %s", err)
+	}
+	defer p.Close()
+
+	broken := dialer.client(0)
+	broken.mu.Lock()
+	broken.fail = true
+	broken.mu.Unlock()
+
+	// The failed send is sent again through the other connection
+	for i := 0; i < 2; i++ {
+		if err := p.Send(testEvents("s", 1)); err != nil {
+			t.Fatalf("Send: %s", err)
+		}
+	}
+	if !broken.closed || p.conns[0].isHealthy() {
+		t.Fatal("the broken connection was not closed")
+	}
+	if sent := dialer.client(1).sent(); sent != 2 {
+		t.Fatalf("the healthy connection sent %d batches, want 2", sent)
+	}
+
+	p.conns[0].check()
+	if !p.conns[0].isHealthy() || p.conns[0].client != dialer.client(2) {
+		t.Fatal("the health check did not replace the broken connection")
+	}
+}
+
+func TestPoolCheckDialsWithoutLock(t *testing.T) {
+	dialing := make(chan struct{})
+	release := make(chan struct{})
+	var dials int32
+	slow := &fakeClient{}
+	fast := &fakeClient{}
+	dial := func() (riemann.Client, error) {
+		if atomic.AddInt32(&dials, 1) == 1 {
+			close(dialing)
+			<-release
+			return slow, nil
+		}
+		return fast, nil
+	}
+	p := NewPool(dial, PoolOptions{Size: 1})
+	defer p.Close()
+
+	checked := make(chan struct{})
+	go func() {
+		p.conns[0].check()
+		close(checked)
+	}()
+	<-dialing
+
+	sent := make(chan error)
+	go func() {
+		sent <- p.Send(testEvents("s", 1))
+	}()
+	select {
+	case err := <-sent:
+		if err != nil {
+			t.Fatalf("Send: %s", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the send waited for the dial of the health check")
+	}
+
+	close(release)
+	<-checked
+	if !slow.closed || p.conns[0].client != fast {
+		t.Fatal("the health check replaced the connection of the send")
+	}
+}
+
+func TestPoolConnectAndCloseTwice(t *testing.T) {
+	dialer := &fakeDialer{}
+	p := NewPool(dialer.dial, PoolOptions{Size: 1, HealthCheckInterval: time.Hour})
+	for i := 0; i < 2; i++ {
+		if err := p.Connect(); err != nil {
+			t.Fatalf("Connect: %s", err)
+		}
+	}
+	p.Close()
+	p.Close()
+	if !dialer.client(0).closed {
+		t.Fatal("the connection was not closed")
+	}
+}
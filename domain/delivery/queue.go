@@ -0,0 +1,329 @@
+package delivery
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	riemann "github.com/riemann/riemann-go-client"
+)
+
+var ErrQueueFull = errors.New("delivery queue is full")
+
+type FullPolicy string
+
+const (
+	// Block waits until there is room in the queue
+	Block = FullPolicy("block")
+	// DropOldest discards the oldest queued event to make room
+	DropOldest = FullPolicy("drop-oldest")
+	// Reject fails with ErrQueueFull
+	Reject = FullPolicy("reject")
+)
+
+func ParseFullPolicy(s string) (FullPolicy, error) {
+	switch p := FullPolicy(s); p {
+	case Block, DropOldest, Reject:
+		return p, nil
+	default:
+		return "", fmt.Errorf("unknown queue full policy %q", s)
+	}
+}
+
+type Options struct {
+	QueueSize     int
+	BatchSize     int
+	FlushInterval time.Duration
+	FullPolicy    FullPolicy
+	BackoffMin    time.Duration
+	BackoffMax    time.Duration
+}
+
+type Stats struct {
+	Queued   int64       `json:"queued"`
+	Sent     int64       `json:"sent"`
+	Dropped  int64       `json:"dropped"`
+	Rejected int64       `json:"rejected"`
+	Failures int64       `json:"failures"`
+	Spool    *SpoolStats `json:"spool,omitempty"`
+}
+
+// Queue is a bounded in-memory queue of events. A single worker flushes the
+// queued events to the Sender in batches, retrying with exponential backoff
+// while the Sender fails.
+//
+// With a Spool the failed batches are written to disk instead of retried.
+// While the spool has pending batches every new batch is spooled too, so the
+// events are replayed in order once the Sender works again.
+type Queue struct {
+	opts       Options
+	sender     Sender
+	spool      *Spool
+	events     chan riemann.Event
+	done       chan struct{}
+	finished   chan struct{}
+	stopOnce   sync.Once
+	rejectMu   sync.Mutex
+	backoff    time.Duration
+	nextReplay time.Time
+	// partial has the events of the oldest spooled record not sent yet when
+	// only part of it was sent
+	partial  *record
+	sent     int64
+	dropped  int64
+	rejected int64
+	failures int64
+}
+
+func NewQueue(sender Sender, spool *Spool, opts Options) *Queue {
+	return &Queue{
+		opts:     opts,
+		sender:   sender,
+		spool:    spool,
+		events:   make(chan riemann.Event, opts.QueueSize),
+		done:     make(chan struct{}),
+		finished: make(chan struct{}),
+		backoff:  opts.BackoffMin,
+	}
+}
+
+// Publish queues the events following the queue full policy. With Reject
+// either all the events are queued or none of them.
+func (q *Queue) Publish(events ...riemann.Event) error {
+	switch q.opts.FullPolicy {
+	case Reject:
+		return q.publishOrReject(events)
+	case DropOldest:
+		for _, e := range events {
+			q.pushDropOldest(e)
+		}
+	default:
+		for _, e := range events {
+			q.events <- e
+		}
+	}
+	return nil
+}
+
+// publishOrReject queues the events only if there is room for all of them.
+// The publishers hold the lock, so the room can only grow while they queue.
+func (q *Queue) publishOrReject(events []riemann.Event) error {
+	q.rejectMu.Lock()
+	defer q.rejectMu.Unlock()
+	if cap(q.events)-len(q.events) < len(events) {
+		atomic.AddInt64(&q.rejected, int64(len(events)))
+		return ErrQueueFull
+	}
+	for _, e := range events {
+		q.events <- e
+	}
+	return nil
+}
+
+func (q *Queue) pushDropOldest(e riemann.Event) {
+	for {
+		select {
+		case q.events <- e:
+			return
+		default:
+		}
+
+		select {
+		case <-q.events:
+			atomic.AddInt64(&q.dropped, 1)
+		default:
+		}
+	}
+}
+
+func (q *Queue) Stats() Stats {
+	stats := Stats{
+		Queued:   int64(len(q.events)),
+		Sent:     atomic.LoadInt64(&q.sent),
+		Dropped:  atomic.LoadInt64(&q.dropped),
+		Rejected: atomic.LoadInt64(&q.rejected),
+		Failures: atomic.LoadInt64(&q.failures),
+	}
+	if q.spool != nil {
+		spoolStats := q.spool.Stats()
+		stats.Spool = &spoolStats
+	}
+	return stats
+}
+
+func (q *Queue) Start() {
+	go q.run()
+}
+
+// Close terminates the worker. The queued events are written to the spool,
+// or sent once if there is no spool.
+func (q *Queue) Close() {
+	q.stopOnce.Do(func() {
+		close(q.done)
+	})
+	<-q.finished
+}
+
+func (q *Queue) run() {
+	defer close(q.finished)
+	ticker := time.NewTicker(q.opts.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]riemann.Event, 0, q.opts.BatchSize)
+	for {
+		select {
+		case <-q.done:
+			q.drain(batch)
+			return
+		case e := <-q.events:
+			batch = append(batch, e)
+			if len(batch) < q.opts.BatchSize {
+				continue
+			}
+		case <-ticker.C:
+			q.replay()
+			if len(batch) == 0 {
+				continue
+			}
+		}
+
+		q.flush(batch)
+		batch = make([]riemann.Event, 0, q.opts.BatchSize)
+	}
+}
+
+func (q *Queue) drain(batch []riemann.Event) {
+	for len(q.events) > 0 {
+		batch = append(batch, <-q.events)
+	}
+	if len(batch) == 0 {
+		return
+	}
+
+	if q.spool != nil {
+		err := q.spool.Write(batch)
+		if err == nil {
+			log.Printf("%d events spooled on close\n", len(batch))
+			return
+		}
+		log.Printf("Error spooling %d events: %s\n", len(batch), err)
+	}
+	if err := q.sender.Send(batch); err != nil {
+		lost := unsent(batch, err)
+		atomic.AddInt64(&q.sent, int64(len(batch)-len(lost)))
+		log.Printf("Error sending %d events on close, events lost: %s\n", len(lost), err)
+		return
+	}
+	atomic.AddInt64(&q.sent, int64(len(batch)))
+}
+
+func (q *Queue) flush(batch []riemann.Event) {
+	if q.spool == nil {
+		q.sendWithRetry(batch)
+		return
+	}
+
+	// The spooled batches go first to keep the events in order
+	if !q.spool.Empty() {
+		q.replay()
+	}
+	if q.spool.Empty() {
+		err := q.sender.Send(batch)
+		if err == nil {
+			atomic.AddInt64(&q.sent, int64(len(batch)))
+			return
+		}
+		failed := unsent(batch, err)
+		atomic.AddInt64(&q.sent, int64(len(batch)-len(failed)))
+		atomic.AddInt64(&q.failures, 1)
+		q.nextReplay = time.Now().Add(q.backoff)
+		log.Printf("Error sending %d events, spooling: %s\n", len(failed), err)
+		batch = failed
+	}
+
+	if err := q.spool.Write(batch); err != nil {
+		log.Printf("Error spooling %d events: %s\n", len(batch), err)
+		q.sendWithRetry(batch)
+	}
+}
+
+// replay sends the spooled batches in order while the sends succeed, for at
+// most a flush interval so the worker keeps reading the queue. After a
+// failure it waits for the backoff before trying again.
+func (q *Queue) replay() {
+	if q.spool == nil || time.Now().Before(q.nextReplay) {
+		return
+	}
+
+	deadline := time.Now().Add(q.opts.FlushInterval)
+	for time.Now().Before(deadline) {
+		r, err := q.spool.Peek()
+		if err != nil {
+			log.Printf("Error reading spool: %s\n", err)
+			return
+		}
+		if r == nil {
+			return
+		}
+
+		// Only the events not sent by the last try are sent again
+		events := r.events
+		if q.partial != nil && q.partial.segment == r.segment && q.partial.offset == r.offset {
+			events = q.partial.events
+		}
+		if err := q.sender.Send(events); err != nil {
+			failed := unsent(events, err)
+			atomic.AddInt64(&q.sent, int64(len(events)-len(failed)))
+			unsentRecord := *r
+			unsentRecord.events = failed
+			q.partial = &unsentRecord
+			atomic.AddInt64(&q.failures, 1)
+			log.Printf("Error replaying %d spooled events, retrying in %s: %s\n", len(failed), q.backoff, err)
+			q.nextReplay = time.Now().Add(q.backoff)
+			q.backoff *= 2
+			if q.backoff > q.opts.BackoffMax {
+				q.backoff = q.opts.BackoffMax
+			}
+			return
+		}
+
+		q.backoff = q.opts.BackoffMin
+		q.partial = nil
+		atomic.AddInt64(&q.sent, int64(len(events)))
+		if err := q.spool.Commit(r); err != nil {
+			log.Printf("Error saving spool cursor: %s\n", err)
+		}
+	}
+}
+
+// sendWithRetry sends the batch until it succeeds or the queue is closed.
+// After a partial failure only the events not sent are retried.
+func (q *Queue) sendWithRetry(batch []riemann.Event) {
+	backoff := q.opts.BackoffMin
+	for {
+		err := q.sender.Send(batch)
+		if err == nil {
+			atomic.AddInt64(&q.sent, int64(len(batch)))
+			return
+		}
+
+		failed := unsent(batch, err)
+		atomic.AddInt64(&q.sent, int64(len(batch)-len(failed)))
+		batch = failed
+		atomic.AddInt64(&q.failures, 1)
+		log.Printf("Error sending %d events, retrying in %s: %s\n", len(batch), backoff, err)
+		select {
+		case <-q.done:
+			return
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+		if backoff > q.opts.BackoffMax {
+			backoff = q.opts.BackoffMax
+		}
+	}
+}
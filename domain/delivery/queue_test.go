@@ -0,0 +1,213 @@
+package delivery
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	riemann "github.com/riemann/riemann-go-client"
+)
+
+type recordSender struct {
+	mu     sync.Mutex
+	fail   bool
+	events []string
+}
+
+func (s *recordSender) Send(events []riemann.Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.fail {
+		return errors.New("send failed")
+	}
+	for _, e := range events {
+		s.events = append(s.events, e.Service)
+	}
+	return nil
+}
+
+func (s *recordSender) sent() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string{}, s.events...)
+}
+
+func TestQueueReplaysSpoolBeforeNewEvents(t *testing.T) {
+	spool := openTestSpool(t, t.TempDir(), 1<<20, 1<<30)
+	defer spool.Close()
+	// More batches than a flush interval replayed before the fix
+	want := []string{}
+	for i := 0; i < 500; i++ {
+		events := testEvents(fmt.Sprintf("spooled%d", i), 1)
+		if err := spool.Write(events); err != nil {
+			t.Fatalf("Write: %s", err)
+		}
+		want = append(want, events[0].Service)
+	}
+
+	sender := &recordSender{}
+	q := NewQueue(sender, spool, Options{
+		QueueSize:     10,
+		BatchSize:     1,
+		FlushInterval: time.Hour,
+		FullPolicy:    Block,
+		BackoffMin:    time.Millisecond,
+		BackoffMax:    time.Millisecond,
+	})
+	q.Start()
+	defer q.Close()
+
+	q.Publish(riemann.Event{Service: "new"})
+	want = append(want, "new")
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(sender.sent()) < len(want) && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := sender.sent(); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("sent %d events, want %d in order", len(got), len(want))
+	}
+	if !spool.Empty() {
+		t.Fatal("spool is not empty")
+	}
+}
+
+func TestQueueSpoolsWhileSenderFails(t *testing.T) {
+	spool := openTestSpool(t, t.TempDir(), 1<<20, 1<<30)
+	defer spool.Close()
+	sender := &recordSender{fail: true}
+	q := NewQueue(sender, spool, Options{
+		QueueSize:     10,
+		BatchSize:     1,
+		FlushInterval: 10 * time.Millisecond,
+		FullPolicy:    Block,
+		BackoffMin:    time.Millisecond,
+		BackoffMax:    time.Millisecond,
+	})
+	q.Start()
+	defer q.Close()
+
+	q.Publish(riemann.Event{Service: "a"}, riemann.Event{Service: "b"})
+	deadline := time.Now().Add(5 * time.Second)
+	for spool.Stats().Events < 2 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if events := spool.Stats().Events; events != 2 {
+		t.Fatalf("spooled events = %d, want 2", events)
+	}
+
+	sender.mu.Lock()
+	sender.fail = false
+	sender.mu.Unlock()
+	for !spool.Empty() && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if got := sender.sent(); fmt.Sprint(got) != "[a b]" {
+		t.Fatalf("sent = %v", got)
+	}
+}
+
+// partialSender fails to send the events of the services in down
+type partialSender struct {
+	recordSender
+	down map[string]bool
+}
+
+func (s *partialSender) Send(events []riemann.Event) error {
+	s.mu.Lock()
+	failed := []riemann.Event{}
+	ok := []riemann.Event{}
+	for _, e := range events {
+		if s.down[e.Service] {
+			failed = append(failed, e)
+		} else {
+			ok = append(ok, e)
+		}
+	}
+	s.mu.Unlock()
+	s.recordSender.Send(ok)
+	if len(failed) > 0 {
+		return &PartialError{Events: failed, Err: errors.New("down")}
+	}
+	return nil
+}
+
+func (s *partialSender) recover() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.down = nil
+}
+
+func TestQueueRetriesOnlyUnsentEvents(t *testing.T) {
+	tests := []struct {
+		name  string
+		spool bool
+	}{
+		{"retry", false},
+		{"spool", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var spool *Spool
+			if tt.spool {
+				spool = openTestSpool(t, t.TempDir(), 1<<20, 1<<30)
+				defer spool.Close()
+			}
+			sender := &partialSender{down: map[string]bool{"b": true}}
+			q := NewQueue(sender, spool, Options{
+				QueueSize:     10,
+				BatchSize:     3,
+				FlushInterval: 10 * time.Millisecond,
+				FullPolicy:    Block,
+				BackoffMin:    time.Millisecond,
+				BackoffMax:    time.Millisecond,
+			})
+			q.Start()
+			defer q.Close()
+
+			q.Publish(riemann.Event{Service: "a"}, riemann.Event{Service: "b"}, riemann.Event{Service: "c"})
+			deadline := time.Now().Add(5 * time.Second)
+			for len(sender.sent()) < 2 && time.Now().Before(deadline) {
+				time.Sleep(5 * time.Millisecond)
+			}
+			if tt.spool && spool.Stats().Events != 1 {
+				t.Fatalf("spooled events = %d, want 1", spool.Stats().Events)
+			}
+			sender.recover()
+			for len(sender.sent()) < 3 && time.Now().Before(deadline) {
+				time.Sleep(5 * time.Millisecond)
+			}
+			time.Sleep(20 * time.Millisecond)
+			if got := sender.sent(); fmt.Sprint(got) != "[a c b]" {
+				t.Fatalf("sent = %v, want every event once", got)
+			}
+		})
+	}
+}
+
+func TestQueueRejectsWholeBatchWhenFull(t *testing.T) {
+	q := NewQueue(&recordSender{}, nil, Options{
+		QueueSize:     3,
+		BatchSize:     10,
+		FlushInterval: time.Hour,
+		FullPolicy:    Reject,
+	})
+
+	if err := q.Publish(testEvents("first", 2)...); err != nil {
+		t.Fatalf("Publish: %s", err)
+	}
+	if err := q.Publish(testEvents("second", 2)...); err != ErrQueueFull {
+		t.Fatalf("Publish = %v, want %v", err, ErrQueueFull)
+	}
+	if stats := q.Stats(); stats.Queued != 2 || stats.Rejected != 2 {
+		t.Fatalf("queued %d and rejected %d events, want 2 and 2", stats.Queued, stats.Rejected)
+	}
+	if err := q.Publish(testEvents("third", 1)...); err != nil {
+		t.Fatalf("Publish: %s", err)
+	}
+	if stats := q.Stats(); stats.Queued != 3 {
+		t.Fatalf("queued %d events, want 3", stats.Queued)
+	}
+}
@@ -0,0 +1,409 @@
+package delivery
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	pb "github.com/golang/protobuf/proto"
+	riemann "github.com/riemann/riemann-go-client"
+	"github.com/riemann/riemann-go-client/proto"
+)
+
+// written unix nano (8 bytes), number of events (4 bytes), payload length (4 bytes)
+const recordHeaderSize = 16
+
+const cursorFile = "cursor"
+
+type SpoolOptions struct {
+	Dir            string
+	MaxSegmentSize int64
+	MaxSize        int64
+}
+
+type SpoolStats struct {
+	Events    int64   `json:"events"`
+	Bytes     int64   `json:"bytes"`
+	Segments  int     `json:"segments"`
+	Dropped   int64   `json:"dropped"`
+	OldestAge float64 `json:"oldest_age_seconds"`
+}
+
+type segment struct {
+	id     uint64
+	path   string
+	size   int64
+	events int64
+}
+
+type record struct {
+	written time.Time
+	events  []riemann.Event
+	size    int64
+	// position of the record in the spool
+	segment uint64
+	offset  int64
+}
+
+// Spool is a write-ahead log of event batches on local disk. Batches are
+// appended to segment files of at most MaxSegmentSize bytes and read back in
+// the same order. When the spool grows over MaxSize the oldest segment is
+// dropped. The read position is saved in a cursor file so the pending batches
+// survive a restart.
+type Spool struct {
+	mu       sync.Mutex
+	opts     SpoolOptions
+	segments []*segment
+	writer   *os.File
+	reader   *os.File
+	offset   int64
+	dropped  int64
+}
+
+func OpenSpool(opts SpoolOptions) (*Spool, error) {
+	if err := os.MkdirAll(opts.Dir, 0755); err != nil {
+		return nil, fmt.Errorf("Cannot create spool dir: %s", err)
+	}
+
+	s := &Spool{opts: opts}
+	cursorId, cursorOffset := s.readCursor()
+	segments, err := s.listSegments()
+	if err != nil {
+		return nil, err
+	}
+	for _, seg := range segments {
+		if seg.id < cursorId {
+			// Already replayed
+			os.Remove(seg.path)
+			continue
+		}
+		offset := int64(0)
+		if seg.id == cursorId {
+			offset = cursorOffset
+		}
+		if err := scanSegment(seg, offset); err != nil {
+			return nil, err
+		}
+		if len(s.segments) == 0 {
+			s.offset = offset
+		}
+		s.segments = append(s.segments, seg)
+	}
+
+	if len(s.segments) == 0 {
+		s.segments = append(s.segments, s.newSegment(cursorId+1))
+	}
+	if err := s.openWriter(); err != nil {
+		return nil, err
+	}
+
+	stats := s.Stats()
+	if stats.Events > 0 {
+		log.Printf("Spool %s has %d pending events\n", opts.Dir, stats.Events)
+	}
+	return s, nil
+}
+
+func (s *Spool) newSegment(id uint64) *segment {
+	return &segment{
+		id:   id,
+		path: filepath.Join(s.opts.Dir, fmt.Sprintf("segment-%020d.log", id)),
+	}
+}
+
+func (s *Spool) listSegments() ([]*segment, error) {
+	files, err := ioutil.ReadDir(s.opts.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot read spool dir: %s", err)
+	}
+
+	segments := []*segment{}
+	for _, f := range files {
+		name := f.Name()
+		if !strings.HasPrefix(name, "segment-") || !strings.HasSuffix(name, ".log") {
+			continue
+		}
+		id, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(name, "segment-"), ".log"), 10, 64)
+		if err != nil {
+			continue
+		}
+		segments = append(segments, s.newSegment(id))
+	}
+	sort.Slice(segments, func(i, j int) bool { return segments[i].id < segments[j].id })
+	return segments, nil
+}
+
+// scanSegment counts the events after offset and truncates a partially
+// written record at the end of the segment.
+func scanSegment(seg *segment, offset int64) error {
+	f, err := os.OpenFile(seg.path, os.O_RDWR, 0644)
+	if err != nil {
+		return fmt.Errorf("Cannot open spool segment: %s", err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	pos := int64(0)
+	header := make([]byte, recordHeaderSize)
+	for pos+recordHeaderSize <= info.Size() {
+		if _, err := f.ReadAt(header, pos); err != nil {
+			return err
+		}
+		size := recordHeaderSize + int64(binary.BigEndian.Uint32(header[12:16]))
+		if pos+size > info.Size() {
+			break
+		}
+		if pos >= offset {
+			seg.events += int64(binary.BigEndian.Uint32(header[8:12]))
+		}
+		pos += size
+	}
+
+	if pos != info.Size() {
+		log.Printf("Truncating spool segment %s at %d\n", seg.path, pos)
+		if err := f.Truncate(pos); err != nil {
+			return err
+		}
+	}
+	seg.size = pos
+	return nil
+}
+
+func (s *Spool) openWriter() error {
+	active := s.segments[len(s.segments)-1]
+	f, err := os.OpenFile(active.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("Cannot open spool segment: %s", err)
+	}
+	s.writer = f
+	return nil
+}
+
+func (s *Spool) readCursor() (uint64, int64) {
+	data, err := ioutil.ReadFile(filepath.Join(s.opts.Dir, cursorFile))
+	if err != nil {
+		return 0, 0
+	}
+	var id uint64
+	var offset int64
+	if _, err := fmt.Sscanf(string(data), "%d %d", &id, &offset); err != nil {
+		log.Printf("Invalid spool cursor: %s\n", err)
+		return 0, 0
+	}
+	return id, offset
+}
+
+func (s *Spool) writeCursor() error {
+	path := filepath.Join(s.opts.Dir, cursorFile)
+	data := fmt.Sprintf("%d %d", s.segments[0].id, s.offset)
+	if err := ioutil.WriteFile(path+".tmp", []byte(data), 0644); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// Write appends a batch of events to the spool
+func (s *Spool) Write(events []riemann.Event) error {
+	msg := &proto.Msg{Events: make([]*proto.Event, len(events))}
+	for i := range events {
+		e, err := riemann.EventToProtocolBuffer(&events[i])
+		if err != nil {
+			return err
+		}
+		msg.Events[i] = e
+	}
+	payload, err := pb.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	data := make([]byte, recordHeaderSize+len(payload))
+	binary.BigEndian.PutUint64(data[0:8], uint64(time.Now().UnixNano()))
+	binary.BigEndian.PutUint32(data[8:12], uint32(len(events)))
+	binary.BigEndian.PutUint32(data[12:16], uint32(len(payload)))
+	copy(data[recordHeaderSize:], payload)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	active := s.segments[len(s.segments)-1]
+	if active.size > 0 && active.size+int64(len(data)) > s.opts.MaxSegmentSize {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+		active = s.segments[len(s.segments)-1]
+	}
+
+	n, err := s.writer.Write(data)
+	if err != nil {
+		// Remove the partial record so the segment stays readable
+		s.writer.Truncate(active.size)
+		return err
+	}
+	active.size += int64(n)
+	active.events += int64(len(events))
+
+	s.enforceMaxSize()
+	return nil
+}
+
+func (s *Spool) rotate() error {
+	if err := s.writer.Close(); err != nil {
+		log.Printf("Error closing spool segment: %s\n", err)
+	}
+	active := s.segments[len(s.segments)-1]
+	s.segments = append(s.segments, s.newSegment(active.id+1))
+	return s.openWriter()
+}
+
+// enforceMaxSize drops the oldest segments until the spool fits in MaxSize.
+// The active segment is never dropped.
+func (s *Spool) enforceMaxSize() {
+	for len(s.segments) > 1 && s.size() > s.opts.MaxSize {
+		oldest := s.segments[0]
+		log.Printf("Spool is full, dropping %d events of %s\n", oldest.events, oldest.path)
+		s.dropped += oldest.events
+		s.removeOldest()
+	}
+}
+
+func (s *Spool) removeOldest() {
+	oldest := s.segments[0]
+	if s.reader != nil {
+		s.reader.Close()
+		s.reader = nil
+	}
+	os.Remove(oldest.path)
+	s.segments = s.segments[1:]
+	s.offset = 0
+	if err := s.writeCursor(); err != nil {
+		log.Printf("Error saving spool cursor: %s\n", err)
+	}
+}
+
+func (s *Spool) size() int64 {
+	size := -s.offset
+	for _, seg := range s.segments {
+		size += seg.size
+	}
+	return size
+}
+
+// Peek returns the oldest pending batch without removing it, or nil if the
+// spool is empty.
+func (s *Spool) Peek() (*record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	header, err := s.header()
+	if header == nil || err != nil {
+		return nil, err
+	}
+
+	size := binary.BigEndian.Uint32(header[12:16])
+	payload := make([]byte, size)
+	if _, err := s.reader.ReadAt(payload, s.offset+recordHeaderSize); err != nil {
+		return nil, err
+	}
+	msg := &proto.Msg{}
+	if err := pb.Unmarshal(payload, msg); err != nil {
+		return nil, err
+	}
+
+	return &record{
+		written: time.Unix(0, int64(binary.BigEndian.Uint64(header[0:8]))),
+		events:  riemann.ProtocolBuffersToEvents(msg.Events),
+		size:    recordHeaderSize + int64(size),
+		segment: s.segments[0].id,
+		offset:  s.offset,
+	}, nil
+}
+
+// header reads the header of the oldest pending record. Fully read segments
+// are removed on the way.
+func (s *Spool) header() ([]byte, error) {
+	for {
+		oldest := s.segments[0]
+		if s.offset < oldest.size {
+			break
+		}
+		if len(s.segments) == 1 {
+			return nil, nil
+		}
+		s.removeOldest()
+	}
+
+	if s.reader == nil {
+		f, err := os.Open(s.segments[0].path)
+		if err != nil {
+			return nil, err
+		}
+		s.reader = f
+	}
+
+	header := make([]byte, recordHeaderSize)
+	if _, err := s.reader.ReadAt(header, s.offset); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("Spool segment %s is corrupted", s.segments[0].path)
+		}
+		return nil, err
+	}
+	return header, nil
+}
+
+// Commit removes the batch returned by Peek
+func (s *Spool) Commit(r *record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.offset += r.size
+	s.segments[0].events -= int64(len(r.events))
+	return s.writeCursor()
+}
+
+func (s *Spool) Empty() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.size() == 0
+}
+
+func (s *Spool) Stats() SpoolStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stats := SpoolStats{
+		Bytes:    s.size(),
+		Segments: len(s.segments),
+		Dropped:  s.dropped,
+	}
+	for _, seg := range s.segments {
+		stats.Events += seg.events
+	}
+	if header, err := s.header(); header != nil && err == nil {
+		written := time.Unix(0, int64(binary.BigEndian.Uint64(header[0:8])))
+		stats.OldestAge = time.Since(written).Seconds()
+	}
+	return stats
+}
+
+func (s *Spool) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.reader != nil {
+		s.reader.Close()
+	}
+	return s.writer.Close()
+}
@@ -0,0 +1,198 @@
+package delivery
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	riemann "github.com/riemann/riemann-go-client"
+)
+
+func testEvents(service string, n int) []riemann.Event {
+	events := make([]riemann.Event, n)
+	for i := range events {
+		events[i] = riemann.Event{Service: fmt.Sprintf("%s.%d", service, i), Host: "h", Metric: int64(i)}
+	}
+	return events
+}
+
+func openTestSpool(t *testing.T, dir string, maxSegmentSize, maxSize int64) *Spool {
+	t.Helper()
+	s, err := OpenSpool(SpoolOptions{Dir: dir, MaxSegmentSize: maxSegmentSize, MaxSize: maxSize})
+	if err != nil {
+		t.Fatalf("OpenSpool: %s", err)
+	}
+	return s
+}
+
+// readAll peeks and commits every pending batch, returning their services
+func readAll(t *testing.T, s *Spool) []string {
+	t.Helper()
+	services := []string{}
+	for {
+		r, err := s.Peek()
+		if err != nil {
+			t.Fatalf("Peek: %s", err)
+		}
+		if r == nil {
+			return services
+		}
+		for _, e := range r.events {
+			services = append(services, e.Service)
+		}
+		if err := s.Commit(r); err != nil {
+			t.Fatalf("Commit: %s", err)
+		}
+	}
+}
+
+func TestSpoolOrder(t *testing.T) {
+	tests := []struct {
+		name           string
+		maxSegmentSize int64
+		batches        int
+		segments       int
+	}{
+		{"single segment", 1 << 20, 3, 1},
+		{"segment per batch", 1, 3, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := openTestSpool(t, t.TempDir(), tt.maxSegmentSize, 1<<30)
+			defer s.Close()
+			if !s.Empty() {
+				t.Fatal("new spool is not empty")
+			}
+
+			want := []string{}
+			for i := 0; i < tt.batches; i++ {
+				events := testEvents(fmt.Sprintf("b%d", i), 2)
+				if err := s.Write(events); err != nil {
+					t.Fatalf("Write: %s", err)
+				}
+				for _, e := range events {
+					want = append(want, e.Service)
+				}
+			}
+			stats := s.Stats()
+			if stats.Events != int64(len(want)) || stats.Segments != tt.segments {
+				t.Fatalf("stats = %d events %d segments, want %d events %d segments", stats.Events, stats.Segments, len(want), tt.segments)
+			}
+
+			got := readAll(t, s)
+			if fmt.Sprint(got) != fmt.Sprint(want) {
+				t.Fatalf("events = %v, want %v", got, want)
+			}
+			if !s.Empty() || s.Stats().Events != 0 {
+				t.Fatal("spool is not empty after reading every batch")
+			}
+		})
+	}
+}
+
+func TestSpoolRestart(t *testing.T) {
+	dir := t.TempDir()
+	s := openTestSpool(t, dir, 1, 1<<30)
+	for i := 0; i < 3; i++ {
+		if err := s.Write(testEvents(fmt.Sprintf("b%d", i), 1)); err != nil {
+			t.Fatalf("Write: %s", err)
+		}
+	}
+	r, err := s.Peek()
+	if err != nil || r == nil {
+		t.Fatalf("Peek = %v, %v", r, err)
+	}
+	if err := s.Commit(r); err != nil {
+		t.Fatalf("Commit: %s", err)
+	}
+	s.Close()
+
+	s = openTestSpool(t, dir, 1, 1<<30)
+	defer s.Close()
+	if events := s.Stats().Events; events != 2 {
+		t.Fatalf("pending events after restart = %d, want 2", events)
+	}
+	got := readAll(t, s)
+	if fmt.Sprint(got) != "[b1.0 b2.0]" {
+		t.Fatalf("events after restart = %v", got)
+	}
+}
+
+func TestSpoolTruncatesPartialRecord(t *testing.T) {
+	tests := []struct {
+		name    string
+		partial []byte
+	}{
+		{"partial header", []byte{0, 0, 0}},
+		{"partial payload", []byte{0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 0, 1, 0, 0, 0, 100, 1, 2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			s := openTestSpool(t, dir, 1<<20, 1<<30)
+			if err := s.Write(testEvents("ok", 2)); err != nil {
+				t.Fatalf("Write: %s", err)
+			}
+			path := s.segments[0].path
+			size := s.segments[0].size
+			s.Close()
+
+			f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+			f.Write(tt.partial)
+			f.Close()
+
+			s = openTestSpool(t, dir, 1<<20, 1<<30)
+			defer s.Close()
+			info, err := os.Stat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Size() != size {
+				t.Fatalf("segment size = %d, want %d", info.Size(), size)
+			}
+			if got := readAll(t, s); fmt.Sprint(got) != "[ok.0 ok.1]" {
+				t.Fatalf("events = %v", got)
+			}
+		})
+	}
+}
+
+func TestSpoolMaxSize(t *testing.T) {
+	s := openTestSpool(t, t.TempDir(), 1, 1)
+	defer s.Close()
+	for i := 0; i < 3; i++ {
+		if err := s.Write(testEvents(fmt.Sprintf("b%d", i), 2)); err != nil {
+			t.Fatalf("Write: %s", err)
+		}
+	}
+	stats := s.Stats()
+	if stats.Dropped != 4 || stats.Events != 2 || stats.Segments != 1 {
+		t.Fatalf("stats = %+v, want 4 dropped and 2 events in 1 segment", stats)
+	}
+	if got := readAll(t, s); fmt.Sprint(got) != "[b2.0 b2.1]" {
+		t.Fatalf("events = %v", got)
+	}
+}
+
+func TestSpoolInvalidCursor(t *testing.T) {
+	dir := t.TempDir()
+	s := openTestSpool(t, dir, 1<<20, 1<<30)
+	if err := s.Write(testEvents("ok", 1)); err != nil {
+		t.Fatalf("Write: %s", err)
+	}
+	s.Close()
+	if err := ioutil.WriteFile(filepath.Join(dir, cursorFile), []byte("invalid"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	s = openTestSpool(t, dir, 1<<20, 1<<30)
+	defer s.Close()
+	if got := readAll(t, s); fmt.Sprint(got) != "[ok.0]" {
+		t.Fatalf("events = %v", got)
+	}
+}
@@ -0,0 +1,102 @@
+package delivery
+
+import (
+	"log"
+	"sync/atomic"
+
+	pb "github.com/golang/protobuf/proto"
+	riemann "github.com/riemann/riemann-go-client"
+)
+
+// bytes added to the message for every event: field tag and length prefix
+const udpEventOverhead = 6
+
+// Publisher accepts events for delivery
+type Publisher interface {
+	Publish(events ...riemann.Event) error
+}
+
+type UDPStats struct {
+	Sent     int64 `json:"sent"`
+	Dropped  int64 `json:"dropped"`
+	Fallback int64 `json:"fallback"`
+}
+
+// UDPPublisher sends the events over UDP as soon as they are published,
+// without queueing or retrying them. Failed events are lost. The events are
+// packed in datagrams of at most riemann.MaxUDPSize bytes, the events that do
+// not fit in a datagram are published to the fallback instead.
+type UDPPublisher struct {
+	backends *Backends
+	fallback Publisher
+	sent     int64
+	dropped  int64
+	oversize int64
+}
+
+func NewUDPPublisher(backends *Backends, fallback Publisher) *UDPPublisher {
+	return &UDPPublisher{
+		backends: backends,
+		fallback: fallback,
+	}
+}
+
+func (u *UDPPublisher) Publish(events ...riemann.Event) error {
+	large := []riemann.Event{}
+	datagram := []riemann.Event{}
+	datagramSize := 0
+	for _, e := range events {
+		size, err := eventSize(e)
+		if err != nil {
+			return err
+		}
+		if size > riemann.MaxUDPSize {
+			large = append(large, e)
+			continue
+		}
+		if datagramSize+size > riemann.MaxUDPSize {
+			u.send(datagram)
+			datagram = []riemann.Event{}
+			datagramSize = 0
+		}
+		datagram = append(datagram, e)
+		datagramSize += size
+	}
+	if len(datagram) > 0 {
+		u.send(datagram)
+	}
+
+	if len(large) == 0 {
+		return nil
+	}
+	atomic.AddInt64(&u.oversize, int64(len(large)))
+	return u.fallback.Publish(large...)
+}
+
+func (u *UDPPublisher) send(events []riemann.Event) {
+	if err := u.backends.SendUDP(events); err != nil {
+		lost := unsent(events, err)
+		atomic.AddInt64(&u.sent, int64(len(events)-len(lost)))
+		atomic.AddInt64(&u.dropped, int64(len(lost)))
+		log.Printf("Error sending %d events over UDP, events lost: %s\n", len(lost), err)
+		return
+	}
+	atomic.AddInt64(&u.sent, int64(len(events)))
+}
+
+func (u *UDPPublisher) Stats() UDPStats {
+	return UDPStats{
+		Sent:     atomic.LoadInt64(&u.sent),
+		Dropped:  atomic.LoadInt64(&u.dropped),
+		Fallback: atomic.LoadInt64(&u.oversize),
+	}
+}
+
+// eventSize is the encoded size of the event inside a message
+func eventSize(e riemann.Event) (int, error) {
+	msg, err := riemann.EventToProtocolBuffer(&e)
+	if err != nil {
+		return 0, err
+	}
+	return pb.Size(msg) + udpEventOverhead, nil
+}
@@ -0,0 +1,53 @@
+package enrich
+
+import (
+	"fmt"
+	"riemannhttp/domain/asn"
+	"riemannhttp/domain/metric"
+)
+
+// ASN adds the "asn" attribute of the IP in IPAttribute
+type ASN struct {
+	Service     asn.Service
+	IPAttribute string
+}
+
+func (e *ASN) Enrich(m *metric.MetricPayload) error {
+	ip, hasIp := m.Attributes[e.IPAttribute]
+	if !hasIp {
+		return fmt.Errorf("Attribute %s not found", e.IPAttribute)
+	}
+
+	number, err := e.Service.GetASNForIP(ip)
+	if err != nil {
+		return fmt.Errorf("Error getting asn: %s", err)
+	}
+	setAttribute(m, "asn", number)
+	return nil
+}
+
+// ASNInfo adds the "asn_country" and "asn_registry" attributes of the IP in
+// IPAttribute
+type ASNInfo struct {
+	Service     asn.Service
+	IPAttribute string
+}
+
+func (e *ASNInfo) Enrich(m *metric.MetricPayload) error {
+	ip, hasIp := m.Attributes[e.IPAttribute]
+	if !hasIp {
+		return fmt.Errorf("Attribute %s not found", e.IPAttribute)
+	}
+
+	info, err := e.Service.GetInfoForIP(ip)
+	if err != nil {
+		return fmt.Errorf("Error getting asn info: %s", err)
+	}
+	if info.Country != "" {
+		setAttribute(m, "asn_country", info.Country)
+	}
+	if info.Registry != "" {
+		setAttribute(m, "asn_registry", info.Registry)
+	}
+	return nil
+}
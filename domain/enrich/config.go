@@ -0,0 +1,199 @@
+package enrich
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"riemannhttp/domain/asn"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	ASNEnricher        = "asn"
+	ASNInfoEnricher    = "asn-info"
+	GeoIPEnricher      = "geoip"
+	UserAgentEnricher  = "user-agent"
+	StaticEnricher     = "static"
+	HostRenameEnricher = "host-rename"
+)
+
+const (
+	defaultIPAttribute        = "ip"
+	defaultUserAgentAttribute = "user_agent"
+)
+
+type MatchConfig struct {
+	Services []string `yaml:"services"`
+	Hosts    []string `yaml:"hosts"`
+	Tags     []string `yaml:"tags"`
+}
+
+type EnricherConfig struct {
+	Name  string      `yaml:"name"`
+	Type  string      `yaml:"type"`
+	Match MatchConfig `yaml:"match"`
+	// asn, asn-info and geoip
+	IPAttribute string `yaml:"ip_attribute"`
+	// geoip
+	Database string `yaml:"database"`
+	// user-agent
+	Attribute string `yaml:"attribute"`
+	// static
+	Attributes map[string]string `yaml:"attributes"`
+	Override   bool              `yaml:"override"`
+	// host-rename
+	Hosts       map[string]string `yaml:"hosts"`
+	Pattern     string            `yaml:"pattern"`
+	Replacement string            `yaml:"replacement"`
+}
+
+// PipelineConfig is the content of an enrichers file
+type PipelineConfig struct {
+	Enrichers []EnricherConfig `yaml:"enrichers"`
+}
+
+// DefaultConfig adds the asn of the ip attribute to the response times of
+// the core api, as it was done before the pipeline was configurable.
+func DefaultConfig() *PipelineConfig {
+	return &PipelineConfig{
+		Enrichers: []EnricherConfig{{
+			Name:  "core-api-asn",
+			Type:  ASNEnricher,
+			Match: MatchConfig{Services: []string{"core_api.response_time"}},
+		}},
+	}
+}
+
+// Load reads the enrichers file in path and builds the pipeline. Without a
+// path the DefaultConfig is used.
+func Load(path string, asnSvc asn.Service) (*Pipeline, error) {
+	pc := DefaultConfig()
+	if path != "" {
+		var err error
+		if pc, err = ReadPipeline(path); err != nil {
+			return nil, err
+		}
+	}
+	return pc.Pipeline(asnSvc)
+}
+
+// ReadPipeline parses the enrichers file in path. Unknown fields are rejected.
+func ReadPipeline(path string) (*PipelineConfig, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot open enrichers file: %s", err)
+	}
+	defer f.Close()
+
+	pc := &PipelineConfig{}
+	decoder := yaml.NewDecoder(f)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(pc); err != nil {
+		return nil, fmt.Errorf("Invalid enrichers file %s: %s", path, err)
+	}
+	return pc, nil
+}
+
+// Pipeline validates every enricher and builds the pipeline in the same
+// order. All the validation errors are reported at once.
+func (pc *PipelineConfig) Pipeline(asnSvc asn.Service) (*Pipeline, error) {
+	var errs []string
+	pipeline := &Pipeline{}
+	names := make(map[string]bool)
+	for i, ec := range pc.Enrichers {
+		enricher, enricherErrs := ec.enricher(asnSvc)
+		name := ec.Name
+		if name == "" {
+			name = fmt.Sprintf("#%d", i)
+		} else if names[name] {
+			enricherErrs = append(enricherErrs, "duplicated name")
+		}
+		names[name] = true
+		enricherErrs = append(enricherErrs, ec.Match.validate()...)
+
+		for _, e := range enricherErrs {
+			errs = append(errs, fmt.Sprintf("enricher %s: %s", name, e))
+		}
+		if enricher != nil {
+			pipeline.Add(name, ec.Match.match(), enricher)
+		}
+	}
+
+	if len(errs) > 0 {
+		pipeline.Close()
+		return nil, fmt.Errorf("Invalid enrichers: %s", strings.Join(errs, "; "))
+	}
+	return pipeline, nil
+}
+
+func (mc MatchConfig) validate() []string {
+	var errs []string
+	for _, pattern := range append(append([]string{}, mc.Services...), mc.Hosts...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			errs = append(errs, fmt.Sprintf("invalid match pattern %q", pattern))
+		}
+	}
+	return errs
+}
+
+func (mc MatchConfig) match() Match {
+	return Match{
+		Services: mc.Services,
+		Hosts:    mc.Hosts,
+		Tags:     mc.Tags,
+	}
+}
+
+func (ec EnricherConfig) enricher(asnSvc asn.Service) (Enricher, []string) {
+	ipAttribute := ec.IPAttribute
+	if ipAttribute == "" {
+		ipAttribute = defaultIPAttribute
+	}
+
+	switch ec.Type {
+	case ASNEnricher:
+		return &ASN{Service: asnSvc, IPAttribute: ipAttribute}, nil
+	case ASNInfoEnricher:
+		return &ASNInfo{Service: asnSvc, IPAttribute: ipAttribute}, nil
+	case GeoIPEnricher:
+		if ec.Database == "" {
+			return nil, []string{"database is required"}
+		}
+		geoip, err := NewGeoIP(ec.Database, ipAttribute)
+		if err != nil {
+			return nil, []string{err.Error()}
+		}
+		return geoip, nil
+	case UserAgentEnricher:
+		attribute := ec.Attribute
+		if attribute == "" {
+			attribute = defaultUserAgentAttribute
+		}
+		return &UserAgent{Attribute: attribute}, nil
+	case StaticEnricher:
+		if len(ec.Attributes) == 0 {
+			return nil, []string{"attributes are required"}
+		}
+		return &Static{Attributes: ec.Attributes, Override: ec.Override}, nil
+	case HostRenameEnricher:
+		if len(ec.Hosts) == 0 && ec.Pattern == "" {
+			return nil, []string{"hosts or pattern is required"}
+		}
+		rename := &HostRename{Hosts: ec.Hosts, Replacement: ec.Replacement}
+		if ec.Pattern != "" {
+			pattern, err := regexp.Compile(ec.Pattern)
+			if err != nil {
+				return nil, []string{fmt.Sprintf("invalid pattern: %s", err)}
+			}
+			rename.Pattern = pattern
+		}
+		return rename, nil
+	case "":
+		return nil, []string{"type is required"}
+	default:
+		return nil, []string{fmt.Sprintf("unknown type %q", ec.Type)}
+	}
+}
@@ -0,0 +1,96 @@
+package enrich
+
+import (
+	"log"
+	"path"
+	"riemannhttp/domain/metric"
+)
+
+// Enricher adds or changes the data of a metric before it is sent
+type Enricher interface {
+	Enrich(m *metric.MetricPayload) error
+}
+
+// Match selects the metrics of an enricher. Services and hosts are glob
+// patterns, a metric must match one of them. All the tags are required. An
+// empty list matches any metric.
+type Match struct {
+	Services []string
+	Hosts    []string
+	Tags     []string
+}
+
+func (mt *Match) Matches(m *metric.MetricPayload) bool {
+	return matchAny(mt.Services, m.Service) && matchAny(mt.Hosts, m.Host) && hasTags(m.Tags, mt.Tags)
+}
+
+func matchAny(patterns []string, value string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, value); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func hasTags(tags []string, required []string) bool {
+	for _, r := range required {
+		found := false
+		for _, tag := range tags {
+			if tag == r {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+type step struct {
+	name     string
+	match    Match
+	enricher Enricher
+}
+
+// Pipeline runs its enrichers in order on every metric they match. A failed
+// enricher is logged and the next ones still run.
+type Pipeline struct {
+	steps []step
+}
+
+func (p *Pipeline) Add(name string, match Match, enricher Enricher) {
+	p.steps = append(p.steps, step{name: name, match: match, enricher: enricher})
+}
+
+func (p *Pipeline) Enrich(m *metric.MetricPayload) {
+	for _, s := range p.steps {
+		if !s.match.Matches(m) {
+			continue
+		}
+		if err := s.enricher.Enrich(m); err != nil {
+			log.Printf("Error in enricher %s: %s\n", s.name, err)
+		}
+	}
+}
+
+// Close releases the resources of the enrichers, like the GeoIP databases
+func (p *Pipeline) Close() {
+	for _, s := range p.steps {
+		if closer, ok := s.enricher.(interface{ Close() error }); ok {
+			closer.Close()
+		}
+	}
+}
+
+func setAttribute(m *metric.MetricPayload, key, value string) {
+	if m.Attributes == nil {
+		m.Attributes = make(map[string]string)
+	}
+	m.Attributes[key] = value
+}
@@ -0,0 +1,305 @@
+package enrich
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+
+	"riemannhttp/domain/asn"
+	"riemannhttp/domain/metric"
+)
+
+// fakeASN answers the asn of the ips in asns, the other ips fail
+type fakeASN struct {
+	asns  map[string]string
+	infos map[string]*asn.Info
+}
+
+func (s *fakeASN) GetASNForIP(ip string) (string, error) {
+	number, found := s.asns[ip]
+	if !found {
+		return "", errors.New("not found")
+	}
+	return number, nil
+}
+
+func (s *fakeASN) GetInfoForIP(ip string) (*asn.Info, error) {
+	info, found := s.infos[ip]
+	if !found {
+		return nil, errors.New("not found")
+	}
+	return info, nil
+}
+
+func testASN() *fakeASN {
+	return &fakeASN{
+		asns:  map[string]string{"10.0.0.1": "64500"},
+		infos: map[string]*asn.Info{"10.0.0.1": {ASN: "64500", Country: "ES", Registry: "ripencc"}, "10.0.0.2": {ASN: "64501"}},
+	}
+}
+
+func testMetric(attributes map[string]string) *metric.MetricPayload {
+	return &metric.MetricPayload{Metric: &metric.Metric{
+		Service:    "core_api.response_time",
+		Host:       "web-1.internal",
+		Tags:       []string{"api", "prod"},
+		Attributes: attributes,
+	}}
+}
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		name  string
+		match Match
+		want  bool
+	}{
+		{"empty", Match{}, true},
+		{"service glob", Match{Services: []string{"other", "core_api.*"}}, true},
+		{"other service", Match{Services: []string{"core_api"}}, false},
+		{"host glob", Match{Hosts: []string{"web-?.internal"}}, true},
+		{"other host", Match{Hosts: []string{"db-*"}}, false},
+		{"tags", Match{Tags: []string{"prod", "api"}}, true},
+		{"every tag required", Match{Tags: []string{"prod", "web"}}, false},
+		{"every field", Match{Services: []string{"core_api.*"}, Hosts: []string{"web-*"}, Tags: []string{"api"}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.match.Matches(testMetric(nil)); got != tt.want {
+				t.Fatalf("Matches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEnrichers(t *testing.T) {
+	tests := []struct {
+		name       string
+		enricher   Enricher
+		host       string
+		attributes map[string]string
+		want       map[string]string
+		wantHost   string
+		err        bool
+	}{
+		{"asn", &ASN{Service: testASN(), IPAttribute: "ip"}, "h",
+			map[string]string{"ip": "10.0.0.1"}, map[string]string{"ip": "10.0.0.1", "asn": "64500"}, "h", false},
+		{"asn other attribute", &ASN{Service: testASN(), IPAttribute: "client_ip"}, "h",
+			map[string]string{"client_ip": "10.0.0.1"}, map[string]string{"client_ip": "10.0.0.1", "asn": "64500"}, "h", false},
+		{"asn without ip", &ASN{Service: testASN(), IPAttribute: "ip"}, "h",
+			map[string]string{}, map[string]string{}, "h", true},
+		{"asn not found", &ASN{Service: testASN(), IPAttribute: "ip"}, "h",
+			map[string]string{"ip": "10.0.0.9"}, map[string]string{"ip": "10.0.0.9"}, "h", true},
+		{"asn info", &ASNInfo{Service: testASN(), IPAttribute: "ip"}, "h",
+			map[string]string{"ip": "10.0.0.1"}, map[string]string{"ip": "10.0.0.1", "asn_country": "ES", "asn_registry": "ripencc"}, "h", false},
+		{"asn info without country", &ASNInfo{Service: testASN(), IPAttribute: "ip"}, "h",
+			map[string]string{"ip": "10.0.0.2"}, map[string]string{"ip": "10.0.0.2"}, "h", false},
+		{"asn info not found", &ASNInfo{Service: testASN(), IPAttribute: "ip"}, "h",
+			map[string]string{"ip": "10.0.0.9"}, map[string]string{"ip": "10.0.0.9"}, "h", true},
+		{"user agent", &UserAgent{Attribute: "user_agent"}, "h",
+			map[string]string{"user_agent": "Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/90.0.4430.93 Safari/537.36"},
+			map[string]string{
+				"user_agent":         "Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/90.0.4430.93 Safari/537.36",
+				"ua_browser":         "Chrome",
+				"ua_browser_version": "90.0.4430.93",
+				"ua_os":              "Linux",
+				"ua_os_version":      "",
+				"ua_device":          "desktop",
+			}, "h", false},
+		{"user agent bot", &UserAgent{Attribute: "user_agent"}, "h",
+			map[string]string{"user_agent": "Googlebot/2.1 (+http://www.google.com/bot.html)"},
+			map[string]string{
+				"user_agent":         "Googlebot/2.1 (+http://www.google.com/bot.html)",
+				"ua_browser":         "Googlebot",
+				"ua_browser_version": "",
+				"ua_device":          "bot",
+			}, "h", false},
+		{"user agent missing", &UserAgent{Attribute: "user_agent"}, "h",
+			map[string]string{}, map[string]string{}, "h", true},
+		{"static", &Static{Attributes: map[string]string{"env": "prod", "dc": "mad"}}, "h",
+			map[string]string{"env": "dev"}, map[string]string{"env": "dev", "dc": "mad"}, "h", false},
+		{"static override", &Static{Attributes: map[string]string{"env": "prod", "dc": "mad"}, Override: true}, "h",
+			map[string]string{"env": "dev"}, map[string]string{"env": "prod", "dc": "mad"}, "h", false},
+		{"static without attributes", &Static{Attributes: map[string]string{"env": "prod"}}, "h",
+			nil, map[string]string{"env": "prod"}, "h", false},
+		{"host rename", &HostRename{Hosts: map[string]string{"web-1.internal": "web-1"}, Pattern: regexp.MustCompile(`\.internal$`), Replacement: ".example.com"}, "web-1.internal",
+			nil, nil, "web-1", false},
+		{"host rename pattern", &HostRename{Hosts: map[string]string{"web-1.internal": "web-1"}, Pattern: regexp.MustCompile(`\.internal$`), Replacement: ".example.com"}, "web-2.internal",
+			nil, nil, "web-2.example.com", false},
+		{"host rename groups", &HostRename{Pattern: regexp.MustCompile(`^ip-(\d+)-(\d+)$`), Replacement: "node-$1.$2"}, "ip-10-42",
+			nil, nil, "node-10.42", false},
+		{"host rename not matched", &HostRename{Hosts: map[string]string{"web-1": "web"}}, "db-1",
+			nil, nil, "db-1", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := testMetric(tt.attributes)
+			m.Host = tt.host
+			err := tt.enricher.Enrich(m)
+			if (err != nil) != tt.err {
+				t.Fatalf("Enrich() error = %v", err)
+			}
+			if !reflect.DeepEqual(m.Attributes, tt.want) {
+				t.Fatalf("attributes = %v, want %v", m.Attributes, tt.want)
+			}
+			if m.Host != tt.wantHost {
+				t.Fatalf("host = %s, want %s", m.Host, tt.wantHost)
+			}
+		})
+	}
+}
+
+// writeGeoIP writes a MaxMind database with the country ES and the city
+// Madrid for 0.0.0.0/1. The other IPs are not in the database.
+func writeGeoIP(t *testing.T) string {
+	t.Helper()
+	str := func(s string) []byte {
+		return append([]byte{0x40 | byte(len(s))}, s...)
+	}
+	uint16Of := func(v uint16) []byte {
+		return []byte{0xa0 | 2, byte(v >> 8), byte(v)}
+	}
+	join := func(parts ...[]byte) []byte {
+		var b []byte
+		for _, p := range parts {
+			b = append(b, p...)
+		}
+		return b
+	}
+
+	// One node: the left record points to the data, the right one is empty
+	tree := []byte{0, 0, 1 + 16, 0, 0, 1}
+	data := join([]byte{0xe2},
+		str("country"), []byte{0xe1}, str("iso_code"), str("ES"),
+		str("city"), []byte{0xe1}, str("names"), []byte{0xe1}, str("en"), str("Madrid"))
+	metadata := join([]byte{0xe4},
+		str("node_count"), []byte{0xc0 | 4, 0, 0, 0, 1},
+		str("record_size"), uint16Of(24),
+		str("ip_version"), uint16Of(4),
+		str("binary_format_major_version"), uint16Of(2))
+	db := join(tree, make([]byte, 16), data, []byte("\xab\xcd\xefMaxMind.com"), metadata)
+
+	path := filepath.Join(t.TempDir(), "geo.mmdb")
+	if err := ioutil.WriteFile(path, db, 0644); err != nil {
+		t.Fatalf("WriteFile: %s", err)
+	}
+	return path
+}
+
+func TestGeoIP(t *testing.T) {
+	geoip, err := NewGeoIP(writeGeoIP(t), "ip")
+	if err != nil {
+		t.Fatalf("NewGeoIP: %s", err)
+	}
+	defer geoip.Close()
+
+	tests := []struct {
+		attributes map[string]string
+		want       map[string]string
+		err        bool
+	}{
+		{map[string]string{"ip": "10.0.0.1"}, map[string]string{"ip": "10.0.0.1", "geo_country": "ES", "geo_city": "Madrid"}, false},
+		{map[string]string{"ip": "192.0.2.1"}, map[string]string{"ip": "192.0.2.1"}, false},
+		{map[string]string{"ip": "unknown"}, map[string]string{"ip": "unknown"}, true},
+		{map[string]string{}, map[string]string{}, true},
+	}
+	for _, tt := range tests {
+		m := testMetric(tt.attributes)
+		err := geoip.Enrich(m)
+		if (err != nil) != tt.err {
+			t.Errorf("Enrich(%v) error = %v", tt.attributes, err)
+		}
+		if !reflect.DeepEqual(m.Attributes, tt.want) {
+			t.Errorf("Enrich(%v) = %v, want %v", tt.attributes, m.Attributes, tt.want)
+		}
+	}
+
+	if _, err := NewGeoIP(filepath.Join(t.TempDir(), "missing.mmdb"), "ip"); err == nil {
+		t.Fatal("NewGeoIP() opened a missing database")
+	}
+}
+
+func TestPipeline(t *testing.T) {
+	p := &Pipeline{}
+	p.Add("asn", Match{Services: []string{"core_api.*"}}, &ASN{Service: testASN(), IPAttribute: "ip"})
+	p.Add("skipped", Match{Hosts: []string{"db-*"}}, &Static{Attributes: map[string]string{"skipped": "true"}})
+	p.Add("failed", Match{}, &UserAgent{Attribute: "user_agent"})
+	// Runs after the failed enricher and sees the asn of the first one
+	p.Add("static", Match{Tags: []string{"prod"}}, &Static{Attributes: map[string]string{"asn": "0", "env": "prod"}})
+
+	m := testMetric(map[string]string{"ip": "10.0.0.1"})
+	p.Enrich(m)
+	want := map[string]string{"ip": "10.0.0.1", "asn": "64500", "env": "prod"}
+	if !reflect.DeepEqual(m.Attributes, want) {
+		t.Fatalf("Enrich() = %v, want %v", m.Attributes, want)
+	}
+}
+
+func TestPipelineConfig(t *testing.T) {
+	geoip := writeGeoIP(t)
+	tests := []struct {
+		name      string
+		enrichers []EnricherConfig
+		err       string
+	}{
+		{"every type", []EnricherConfig{
+			{Name: "asn", Type: ASNEnricher},
+			{Name: "asn-info", Type: ASNInfoEnricher, IPAttribute: "client_ip"},
+			{Name: "geoip", Type: GeoIPEnricher, Database: geoip},
+			{Name: "ua", Type: UserAgentEnricher},
+			{Name: "static", Type: StaticEnricher, Attributes: map[string]string{"env": "prod"}},
+			{Name: "hosts", Type: HostRenameEnricher, Pattern: `\.internal$`},
+		}, ""},
+		{"no type", []EnricherConfig{{Name: "a"}}, "enricher a: type is required"},
+		{"unknown type", []EnricherConfig{{Name: "a", Type: "dns"}}, `enricher a: unknown type "dns"`},
+		{"duplicated name", []EnricherConfig{{Name: "a", Type: ASNEnricher}, {Name: "a", Type: ASNEnricher}}, "enricher a: duplicated name"},
+		{"no database", []EnricherConfig{{Type: GeoIPEnricher}}, "enricher #0: database is required"},
+		{"missing database", []EnricherConfig{{Type: GeoIPEnricher, Database: geoip + ".missing"}}, "Cannot open GeoIP database"},
+		{"no static attributes", []EnricherConfig{{Type: StaticEnricher}}, "attributes are required"},
+		{"no hosts", []EnricherConfig{{Type: HostRenameEnricher}}, "hosts or pattern is required"},
+		{"invalid host pattern", []EnricherConfig{{Type: HostRenameEnricher, Pattern: "("}}, "invalid pattern"},
+		{"invalid match", []EnricherConfig{{Type: ASNEnricher, Match: MatchConfig{Services: []string{"["}}}}, `invalid match pattern "["`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pc := &PipelineConfig{Enrichers: tt.enrichers}
+			pipeline, err := pc.Pipeline(testASN())
+			if tt.err == "" {
+				if err != nil {
+					t.Fatalf("Pipeline: %s", err)
+				}
+				defer pipeline.Close()
+				if len(pipeline.steps) != len(tt.enrichers) {
+					t.Fatalf("%d steps, want %d", len(pipeline.steps), len(tt.enrichers))
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("Pipeline() error = %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	pipeline, err := Load("", testASN())
+	if err != nil {
+		t.Fatalf("Load: %s", err)
+	}
+	m := testMetric(map[string]string{"ip": "10.0.0.1"})
+	pipeline.Enrich(m)
+	if m.Attributes["asn"] != "64500" {
+		t.Fatalf("the default pipeline did not add the asn: %v", m.Attributes)
+	}
+
+	path := filepath.Join(t.TempDir(), "enrichers.yaml")
+	if err := ioutil.WriteFile(path, []byte("enrichers:\n  - name: a\n    type: asn\n    ip_atribute: ip\n"), 0644); err != nil {
+		t.Fatalf("WriteFile: %s", err)
+	}
+	if _, err := Load(path, testASN()); err == nil || !strings.Contains(err.Error(), "ip_atribute") {
+		t.Fatalf("Load() error = %v, want the unknown field rejected", err)
+	}
+}
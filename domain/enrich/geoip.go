@@ -0,0 +1,60 @@
+package enrich
+
+import (
+	"fmt"
+	"net"
+	"riemannhttp/domain/metric"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+type geoRecord struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	City struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"city"`
+}
+
+// GeoIP adds the "geo_country" and "geo_city" attributes of the IP in
+// IPAttribute from a local MaxMind database (GeoLite2 Country or City).
+type GeoIP struct {
+	IPAttribute string
+	db          *maxminddb.Reader
+}
+
+func NewGeoIP(database, ipAttribute string) (*GeoIP, error) {
+	db, err := maxminddb.Open(database)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot open GeoIP database: %s", err)
+	}
+	return &GeoIP{IPAttribute: ipAttribute, db: db}, nil
+}
+
+func (e *GeoIP) Enrich(m *metric.MetricPayload) error {
+	value, hasIp := m.Attributes[e.IPAttribute]
+	if !hasIp {
+		return fmt.Errorf("Attribute %s not found", e.IPAttribute)
+	}
+	ip := net.ParseIP(value)
+	if ip == nil {
+		return fmt.Errorf("Invalid IP %q", value)
+	}
+
+	record := geoRecord{}
+	if err := e.db.Lookup(ip, &record); err != nil {
+		return fmt.Errorf("Error looking up %s: %s", value, err)
+	}
+	if record.Country.ISOCode != "" {
+		setAttribute(m, "geo_country", record.Country.ISOCode)
+	}
+	if city := record.City.Names["en"]; city != "" {
+		setAttribute(m, "geo_city", city)
+	}
+	return nil
+}
+
+func (e *GeoIP) Close() error {
+	return e.db.Close()
+}
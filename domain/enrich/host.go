@@ -0,0 +1,25 @@
+package enrich
+
+import (
+	"regexp"
+	"riemannhttp/domain/metric"
+)
+
+// HostRename replaces the host of the metric. Hosts maps exact names, the
+// pattern is used for the hosts not in the map.
+type HostRename struct {
+	Hosts       map[string]string
+	Pattern     *regexp.Regexp
+	Replacement string
+}
+
+func (e *HostRename) Enrich(m *metric.MetricPayload) error {
+	if host, found := e.Hosts[m.Host]; found {
+		m.Host = host
+		return nil
+	}
+	if e.Pattern != nil {
+		m.Host = e.Pattern.ReplaceAllString(m.Host, e.Replacement)
+	}
+	return nil
+}
@@ -0,0 +1,20 @@
+package enrich
+
+import "riemannhttp/domain/metric"
+
+// Static adds fixed attributes. Attributes sent by the client are kept
+// unless Override is set.
+type Static struct {
+	Attributes map[string]string
+	Override   bool
+}
+
+func (e *Static) Enrich(m *metric.MetricPayload) error {
+	for key, value := range e.Attributes {
+		if _, exists := m.Attributes[key]; exists && !e.Override {
+			continue
+		}
+		setAttribute(m, key, value)
+	}
+	return nil
+}
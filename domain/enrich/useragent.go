@@ -0,0 +1,41 @@
+package enrich
+
+import (
+	"fmt"
+	"riemannhttp/domain/metric"
+
+	"github.com/mssola/user_agent"
+)
+
+// UserAgent parses the user agent in Attribute and adds the "ua_browser",
+// "ua_browser_version", "ua_os", "ua_os_version" and "ua_device" attributes.
+// The device is bot, mobile or desktop.
+type UserAgent struct {
+	Attribute string
+}
+
+func (e *UserAgent) Enrich(m *metric.MetricPayload) error {
+	value, hasUserAgent := m.Attributes[e.Attribute]
+	if !hasUserAgent {
+		return fmt.Errorf("Attribute %s not found", e.Attribute)
+	}
+
+	ua := user_agent.New(value)
+	browser, version := ua.Browser()
+	setAttribute(m, "ua_browser", browser)
+	setAttribute(m, "ua_browser_version", version)
+	if os := ua.OSInfo(); os.Name != "" {
+		setAttribute(m, "ua_os", os.Name)
+		setAttribute(m, "ua_os_version", os.Version)
+	}
+
+	switch {
+	case ua.Bot():
+		setAttribute(m, "ua_device", "bot")
+	case ua.Mobile():
+		setAttribute(m, "ua_device", "mobile")
+	default:
+		setAttribute(m, "ua_device", "desktop")
+	}
+	return nil
+}
@@ -0,0 +1,229 @@
+package graphite
+
+import (
+	"bufio"
+	"log"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"riemannhttp/domain/metric"
+)
+
+const (
+	batchSize     = 500
+	flushInterval = time.Second
+	queueSize     = 10000
+)
+
+type Options struct {
+	// Address of the TCP listener, e.g. :2003
+	Address string
+	// Host of the metrics without a host tag, the hostname if empty
+	Host string
+	// ReadTimeout closes the connections without a line in that time, 0
+	// waits forever
+	ReadTimeout time.Duration
+	// MaxConnections refuses the connections over it, 0 is unlimited
+	MaxConnections int
+}
+
+// Listener receives Graphite plaintext lines over TCP and sends them through
+// the metric service in batches.
+type Listener struct {
+	opts    Options
+	svc     metric.Service
+	limits  *metric.Limits
+	metrics chan *metric.MetricPayload
+
+	listener net.Listener
+	mu       sync.Mutex
+	conns    map[net.Conn]struct{}
+	invalid  int
+	rejected int
+	refused  int
+	done     chan struct{}
+	connWg   sync.WaitGroup
+	wg       sync.WaitGroup
+	stopOnce sync.Once
+}
+
+func NewListener(svc metric.Service, limits *metric.Limits, opts Options) *Listener {
+	if opts.Host == "" {
+		opts.Host, _ = os.Hostname()
+	}
+	return &Listener{
+		opts:    opts,
+		svc:     svc,
+		limits:  limits,
+		metrics: make(chan *metric.MetricPayload, queueSize),
+		conns:   make(map[net.Conn]struct{}),
+		done:    make(chan struct{}),
+	}
+}
+
+// Start listens on the address and starts sending the received metrics
+func (l *Listener) Start() error {
+	listener, err := net.Listen("tcp", l.opts.Address)
+	if err != nil {
+		return err
+	}
+	l.listener = listener
+	log.Printf("Graphite listening on %s", listener.Addr())
+
+	l.wg.Add(2)
+	go l.accept()
+	go l.send()
+	return nil
+}
+
+func (l *Listener) accept() {
+	defer l.wg.Done()
+	for {
+		conn, err := l.listener.Accept()
+		if err != nil {
+			select {
+			case <-l.done:
+				return
+			default:
+			}
+			log.Printf("Error accepting graphite connection: %s", err)
+			time.Sleep(100 * time.Millisecond)
+			continue
+		}
+
+		// the connections accepted while stopping or over the limit are not read
+		l.mu.Lock()
+		select {
+		case <-l.done:
+			conn.Close()
+		default:
+			if l.opts.MaxConnections > 0 && len(l.conns) >= l.opts.MaxConnections {
+				l.refused++
+				conn.Close()
+				break
+			}
+			l.conns[conn] = struct{}{}
+			l.connWg.Add(1)
+			go l.read(conn)
+		}
+		l.mu.Unlock()
+	}
+}
+
+// read parses every line of the connection, the invalid and rejected lines
+// are counted and reported on the next flush. The connection is closed when
+// no line is received in the read timeout.
+func (l *Listener) read(conn net.Conn) {
+	defer l.connWg.Done()
+	defer func() {
+		l.mu.Lock()
+		delete(l.conns, conn)
+		l.mu.Unlock()
+		conn.Close()
+	}()
+
+	scanner := bufio.NewScanner(conn)
+	for l.deadline(conn) && scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		m, err := ParseLine(scanner.Text(), l.opts.Host, time.Now())
+		if err != nil {
+			l.count(&l.invalid)
+			continue
+		}
+		err = l.limits.Validate(m)
+		if err == nil {
+			err = l.svc.Prepare(m)
+		}
+		if err != nil {
+			l.count(&l.rejected)
+			continue
+		}
+		l.metrics <- m
+	}
+}
+
+// deadline sets the read deadline of the next line, it returns false if the
+// connection can not be read
+func (l *Listener) deadline(conn net.Conn) bool {
+	if l.opts.ReadTimeout <= 0 {
+		return true
+	}
+	return conn.SetReadDeadline(time.Now().Add(l.opts.ReadTimeout)) == nil
+}
+
+func (l *Listener) count(counter *int) {
+	l.mu.Lock()
+	*counter++
+	l.mu.Unlock()
+}
+
+// send collects the metrics in batches, sent when they are full or every
+// flush interval
+func (l *Listener) send() {
+	defer l.wg.Done()
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	batch := []*metric.MetricPayload{}
+	for {
+		select {
+		case m, ok := <-l.metrics:
+			if !ok {
+				l.flush(batch)
+				return
+			}
+			if batch = append(batch, m); len(batch) >= batchSize {
+				l.flush(batch)
+				batch = []*metric.MetricPayload{}
+			}
+		case <-ticker.C:
+			l.flush(batch)
+			batch = []*metric.MetricPayload{}
+		}
+	}
+}
+
+func (l *Listener) flush(batch []*metric.MetricPayload) {
+	l.mu.Lock()
+	invalid, rejected, refused := l.invalid, l.rejected, l.refused
+	l.invalid, l.rejected, l.refused = 0, 0, 0
+	l.mu.Unlock()
+	if invalid > 0 || rejected > 0 {
+		log.Printf("graphite lines, invalid: %d rejected: %d", invalid, rejected)
+	}
+	if refused > 0 {
+		log.Printf("graphite connections refused over the limit: %d", refused)
+	}
+
+	if len(batch) == 0 {
+		return
+	}
+	if err := l.svc.SendBatch(batch); err != nil {
+		log.Printf("Error sending graphite metrics: %s", err)
+	}
+}
+
+// Stop closes the listener and the connections and sends the received
+// metrics
+func (l *Listener) Stop() {
+	l.stopOnce.Do(func() {
+		close(l.done)
+		if l.listener == nil {
+			return
+		}
+		l.listener.Close()
+		l.mu.Lock()
+		for conn := range l.conns {
+			conn.Close()
+		}
+		l.mu.Unlock()
+
+		l.connWg.Wait()
+		close(l.metrics)
+	})
+	l.wg.Wait()
+}
@@ -0,0 +1,177 @@
+package graphite
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"riemannhttp/domain/metric"
+)
+
+type testService struct {
+	mu       sync.Mutex
+	services []string
+}
+
+func (s *testService) Prepare(m *metric.MetricPayload) error {
+	if m.Service == "rejected" {
+		return errors.New("rejected")
+	}
+	return nil
+}
+
+func (s *testService) Send(m *metric.MetricPayload) error {
+	return s.SendBatch([]*metric.MetricPayload{m})
+}
+
+func (s *testService) SendBatch(metrics []*metric.MetricPayload) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, m := range metrics {
+		s.services = append(s.services, m.Service)
+	}
+	return nil
+}
+
+// syncBuffer is the log output written by the listener goroutines
+type syncBuffer struct {
+	mu sync.Mutex
+	b  bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.b.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.b.String()
+}
+
+func startListener(t *testing.T, svc metric.Service, opts Options) *Listener {
+	t.Helper()
+	opts.Address = "127.0.0.1:0"
+	opts.Host = "default"
+	l := NewListener(svc, &metric.Limits{}, opts)
+	if err := l.Start(); err != nil {
+		t.Fatalf("Start: %s", err)
+	}
+	return l
+}
+
+func dial(t *testing.T, l *Listener) net.Conn {
+	t.Helper()
+	conn, err := net.Dial("tcp", l.listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial: %s", err)
+	}
+	return conn
+}
+
+// waitConns waits until the listener has n open connections
+func waitConns(t *testing.T, l *Listener, n int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for {
+		l.mu.Lock()
+		open := len(l.conns)
+		l.mu.Unlock()
+		if open == n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d open connections, want %d", open, n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// closedByServer reports whether the server closes the connection before
+// the timeout
+func closedByServer(conn net.Conn, timeout time.Duration) bool {
+	conn.SetReadDeadline(time.Now().Add(timeout))
+	_, err := conn.Read(make([]byte, 1))
+	return err == io.EOF
+}
+
+func TestListenerLines(t *testing.T) {
+	var logs syncBuffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	svc := &testService{}
+	l := startListener(t, svc, Options{ReadTimeout: time.Minute})
+	conn := dial(t, l)
+	waitConns(t, l, 1)
+	fmt.Fprint(conn, "a 1\n\ninvalid\nrejected 1\nrejected 2\nb 2\n")
+	conn.Close()
+	waitConns(t, l, 0)
+	l.Stop()
+
+	if strings.Join(svc.services, ",") != "a,b" {
+		t.Fatalf("sent %v, want a and b", svc.services)
+	}
+	if out := logs.String(); !strings.Contains(out, "invalid: 1 rejected: 2") || strings.Contains(out, "rejected: rejected") {
+		t.Fatalf("the rejected lines are not only counted:\n%s", out)
+	}
+}
+
+func TestListenerReadTimeout(t *testing.T) {
+	l := startListener(t, &testService{}, Options{ReadTimeout: 50 * time.Millisecond})
+	defer l.Stop()
+
+	idle := dial(t, l)
+	defer idle.Close()
+	if !closedByServer(idle, time.Second) {
+		t.Fatal("the idle connection was not closed")
+	}
+
+	// Every line extends the deadline
+	active := dial(t, l)
+	defer active.Close()
+	for i := 0; i < 4; i++ {
+		time.Sleep(30 * time.Millisecond)
+		if _, err := fmt.Fprintf(active, "a %d\n", i); err != nil {
+			t.Fatalf("the active connection was closed: %s", err)
+		}
+	}
+	waitConns(t, l, 1)
+}
+
+func TestListenerMaxConnections(t *testing.T) {
+	var logs syncBuffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	l := startListener(t, &testService{}, Options{ReadTimeout: time.Minute, MaxConnections: 1})
+	first := dial(t, l)
+	waitConns(t, l, 1)
+
+	refused := dial(t, l)
+	defer refused.Close()
+	if !closedByServer(refused, time.Second) {
+		t.Fatal("the connection over the limit was not closed")
+	}
+
+	first.Close()
+	waitConns(t, l, 0)
+	accepted := dial(t, l)
+	defer accepted.Close()
+	waitConns(t, l, 1)
+	l.Stop()
+
+	if !strings.Contains(logs.String(), "refused over the limit: 1") {
+		t.Fatalf("the refused connection was not counted:\n%s", logs.String())
+	}
+}
@@ -0,0 +1,62 @@
+package graphite
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"riemannhttp/domain/metric"
+)
+
+// ParseLine parses a plaintext line: path value timestamp. The path can have
+// tags, path;tag=value;tag2=value2. The timestamp is in Unix seconds, -1 or
+// a missing timestamp is the current time.
+func ParseLine(line string, host string, now time.Time) (*metric.MetricPayload, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 2 || len(fields) > 3 {
+		return nil, fmt.Errorf("invalid line %q, path value timestamp is required", line)
+	}
+
+	parts := strings.Split(fields[0], ";")
+	m := &metric.Metric{
+		Service:     parts[0],
+		Description: "Graphite metric",
+		Host:        host,
+		Time:        &metric.Timestamp{Time: now},
+	}
+	if m.Service == "" {
+		return nil, fmt.Errorf("invalid line %q, the path is required", line)
+	}
+	for _, tag := range parts[1:] {
+		sep := strings.IndexByte(tag, '=')
+		if sep <= 0 {
+			return nil, fmt.Errorf("invalid tag %q in %q", tag, line)
+		}
+		if tag[:sep] == "host" {
+			m.Host = tag[sep+1:]
+			continue
+		}
+		if m.Attributes == nil {
+			m.Attributes = make(map[string]string)
+		}
+		m.Attributes[tag[:sep]] = tag[sep+1:]
+	}
+
+	value, err := strconv.ParseFloat(fields[1], 64)
+	if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+		return nil, fmt.Errorf("invalid value %q in %q", fields[1], line)
+	}
+	m.Metric = metric.FloatValue(value)
+
+	if len(fields) == 3 && fields[2] != "-1" {
+		seconds, err := strconv.ParseFloat(fields[2], 64)
+		if err != nil || math.IsNaN(seconds) || math.IsInf(seconds, 0) {
+			return nil, fmt.Errorf("invalid timestamp %q in %q", fields[2], line)
+		}
+		whole, frac := math.Modf(seconds)
+		m.Time = &metric.Timestamp{Time: time.Unix(int64(whole), int64(frac*1e9))}
+	}
+	return &metric.MetricPayload{Metric: m}, nil
+}
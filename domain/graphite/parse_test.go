@@ -0,0 +1,56 @@
+package graphite
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseLine(t *testing.T) {
+	now := time.Unix(1622541600, 0)
+	tests := []struct {
+		line    string
+		service string
+		value   float64
+		host    string
+		attrs   map[string]string
+		time    time.Time
+		err     bool
+	}{
+		{"servers.web1.cpu 1.5 1622541000", "servers.web1.cpu", 1.5, "default", nil, time.Unix(1622541000, 0), false},
+		{"cpu 2", "cpu", 2, "default", nil, now, false},
+		{"cpu 2 -1", "cpu", 2, "default", nil, now, false},
+		{"cpu 2 1622541000.5", "cpu", 2, "default", nil, time.Unix(1622541000, 5e8), false},
+		{"cpu;host=web1;dc=eu 3 1622541000", "cpu", 3, "web1", map[string]string{"dc": "eu"}, time.Unix(1622541000, 0), false},
+		{"  cpu\t4  ", "cpu", 4, "default", nil, now, false},
+		{"cpu", "", 0, "", nil, time.Time{}, true},
+		{"cpu 1 2 3", "", 0, "", nil, time.Time{}, true},
+		{";host=a 1", "", 0, "", nil, time.Time{}, true},
+		{"cpu;host 1", "", 0, "", nil, time.Time{}, true},
+		{"cpu;=a 1", "", 0, "", nil, time.Time{}, true},
+		{"cpu x", "", 0, "", nil, time.Time{}, true},
+		{"cpu NaN", "", 0, "", nil, time.Time{}, true},
+		{"cpu 1 now", "", 0, "", nil, time.Time{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			m, err := ParseLine(tt.line, "default", now)
+			if (err != nil) != tt.err {
+				t.Fatalf("err = %v", err)
+			}
+			if err != nil {
+				return
+			}
+			if m.Service != tt.service || m.Metric.Metric.Float64() != tt.value || m.Host != tt.host || !m.Time.Equal(tt.time) {
+				t.Fatalf("metric = %+v", m.Metric)
+			}
+			if len(m.Attributes) != len(tt.attrs) {
+				t.Fatalf("attributes = %v, want %v", m.Attributes, tt.attrs)
+			}
+			for k, v := range tt.attrs {
+				if m.Attributes[k] != v {
+					t.Fatalf("attributes = %v, want %v", m.Attributes, tt.attrs)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,133 @@
+package influx
+
+import (
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"riemannhttp/domain/metric"
+
+	"github.com/go-chi/render"
+)
+
+const (
+	maxBodySize = 16 << 20
+	// maxDecodedSize limits the uncompressed body
+	maxDecodedSize = 64 << 20
+	// maxMetrics of a request, every line has usually several fields so it
+	// is higher than the limit of POST /metrics
+	maxMetrics = 50000
+)
+
+var (
+	errBodyTooLarge   = fmt.Errorf("The request body is larger than %d bytes", maxBodySize)
+	errTooLarge       = fmt.Errorf("The uncompressed request is larger than %d bytes", maxDecodedSize)
+	errTooManyMetrics = fmt.Errorf("The request exceeds %d metrics", maxMetrics)
+)
+
+type HttpTransport interface {
+	Write(w http.ResponseWriter, r *http.Request)
+}
+
+type httpTransport struct {
+	svc    metric.Service
+	limits *metric.Limits
+	host   string
+}
+
+// NewHTTP creates the write endpoint, the metrics without a host tag get the
+// host, the hostname if empty
+func NewHTTP(svc metric.Service, limits *metric.Limits, host string) HttpTransport {
+	if host == "" {
+		host, _ = os.Hostname()
+	}
+	return &httpTransport{
+		svc:    svc,
+		limits: limits,
+		host:   host,
+	}
+}
+
+// Write receives the line protocol like the InfluxDB 1.x write endpoint. The
+// accepted lines are sent even if others are rejected.
+func (h httpTransport) Write(w http.ResponseWriter, r *http.Request) {
+	log.Print("influx write received")
+	precision, ok := Precisions[r.URL.Query().Get("precision")]
+	if !ok {
+		render.Render(w, r, metric.ErrInvalidRequest(fmt.Errorf("Invalid precision %q", r.URL.Query().Get("precision"))))
+		return
+	}
+
+	var body io.Reader = metric.LimitReader(r.Body, maxBodySize, errBodyTooLarge)
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		gz, err := gzip.NewReader(body)
+		if err != nil {
+			render.Render(w, r, metric.ErrInvalidRequest(fmt.Errorf("Invalid gzip data: %s", err)))
+			return
+		}
+		defer gz.Close()
+		body = gz
+	}
+
+	total := 0
+	converted := 0
+	var rejected []error
+	metrics := []*metric.MetricPayload{}
+	scanner := bufio.NewScanner(metric.LimitReader(body, maxDecodedSize, errTooLarge))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		total++
+		p, err := ParseLine(line, precision)
+		if err != nil {
+			rejected = append(rejected, err)
+			continue
+		}
+
+		points := p.Metrics(h.host)
+		if converted += len(points); converted > maxMetrics {
+			render.Render(w, r, metric.ErrTooLarge(errTooManyMetrics))
+			return
+		}
+		for _, m := range points {
+			err := h.limits.Validate(m)
+			if err == nil {
+				err = h.svc.Prepare(m)
+			}
+			if err != nil {
+				rejected = append(rejected, fmt.Errorf("%s: %s", m.Service, err))
+				continue
+			}
+			metrics = append(metrics, m)
+		}
+	}
+	if err := scanner.Err(); errors.Is(err, errTooLarge) || errors.Is(err, errBodyTooLarge) {
+		render.Render(w, r, metric.ErrTooLarge(err))
+		return
+	} else if err != nil {
+		render.Render(w, r, metric.ErrInvalidRequest(fmt.Errorf("Cannot read the request: %s", err)))
+		return
+	}
+
+	if err := h.svc.SendBatch(metrics); err != nil {
+		render.Render(w, r, metric.ErrSendError(err))
+		log.Printf("Error sending influx metrics: %s", err)
+		return
+	}
+
+	log.Printf("influx write queued, lines: %d metrics: %d rejected: %d", total, len(metrics), len(rejected))
+	if len(rejected) > 0 {
+		render.Render(w, r, metric.ErrInvalidRequest(fmt.Errorf("partial write, %d rejected, %s", len(rejected), rejected[0])))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,86 @@
+package influx
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"riemannhttp/domain/metric"
+)
+
+type testService struct {
+	sent int
+}
+
+func (s *testService) Prepare(m *metric.MetricPayload) error {
+	return nil
+}
+
+func (s *testService) Send(m *metric.MetricPayload) error {
+	return s.SendBatch([]*metric.MetricPayload{m})
+}
+
+func (s *testService) SendBatch(metrics []*metric.MetricPayload) error {
+	s.sent += len(metrics)
+	return nil
+}
+
+func gzipData(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var b bytes.Buffer
+	gz := gzip.NewWriter(&b)
+	if _, err := gz.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	gz.Close()
+	return b.Bytes()
+}
+
+func TestWrite(t *testing.T) {
+	var many strings.Builder
+	for i := 0; i <= maxMetrics/2; i++ {
+		fmt.Fprintf(&many, "cpu,host=h user=%d,system=%d\n", i, i)
+	}
+	// Compresses to a few KB, but is larger than maxDecodedSize
+	huge := bytes.Repeat([]byte("# comment\n"), maxDecodedSize/10+1)
+
+	tests := []struct {
+		name   string
+		body   []byte
+		gzip   bool
+		query  string
+		status int
+		sent   int
+	}{
+		{"lines", []byte("cpu,host=h user=1,system=2 1622541600000000000\nmem value=3i\n"), false, "", 204, 3},
+		{"gzip", gzipData(t, []byte("cpu value=1\n")), true, "", 204, 1},
+		{"partial", []byte("cpu value=1\ncpu value=\n"), false, "", 400, 1},
+		{"precision", []byte("cpu value=1 1622541600\n"), false, "?precision=s", 204, 1},
+		{"invalid precision", []byte("cpu value=1\n"), false, "?precision=x", 400, 0},
+		{"invalid gzip", []byte("cpu value=1\n"), true, "", 400, 0},
+		{"too many metrics", []byte(many.String()), false, "", 413, 0},
+		{"decoded body too large", gzipData(t, huge), true, "", 413, 0},
+		{"body too large", bytes.Repeat([]byte("#\n"), maxBodySize/2+1), false, "", 413, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := &testService{}
+			h := NewHTTP(svc, &metric.Limits{}, "default")
+			r := httptest.NewRequest("POST", "/influx/write"+tt.query, bytes.NewReader(tt.body))
+			if tt.gzip {
+				r.Header.Set("Content-Encoding", "gzip")
+			}
+			w := httptest.NewRecorder()
+			h.Write(w, r)
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			if svc.sent != tt.sent {
+				t.Fatalf("sent %d metrics, want %d", svc.sent, tt.sent)
+			}
+		})
+	}
+}
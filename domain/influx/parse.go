@@ -0,0 +1,211 @@
+package influx
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"riemannhttp/domain/metric"
+)
+
+// Point is a line of the line protocol:
+// measurement,tag=value field=value,field2=value2 timestamp
+type Point struct {
+	Measurement string
+	Tags        map[string]string
+	Fields      []Field
+	// Time is nil without timestamp
+	Time *time.Time
+}
+
+// Field has a numeric value, the booleans are 1 or 0. The string fields are
+// kept without value.
+type Field struct {
+	Key   string
+	Value *metric.Value
+}
+
+// Precisions of the timestamps in the precision parameter
+var Precisions = map[string]time.Duration{
+	"":   time.Nanosecond,
+	"n":  time.Nanosecond,
+	"ns": time.Nanosecond,
+	"u":  time.Microsecond,
+	"us": time.Microsecond,
+	"ms": time.Millisecond,
+	"s":  time.Second,
+	"m":  time.Minute,
+	"h":  time.Hour,
+}
+
+// ParseLine parses a line with the timestamps in precision units
+func ParseLine(line string, precision time.Duration) (*Point, error) {
+	p := &Point{Tags: make(map[string]string)}
+	var i int
+	p.Measurement, i = readToken(line, 0, ", ")
+	if p.Measurement == "" {
+		return nil, fmt.Errorf("invalid line %q, the measurement is required", line)
+	}
+
+	for i < len(line) && line[i] == ',' {
+		var key, value string
+		key, i = readToken(line, i+1, "=, ")
+		if i >= len(line) || line[i] != '=' || key == "" {
+			return nil, fmt.Errorf("invalid tag in %q", line)
+		}
+		value, i = readToken(line, i+1, ", ")
+		p.Tags[key] = value
+	}
+
+	i = skipSpaces(line, i)
+	for {
+		var key string
+		key, i = readToken(line, i, "=, ")
+		if i >= len(line) || line[i] != '=' || key == "" {
+			return nil, fmt.Errorf("invalid field in %q", line)
+		}
+		field := Field{Key: key}
+		var err error
+		field.Value, i, err = readValue(line, i+1)
+		if err != nil {
+			return nil, fmt.Errorf("invalid field %s in %q: %s", key, line, err)
+		}
+		p.Fields = append(p.Fields, field)
+		if i >= len(line) || line[i] != ',' {
+			break
+		}
+		i++
+	}
+
+	if rest := strings.TrimSpace(line[i:]); rest != "" {
+		ts, err := strconv.ParseInt(rest, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timestamp %q in %q", rest, line)
+		}
+		t := time.Unix(0, ts*int64(precision))
+		p.Time = &t
+	}
+	return p, nil
+}
+
+// readToken reads until one of the stop characters, the escaped characters
+// are unescaped
+func readToken(line string, i int, stops string) (string, int) {
+	var b strings.Builder
+	for ; i < len(line); i++ {
+		c := line[i]
+		if c == '\\' && i+1 < len(line) && strings.IndexByte(`,= \"`, line[i+1]) >= 0 {
+			i++
+			b.WriteByte(line[i])
+			continue
+		}
+		if strings.IndexByte(stops, c) >= 0 {
+			break
+		}
+		b.WriteByte(c)
+	}
+	return b.String(), i
+}
+
+func skipSpaces(line string, i int) int {
+	for i < len(line) && line[i] == ' ' {
+		i++
+	}
+	return i
+}
+
+// readValue reads a field value, the value of the strings is nil
+func readValue(line string, i int) (*metric.Value, int, error) {
+	if i < len(line) && line[i] == '"' {
+		for i++; i < len(line); i++ {
+			if line[i] == '\\' {
+				i++
+				continue
+			}
+			if line[i] == '"' {
+				return nil, i + 1, nil
+			}
+		}
+		return nil, i, fmt.Errorf("unterminated string")
+	}
+
+	start := i
+	for i < len(line) && line[i] != ',' && line[i] != ' ' {
+		i++
+	}
+	raw := line[start:i]
+	switch raw {
+	case "t", "T", "true", "True", "TRUE":
+		return metric.IntValue(1), i, nil
+	case "f", "F", "false", "False", "FALSE":
+		return metric.IntValue(0), i, nil
+	case "":
+		return nil, i, fmt.Errorf("the value is required")
+	}
+
+	switch raw[len(raw)-1] {
+	case 'i':
+		v, err := strconv.ParseInt(raw[:len(raw)-1], 10, 64)
+		if err != nil {
+			return nil, i, fmt.Errorf("invalid integer %q", raw)
+		}
+		return metric.IntValue(v), i, nil
+	case 'u':
+		v, err := strconv.ParseUint(raw[:len(raw)-1], 10, 64)
+		if err != nil || v > math.MaxInt64 {
+			return nil, i, fmt.Errorf("invalid unsigned integer %q", raw)
+		}
+		return metric.IntValue(int64(v)), i, nil
+	}
+	v, err := strconv.ParseFloat(raw, 64)
+	if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+		return nil, i, fmt.Errorf("invalid float %q", raw)
+	}
+	return metric.FloatValue(v), i, nil
+}
+
+// Metrics returns a metric for every numeric field. The service is the
+// measurement followed by the field name, the value field is the
+// measurement. The host tag is the host and the rest of the tags are
+// attributes.
+func (p *Point) Metrics(host string) []*metric.MetricPayload {
+	attributes := make(map[string]string, len(p.Tags))
+	for k, v := range p.Tags {
+		if k == "host" {
+			host = v
+			continue
+		}
+		attributes[k] = v
+	}
+
+	metrics := []*metric.MetricPayload{}
+	for _, field := range p.Fields {
+		if field.Value == nil {
+			continue
+		}
+		service := p.Measurement + "." + field.Key
+		if field.Key == "value" {
+			service = p.Measurement
+		}
+
+		// every metric gets its own attributes, they can be changed later
+		attrs := make(map[string]string, len(attributes))
+		for k, v := range attributes {
+			attrs[k] = v
+		}
+		m := &metric.Metric{
+			Service:     service,
+			Description: "InfluxDB line protocol",
+			Metric:      field.Value,
+			Host:        host,
+			Attributes:  attrs,
+		}
+		if p.Time != nil {
+			m.Time = &metric.Timestamp{Time: *p.Time}
+		}
+		metrics = append(metrics, &metric.MetricPayload{Metric: m})
+	}
+	return metrics
+}
@@ -0,0 +1,78 @@
+package influx
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseLine(t *testing.T) {
+	ts := time.Unix(1622541600, 0)
+	tests := []struct {
+		line  string
+		want  map[string]float64
+		host  string
+		attrs map[string]string
+		time  *time.Time
+		err   bool
+	}{
+		{"cpu value=1", map[string]float64{"cpu": 1}, "default", map[string]string{}, nil, false},
+		{"cpu,host=web1,region=eu user=1.5,system=2i 1622541600000000000", map[string]float64{"cpu.user": 1.5, "cpu.system": 2}, "web1", map[string]string{"region": "eu"}, &ts, false},
+		{"disk free=3u,ok=t,failed=FALSE,name=\"sda, 1\"", map[string]float64{"disk.free": 3, "disk.ok": 1, "disk.failed": 0}, "default", map[string]string{}, nil, false},
+		{`my\ cpu,dc=a\,b load\=1=4`, map[string]float64{"my cpu.load=1": 4}, "default", map[string]string{"dc": "a,b"}, nil, false},
+		{"cpu  value=1   1622541600000000000", map[string]float64{"cpu": 1}, "default", map[string]string{}, &ts, false},
+		{"", nil, "", nil, nil, true},
+		{"cpu", nil, "", nil, nil, true},
+		{"cpu,host value=1", nil, "", nil, nil, true},
+		{"cpu value=", nil, "", nil, nil, true},
+		{"cpu value=1x", nil, "", nil, nil, true},
+		{"cpu value=1.5i", nil, "", nil, nil, true},
+		{"cpu value=-1u", nil, "", nil, nil, true},
+		{"cpu value=NaN", nil, "", nil, nil, true},
+		{`cpu name="open`, nil, "", nil, nil, true},
+		{"cpu value=1 yesterday", nil, "", nil, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			p, err := ParseLine(tt.line, time.Nanosecond)
+			if (err != nil) != tt.err {
+				t.Fatalf("err = %v", err)
+			}
+			if err != nil {
+				return
+			}
+			if (p.Time == nil) != (tt.time == nil) || (p.Time != nil && !p.Time.Equal(*tt.time)) {
+				t.Fatalf("time = %v, want %v", p.Time, tt.time)
+			}
+			metrics := p.Metrics("default")
+			if len(metrics) != len(tt.want) {
+				t.Fatalf("%d metrics, want %d", len(metrics), len(tt.want))
+			}
+			for _, m := range metrics {
+				want, ok := tt.want[m.Service]
+				if !ok || m.Metric.Metric.Float64() != want {
+					t.Fatalf("%s = %v, want %v", m.Service, m.Metric.Metric.Float64(), tt.want)
+				}
+				if m.Host != tt.host || len(m.Attributes) != len(tt.attrs) {
+					t.Fatalf("host %s attributes %v, want %s %v", m.Host, m.Attributes, tt.host, tt.attrs)
+				}
+				for k, v := range tt.attrs {
+					if m.Attributes[k] != v {
+						t.Fatalf("attributes = %v, want %v", m.Attributes, tt.attrs)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestParseLinePrecision(t *testing.T) {
+	for name, precision := range Precisions {
+		p, err := ParseLine("cpu value=1 2", precision)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := time.Unix(0, 2*int64(precision)); !p.Time.Equal(want) {
+			t.Errorf("precision %q: time = %s, want %s", name, p.Time, want)
+		}
+	}
+}
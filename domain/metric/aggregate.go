@@ -0,0 +1,263 @@
+package metric
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	riemann "github.com/riemann/riemann-go-client"
+)
+
+// Stats of an aggregation, every stat is sent as the service followed by the
+// stat name, e.g. core_api.response_time.p95
+const (
+	StatCount = "count"
+	StatSum   = "sum"
+	StatMin   = "min"
+	StatMax   = "max"
+	StatMean  = "mean"
+	StatP50   = "p50"
+	StatP95   = "p95"
+	StatP99   = "p99"
+)
+
+var AllStats = []string{StatCount, StatSum, StatMin, StatMax, StatMean, StatP50, StatP95, StatP99}
+
+var percentiles = map[string]float64{StatP50: 50, StatP95: 95, StatP99: 99}
+
+// GroupByHost groups the metrics by host, the rest of the keys are attributes
+const GroupByHost = "host"
+
+// Aggregation rolls up the metrics of Services, glob patterns, every
+// Interval. There is a group for every service and value of the GroupBy keys.
+type Aggregation struct {
+	Name     string
+	Services []string
+	Interval time.Duration
+	GroupBy  []string
+	Stats    []string
+	// MaxSamples of every group kept for the percentiles, the samples are
+	// picked at random when there are more metrics
+	MaxSamples int
+}
+
+type group struct {
+	service    string
+	host       string
+	attributes map[string]string
+	count      int64
+	sum        float64
+	min        float64
+	max        float64
+	samples    []float64
+}
+
+func (g *group) add(value float64, maxSamples int) {
+	g.count++
+	g.sum += value
+	if g.count == 1 || value < g.min {
+		g.min = value
+	}
+	if g.count == 1 || value > g.max {
+		g.max = value
+	}
+
+	// reservoir sampling keeps an uniform sample of the values
+	if len(g.samples) < maxSamples {
+		g.samples = append(g.samples, value)
+	} else if i := rand.Int63n(g.count); i < int64(maxSamples) {
+		g.samples[i] = value
+	}
+}
+
+// percentile uses the nearest rank of the sorted samples
+func (g *group) percentile(p float64) float64 {
+	rank := int(math.Ceil(p / 100 * float64(len(g.samples))))
+	if rank < 1 {
+		rank = 1
+	}
+	return g.samples[rank-1]
+}
+
+func (g *group) stat(stat string) interface{} {
+	switch stat {
+	case StatCount:
+		return g.count
+	case StatSum:
+		return g.sum
+	case StatMin:
+		return g.min
+	case StatMax:
+		return g.max
+	case StatMean:
+		return g.sum / float64(g.count)
+	}
+	return g.percentile(percentiles[stat])
+}
+
+type aggregator struct {
+	Aggregation
+	mu     sync.Mutex
+	groups map[string]*group
+}
+
+func (a *aggregator) add(m *MetricPayload) {
+	var key strings.Builder
+	key.WriteString(m.Service)
+	g := &group{service: m.Service, attributes: make(map[string]string)}
+	for _, name := range a.GroupBy {
+		value := m.Attributes[name]
+		if name == GroupByHost {
+			value = m.Host
+			g.host = value
+		} else if value != "" {
+			g.attributes[name] = value
+		}
+		key.WriteString("\x00")
+		key.WriteString(value)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if existing, ok := a.groups[key.String()]; ok {
+		g = existing
+	} else {
+		a.groups[key.String()] = g
+	}
+	g.add(m.Metric.Metric.Float64(), a.MaxSamples)
+}
+
+// flush returns the events of the groups of the interval and starts a new one.
+// The events are ok and live two intervals, so they do not expire before the
+// next flush even if it is late.
+func (a *aggregator) flush(now time.Time) []riemann.Event {
+	a.mu.Lock()
+	groups := a.groups
+	a.groups = make(map[string]*group)
+	a.mu.Unlock()
+
+	events := make([]riemann.Event, 0, len(groups)*len(a.Stats))
+	for _, g := range groups {
+		sort.Float64s(g.samples)
+		for _, stat := range a.Stats {
+			events = append(events, riemann.Event{
+				Time:        now,
+				Service:     g.service + "." + stat,
+				Description: fmt.Sprintf("%s of %s in %s", stat, g.service, a.Interval),
+				Metric:      g.stat(stat),
+				State:       string(MetricOK),
+				Host:        g.host,
+				TTL:         2 * a.Interval,
+				Attributes:  g.attributes,
+			})
+		}
+	}
+	return events
+}
+
+// Aggregator sends the statistics of the aggregated services instead of
+// every metric. The events are published every interval of each aggregation.
+type Aggregator struct {
+	aggregators []*aggregator
+	publisher   Publisher
+	done        chan struct{}
+	wg          sync.WaitGroup
+	stopOnce    sync.Once
+}
+
+func NewAggregator(aggregations []Aggregation, publisher Publisher) *Aggregator {
+	a := &Aggregator{
+		publisher: publisher,
+		done:      make(chan struct{}),
+	}
+	for _, aggregation := range aggregations {
+		a.aggregators = append(a.aggregators, &aggregator{
+			Aggregation: aggregation,
+			groups:      make(map[string]*group),
+		})
+	}
+	return a
+}
+
+// Aggregates reports whether the service of the metric is aggregated
+// instead of sent
+func (a *Aggregator) Aggregates(m *MetricPayload) bool {
+	return a.find(m) != nil
+}
+
+// Add aggregates the metric, it returns false if its service is not
+// aggregated and the metric must be sent.
+func (a *Aggregator) Add(m *MetricPayload) bool {
+	agg := a.find(m)
+	if agg == nil {
+		return false
+	}
+	agg.add(m)
+	return true
+}
+
+func (a *Aggregator) find(m *MetricPayload) *aggregator {
+	if a == nil {
+		return nil
+	}
+	for _, agg := range a.aggregators {
+		if globAny(agg.Services, m.Service) {
+			return agg
+		}
+	}
+	return nil
+}
+
+// Start publishes the statistics of every aggregation on its interval
+func (a *Aggregator) Start() {
+	if a == nil {
+		return
+	}
+	for _, agg := range a.aggregators {
+		a.wg.Add(1)
+		go a.run(agg)
+	}
+}
+
+func (a *Aggregator) run(agg *aggregator) {
+	defer a.wg.Done()
+	ticker := time.NewTicker(agg.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-a.done:
+			a.publish(agg, time.Now())
+			return
+		case now := <-ticker.C:
+			a.publish(agg, now)
+		}
+	}
+}
+
+func (a *Aggregator) publish(agg *aggregator, now time.Time) {
+	events := agg.flush(now)
+	if len(events) == 0 {
+		return
+	}
+	if err := a.publisher.Publish(events...); err != nil {
+		log.Printf("Failed to publish the aggregation %s. %s", agg.Name, err)
+	}
+}
+
+// Stop publishes the current intervals and terminates the goroutines
+// launched by Start.
+func (a *Aggregator) Stop() {
+	if a == nil {
+		return
+	}
+	a.stopOnce.Do(func() {
+		close(a.done)
+	})
+	a.wg.Wait()
+}
@@ -0,0 +1,136 @@
+package metric
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	DefaultAggregationInterval   = 10 * time.Second
+	DefaultAggregationMaxSamples = 1000
+)
+
+type AggregationConfig struct {
+	Name     string        `yaml:"name"`
+	Services []string      `yaml:"services"`
+	Interval time.Duration `yaml:"interval"`
+	// host and attribute names, host if empty
+	GroupBy []string `yaml:"group_by"`
+	// All the stats if empty
+	Stats      []string `yaml:"stats"`
+	MaxSamples int      `yaml:"max_samples"`
+}
+
+// AggregationsConfig is the content of an aggregations file
+type AggregationsConfig struct {
+	Aggregations []AggregationConfig `yaml:"aggregations"`
+}
+
+// LoadAggregations reads the aggregations file in path. Without a path no
+// service is aggregated.
+func LoadAggregations(path string) ([]Aggregation, error) {
+	if path == "" {
+		return nil, nil
+	}
+	ac, err := ReadAggregations(path)
+	if err != nil {
+		return nil, err
+	}
+	return ac.Build()
+}
+
+// ReadAggregations parses the aggregations file in path. Unknown fields are
+// rejected.
+func ReadAggregations(path string) (*AggregationsConfig, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot open aggregations file: %s", err)
+	}
+	defer f.Close()
+
+	ac := &AggregationsConfig{}
+	decoder := yaml.NewDecoder(f)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(ac); err != nil {
+		return nil, fmt.Errorf("Invalid aggregations file %s: %s", path, err)
+	}
+	return ac, nil
+}
+
+// Build validates every aggregation and applies the defaults. All the
+// validation errors are reported at once.
+func (ac *AggregationsConfig) Build() ([]Aggregation, error) {
+	var errs []string
+	names := make(map[string]bool)
+	aggregations := make([]Aggregation, 0, len(ac.Aggregations))
+	for i, c := range ac.Aggregations {
+		aggregation, aggregationErrs := c.aggregation()
+		name := c.Name
+		if name == "" {
+			name = fmt.Sprintf("#%d", i)
+			aggregation.Name = name
+		} else if names[name] {
+			aggregationErrs = append(aggregationErrs, "duplicated name")
+		}
+		names[name] = true
+
+		for _, e := range aggregationErrs {
+			errs = append(errs, fmt.Sprintf("aggregation %s: %s", name, e))
+		}
+		aggregations = append(aggregations, aggregation)
+	}
+
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("Invalid aggregations: %s", strings.Join(errs, "; "))
+	}
+	return aggregations, nil
+}
+
+func (c AggregationConfig) aggregation() (Aggregation, []string) {
+	var errs []string
+	if len(c.Services) == 0 {
+		errs = append(errs, "services are required")
+	}
+	for _, pattern := range c.Services {
+		if _, err := path.Match(pattern, ""); err != nil {
+			errs = append(errs, fmt.Sprintf("invalid pattern %q", pattern))
+		}
+	}
+
+	a := Aggregation{
+		Name:       c.Name,
+		Services:   c.Services,
+		Interval:   c.Interval,
+		GroupBy:    c.GroupBy,
+		Stats:      c.Stats,
+		MaxSamples: c.MaxSamples,
+	}
+	if a.Interval == 0 {
+		a.Interval = DefaultAggregationInterval
+	} else if a.Interval < time.Second {
+		errs = append(errs, "interval must be at least 1s")
+	}
+	if len(a.GroupBy) == 0 {
+		a.GroupBy = []string{GroupByHost}
+	}
+	if len(a.Stats) == 0 {
+		a.Stats = AllStats
+	}
+	for _, stat := range a.Stats {
+		if !hasTag(AllStats, stat) {
+			errs = append(errs, fmt.Sprintf("stats must be some of: %s", strings.Join(AllStats, ", ")))
+			break
+		}
+	}
+	if a.MaxSamples == 0 {
+		a.MaxSamples = DefaultAggregationMaxSamples
+	} else if a.MaxSamples < 0 {
+		errs = append(errs, "max_samples must not be negative")
+	}
+	return a, errs
+}
@@ -0,0 +1,140 @@
+package metric
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestGroupStats(t *testing.T) {
+	g := &group{}
+	for _, v := range []float64{4, 1, 3, 2} {
+		g.add(v, 10)
+	}
+	sort.Float64s(g.samples)
+	want := map[string]interface{}{
+		StatCount: int64(4),
+		StatSum:   float64(10),
+		StatMin:   float64(1),
+		StatMax:   float64(4),
+		StatMean:  2.5,
+		StatP50:   float64(2),
+		StatP95:   float64(4),
+		StatP99:   float64(4),
+	}
+	for stat, value := range want {
+		if got := g.stat(stat); got != value {
+			t.Errorf("%s = %v, want %v", stat, got, value)
+		}
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	samples := func(n int) []float64 {
+		s := make([]float64, n)
+		for i := range s {
+			s[i] = float64(i + 1)
+		}
+		return s
+	}
+	tests := []struct {
+		samples []float64
+		p       float64
+		want    float64
+	}{
+		{samples(10), 50, 5},
+		{samples(10), 95, 10},
+		{samples(10), 99, 10},
+		{samples(100), 50, 50},
+		{samples(100), 95, 95},
+		{samples(100), 99, 99},
+		{samples(1000), 99, 990},
+		{samples(3), 50, 2},
+		{samples(1), 99, 1},
+		{samples(10), 0, 1},
+	}
+	for _, tt := range tests {
+		g := &group{samples: tt.samples}
+		if got := g.percentile(tt.p); got != tt.want {
+			t.Errorf("p%v of %d samples = %v, want %v", tt.p, len(tt.samples), got, tt.want)
+		}
+	}
+}
+
+func TestReservoirSampling(t *testing.T) {
+	const maxSamples, values, runs = 100, 10000, 200
+	secondHalf := 0
+	for run := 0; run < runs; run++ {
+		g := &group{}
+		for i := 0; i < values; i++ {
+			g.add(float64(i), maxSamples)
+		}
+		if len(g.samples) != maxSamples || g.count != values || g.min != 0 || g.max != values-1 {
+			t.Fatalf("%d samples of %d values between %v and %v", len(g.samples), g.count, g.min, g.max)
+		}
+		seen := make(map[float64]bool)
+		for _, v := range g.samples {
+			if seen[v] {
+				t.Fatalf("value %v sampled twice", v)
+			}
+			seen[v] = true
+			if v >= values/2 {
+				secondHalf++
+			}
+		}
+	}
+
+	// An uniform sample has as many values of each half
+	if ratio := float64(secondHalf) / (maxSamples * runs); ratio < 0.45 || ratio > 0.55 {
+		t.Fatalf("%.2f of the samples are from the second half, want 0.5", ratio)
+	}
+}
+
+func TestAggregatorFlush(t *testing.T) {
+	publisher := &testPublisher{}
+	a := NewAggregator([]Aggregation{{
+		Name:       "latency",
+		Services:   []string{"api.*"},
+		Interval:   time.Hour,
+		GroupBy:    []string{GroupByHost, "region"},
+		Stats:      []string{StatCount, StatMax},
+		MaxSamples: 10,
+	}}, publisher)
+	a.Start()
+
+	add := func(service, host, region string, value float64) bool {
+		m := thresholdMetric(service, host, value, "")
+		m.Attributes = map[string]string{"region": region, "ip": "10.0.0.1"}
+		return a.Add(m)
+	}
+	if !add("api.latency", "a", "eu", 10) || !add("api.latency", "a", "eu", 30) || !add("api.latency", "b", "", 20) {
+		t.Fatal("the aggregated metric was not added")
+	}
+	if add("web.latency", "a", "eu", 10) {
+		t.Fatal("the metric of another service was aggregated")
+	}
+	if len(publisher.events) != 0 {
+		t.Fatalf("%d events published before the interval", len(publisher.events))
+	}
+
+	// Stop publishes the current interval
+	a.Stop()
+	a.Stop()
+	got := make(map[string]interface{})
+	for _, e := range publisher.events {
+		if e.State != "ok" || e.TTL != 2*time.Hour {
+			t.Fatalf("event %s with state %q and ttl %s, want ok and 2h", e.Service, e.State, e.TTL)
+		}
+		got[e.Host+" "+e.Service+" "+e.Attributes["region"]] = e.Metric
+	}
+	want := map[string]interface{}{
+		"a api.latency.count eu": int64(2),
+		"a api.latency.max eu":   float64(30),
+		"b api.latency.count ":   int64(1),
+		"b api.latency.max ":     float64(20),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("published %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,157 @@
+package metric
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+)
+
+const (
+	maxBatchSize = 10000
+	// maxBatchBodySize limits the body, the items are only counted once they
+	// are decoded
+	maxBatchBodySize = 16 << 20
+)
+
+var (
+	errBatchTooLarge = fmt.Errorf("The request body is larger than %d bytes", maxBatchBodySize)
+	errBatchTooMany  = fmt.Errorf("Batch exceeds %d metrics", maxBatchSize)
+)
+
+// LimitReader reads at most n bytes of r and fails with err if there is more
+// data, unlike io.LimitReader that ends like the data was complete.
+func LimitReader(r io.Reader, n int64, err error) io.Reader {
+	return &limitedReader{r: r, n: n, err: err}
+}
+
+type limitedReader struct {
+	r   io.Reader
+	n   int64
+	err error
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.n <= 0 {
+		var b [1]byte
+		if n, err := l.r.Read(b[:]); n == 0 {
+			return 0, err
+		}
+		return 0, l.err
+	}
+	if int64(len(p)) > l.n {
+		p = p[:l.n]
+	}
+	n, err := l.r.Read(p)
+	l.n -= int64(n)
+	return n, err
+}
+
+type ItemResult struct {
+	Index  int          `json:"index"`
+	Status string       `json:"status"`
+	Error  string       `json:"error,omitempty"`
+	Errors []FieldError `json:"errors,omitempty"`
+}
+
+type BatchResponse struct {
+	Accepted int          `json:"accepted"`
+	Rejected []int        `json:"rejected"`
+	Results  []ItemResult `json:"results"`
+}
+
+func NewBatchResponse() *BatchResponse {
+	return &BatchResponse{
+		Rejected: []int{},
+		Results:  []ItemResult{},
+	}
+}
+
+func (br *BatchResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+func (br *BatchResponse) Accept(index int) {
+	br.Accepted++
+	br.Results = append(br.Results, ItemResult{Index: index, Status: "accepted"})
+}
+
+func (br *BatchResponse) Reject(index int, err error) {
+	br.Rejected = append(br.Rejected, index)
+	br.Results = append(br.Results, ItemResult{
+		Index:  index,
+		Status: "rejected",
+		Error:  err.Error(),
+		Errors: fieldErrors(err),
+	})
+}
+
+func isNDJSON(r *http.Request) bool {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return mediaType == "application/x-ndjson" || mediaType == "application/ndjson"
+}
+
+// decodeBatch reads the metrics of a JSON array or NDJSON body and calls fn
+// for every item with its decoding error, if any. The returned error means
+// the body itself can not be read, errBatchTooLarge or errBatchTooMany if it
+// is too large.
+func decodeBatch(r *http.Request, fn func(index int, m *MetricPayload, err error)) error {
+	body := LimitReader(r.Body, maxBatchBodySize, errBatchTooLarge)
+	if isNDJSON(r) {
+		return decodeNDJSON(body, fn)
+	}
+	return decodeArray(body, fn)
+}
+
+func decodeArray(body io.Reader, fn func(index int, m *MetricPayload, err error)) error {
+	decoder := json.NewDecoder(body)
+	tok, err := decoder.Token()
+	if err != nil {
+		return fmt.Errorf("Invalid JSON array: %w", err)
+	}
+	if delim, ok := tok.(json.Delim); !ok || delim != '[' {
+		return errors.New("Expected a JSON array of metrics")
+	}
+
+	for i := 0; decoder.More(); i++ {
+		if i >= maxBatchSize {
+			return errBatchTooMany
+		}
+		m := &MetricPayload{Metric: &Metric{}}
+		err := decoder.Decode(m.Metric)
+		var typeErr *json.UnmarshalTypeError
+		var valueErr *valueError
+		if err != nil && !errors.As(err, &typeErr) && !errors.As(err, &valueErr) {
+			return fmt.Errorf("Invalid JSON array: %w", err)
+		}
+		fn(i, m, err)
+	}
+
+	if _, err := decoder.Token(); err != nil {
+		return fmt.Errorf("Invalid JSON array: %w", err)
+	}
+	return nil
+}
+
+func decodeNDJSON(body io.Reader, fn func(index int, m *MetricPayload, err error)) error {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	i := 0
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		if i >= maxBatchSize {
+			return errBatchTooMany
+		}
+		m := &MetricPayload{Metric: &Metric{}}
+		fn(i, m, json.Unmarshal(line, m.Metric))
+		i++
+	}
+	return scanner.Err()
+}
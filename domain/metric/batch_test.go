@@ -0,0 +1,129 @@
+package metric
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"riemannhttp/domain/delivery"
+)
+
+type batchService struct {
+	prepareErr error
+	sendErr    error
+	sent       []*MetricPayload
+}
+
+func (s *batchService) Prepare(m *MetricPayload) error {
+	if m.Service == "incomplete" {
+		return &IncompleteError{Err: errors.New("Missing attributes: ip")}
+	}
+	return s.prepareErr
+}
+
+func (s *batchService) Send(m *MetricPayload) error {
+	return s.SendBatch([]*MetricPayload{m})
+}
+
+func (s *batchService) SendBatch(metrics []*MetricPayload) error {
+	if s.sendErr != nil {
+		return s.sendErr
+	}
+	s.sent = append(s.sent, metrics...)
+	return nil
+}
+
+func testMetricJSON(service string) string {
+	return fmt.Sprintf(`{"service": %q, "description": "d", "host": "h", "metric": 1}`, service)
+}
+
+func TestLimitReader(t *testing.T) {
+	tests := []struct {
+		data string
+		n    int64
+		err  bool
+	}{
+		{"abc", 3, false},
+		{"abc", 4, false},
+		{"abcd", 3, true},
+	}
+	errLimit := errors.New("too large")
+	for _, tt := range tests {
+		var b bytes.Buffer
+		_, err := b.ReadFrom(LimitReader(strings.NewReader(tt.data), tt.n, errLimit))
+		if (err != nil) != tt.err {
+			t.Errorf("read %q limited to %d: err = %v", tt.data, tt.n, err)
+		}
+	}
+}
+
+func TestCreateBatch(t *testing.T) {
+	tooMany := strings.Repeat(testMetricJSON("a")+"\n", maxBatchSize+1)
+	tooLarge := `[{"service": "a", "host": "h", "metric": 1, "description": "` + strings.Repeat("x", maxBatchBodySize) + `"}]`
+	tests := []struct {
+		name     string
+		ndjson   bool
+		body     string
+		sendErr  error
+		status   int
+		sent     int
+		rejected []int
+	}{
+		{"array", false, "[" + testMetricJSON("a") + "," + testMetricJSON("b") + "]", nil, http.StatusAccepted, 2, []int{}},
+		{"ndjson", true, testMetricJSON("a") + "\n\n" + testMetricJSON("b") + "\n", nil, http.StatusAccepted, 2, []int{}},
+		{"invalid item", false, "[" + testMetricJSON("a") + `, {"service": "b"}]`, nil, http.StatusAccepted, 1, []int{1}},
+		{"invalid value", false, `[{"service": "a", "description": "d", "host": "h", "metric": "x"}, ` + testMetricJSON("b") + "]", nil, http.StatusAccepted, 1, []int{0}},
+		{"invalid ndjson line", true, "{\n" + testMetricJSON("b") + "\n", nil, http.StatusAccepted, 1, []int{0}},
+		{"incomplete item", false, "[" + testMetricJSON("incomplete") + "," + testMetricJSON("b") + "]", nil, http.StatusAccepted, 1, []int{0}},
+		{"every item rejected", false, `[{"service": "a"}]`, nil, http.StatusBadRequest, 0, []int{0}},
+		{"empty", false, "[]", nil, http.StatusBadRequest, 0, nil},
+		{"not an array", false, testMetricJSON("a"), nil, http.StatusBadRequest, 0, nil},
+		{"broken array", false, "[" + testMetricJSON("a") + ",", nil, http.StatusBadRequest, 0, nil},
+		{"too many items", true, tooMany, nil, http.StatusRequestEntityTooLarge, 0, nil},
+		{"too large", false, tooLarge, nil, http.StatusRequestEntityTooLarge, 0, nil},
+		{"queue full", false, "[" + testMetricJSON("a") + "]", delivery.ErrQueueFull, http.StatusServiceUnavailable, 0, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := &batchService{sendErr: tt.sendErr}
+			h := NewHTTP(svc, &Limits{})
+			r := httptest.NewRequest(http.MethodPost, "/metrics", strings.NewReader(tt.body))
+			if tt.ndjson {
+				r.Header.Set("Content-Type", "application/x-ndjson")
+			}
+			w := httptest.NewRecorder()
+			h.CreateBatch(w, r)
+
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			if len(svc.sent) != tt.sent {
+				t.Fatalf("sent %d metrics, want %d", len(svc.sent), tt.sent)
+			}
+			if tt.rejected == nil {
+				return
+			}
+			resp := &BatchResponse{}
+			if err := json.NewDecoder(w.Body).Decode(resp); err != nil {
+				t.Fatalf("Decode: %s", err)
+			}
+			if !reflect.DeepEqual(resp.Rejected, tt.rejected) || resp.Accepted != tt.sent {
+				t.Fatalf("accepted %d and rejected %v, want %d and %v", resp.Accepted, resp.Rejected, tt.sent, tt.rejected)
+			}
+			if len(resp.Results) != tt.sent+len(tt.rejected) {
+				t.Fatalf("%d results, want %d", len(resp.Results), tt.sent+len(tt.rejected))
+			}
+			for _, result := range resp.Results {
+				if result.Status == "rejected" && result.Error == "" {
+					t.Fatalf("rejected item %d without error", result.Index)
+				}
+			}
+		})
+	}
+}
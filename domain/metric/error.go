@@ -1,8 +1,11 @@
 package metric
 
 import (
+  "errors"
   "net/http"
 
+  "riemannhttp/domain/delivery"
+
   "github.com/go-chi/render"
 )
 
@@ -12,6 +15,8 @@ type ErrResponse struct {
 
   StatusText string `json:"status"`          // user-level status message
   ErrorText  string `json:"error,omitempty"` // application-level error message, for debugging
+
+  Errors []FieldError `json:"errors,omitempty"` // every invalid field of the request
 }
 
 func (e *ErrResponse) Render(w http.ResponseWriter, r *http.Request) error {
@@ -25,6 +30,16 @@ func ErrInvalidRequest(err error) render.Renderer {
     HTTPStatusCode: 400,
     StatusText:     "Invalid request.",
     ErrorText:      err.Error(),
+    Errors:         fieldErrors(err),
+  }
+}
+
+func ErrTooLarge(err error) render.Renderer {
+  return &ErrResponse{
+    Err:            err,
+    HTTPStatusCode: 413,
+    StatusText:     "Request too large.",
+    ErrorText:      err.Error(),
   }
 }
 
@@ -36,3 +51,41 @@ func ErrOperationError(err error) render.Renderer {
     ErrorText:      err.Error(),
   }
 }
+
+// IncompleteError is a metric that can not be analyzed by Cerberus
+type IncompleteError struct {
+  Err error
+}
+
+func (e *IncompleteError) Error() string {
+  return e.Err.Error()
+}
+
+func (e *IncompleteError) Unwrap() error {
+  return e.Err
+}
+
+func ErrUnprocessableEntity(err error) render.Renderer {
+  return &ErrResponse{
+    Err:            err,
+    HTTPStatusCode: 422,
+    StatusText:     "Unprocessable entity.",
+    ErrorText:      err.Error(),
+  }
+}
+
+func ErrServiceUnavailable(err error) render.Renderer {
+  return &ErrResponse{
+    Err:            err,
+    HTTPStatusCode: 503,
+    StatusText:     "Service unavailable.",
+    ErrorText:      err.Error(),
+  }
+}
+
+func ErrSendError(err error) render.Renderer {
+  if errors.Is(err, delivery.ErrQueueFull) {
+    return ErrServiceUnavailable(err)
+  }
+  return ErrOperationError(err)
+}
@@ -1,6 +1,7 @@
 package metric
 
 import (
+  "errors"
   "log"
   "net/http"
 
@@ -9,15 +10,18 @@ import (
 
 type HttpTransport interface {
   Create(w http.ResponseWriter, r *http.Request)
+  CreateBatch(w http.ResponseWriter, r *http.Request)
 }
 
 type httpTransport struct {
-  svc Service
+  svc    Service
+  limits *Limits
 }
 
-func NewHTTP(svc Service) HttpTransport {
+func NewHTTP(svc Service, limits *Limits) HttpTransport {
   return &httpTransport{
-    svc: svc,
+    svc:    svc,
+    limits: limits,
   }
 }
 
@@ -28,13 +32,75 @@ func (h httpTransport) Create(w http.ResponseWriter, r *http.Request) {
     render.Render(w, r, ErrInvalidRequest(err))
     return
   }
+  if err := h.limits.Validate(metric); err != nil {
+    render.Render(w, r, ErrInvalidRequest(err))
+    return
+  }
+  if err := h.svc.Prepare(metric); err != nil {
+    var validationErr *ValidationError
+    if errors.As(err, &validationErr) {
+      render.Render(w, r, ErrInvalidRequest(err))
+      return
+    }
+    render.Render(w, r, ErrUnprocessableEntity(err))
+    return
+  }
 
   if err := h.svc.Send(metric); err != nil {
-    render.Render(w, r, ErrOperationError(err))
+    render.Render(w, r, ErrSendError(err))
     log.Printf("Error sending metric: %s", err)
     return
   }
 
-  render.Status(r, http.StatusCreated)
+  render.Status(r, http.StatusAccepted)
   render.Render(w, r, metric)
 }
+
+func (h httpTransport) CreateBatch(w http.ResponseWriter, r *http.Request) {
+  log.Print("metric batch received")
+  resp := NewBatchResponse()
+  metrics := []*MetricPayload{}
+  err := decodeBatch(r, func(index int, metric *MetricPayload, err error) {
+    if err == nil {
+      err = h.limits.Validate(metric)
+    }
+    if err == nil {
+      err = h.svc.Prepare(metric)
+    }
+    if err != nil {
+      resp.Reject(index, err)
+      return
+    }
+    resp.Accept(index)
+    metrics = append(metrics, metric)
+  })
+  if errors.Is(err, errBatchTooLarge) || errors.Is(err, errBatchTooMany) {
+    render.Render(w, r, ErrTooLarge(err))
+    return
+  }
+  if err != nil {
+    render.Render(w, r, ErrInvalidRequest(err))
+    return
+  }
+
+  if len(resp.Results) == 0 {
+    render.Render(w, r, ErrInvalidRequest(errors.New("Empty batch")))
+    return
+  }
+
+  if len(metrics) == 0 {
+    render.Status(r, http.StatusBadRequest)
+    render.Render(w, r, resp)
+    return
+  }
+
+  if err := h.svc.SendBatch(metrics); err != nil {
+    render.Render(w, r, ErrSendError(err))
+    log.Printf("Error sending metrics: %s", err)
+    return
+  }
+
+  log.Printf("metric batch queued, accepted: %d rejected: %d", resp.Accepted, len(resp.Rejected))
+  render.Status(r, http.StatusAccepted)
+  render.Render(w, r, resp)
+}
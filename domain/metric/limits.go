@@ -0,0 +1,110 @@
+package metric
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Limits are the checks of the metrics that depend on the configuration. A
+// zero limit is not checked.
+type Limits struct {
+	// MaxPast is how old the time of a metric can be
+	MaxPast time.Duration
+	// MaxFuture is how far in the future the time of a metric can be
+	MaxFuture time.Duration
+	// States is the allow-list of states, empty accepts any state
+	States                  []string
+	MaxTags                 int
+	MaxTagLength            int
+	MaxAttributes           int
+	MaxAttributeKeyLength   int
+	MaxAttributeValueLength int
+}
+
+// Validate checks the struct tags of the metric and the limits. The returned
+// *ValidationError lists every invalid field.
+func (l *Limits) Validate(m *MetricPayload) error {
+	verr := &ValidationError{}
+	if m.Metric == nil {
+		verr.Add("metric", "is required")
+		return verr
+	}
+	if err := validate.Struct(m); err != nil {
+		verr.addStructErrors(err)
+	}
+
+	if m.State != "" && len(l.States) > 0 && !l.allowedState(string(m.State)) {
+		verr.Add("state", "must be one of: %s", strings.Join(l.States, ", "))
+	}
+	l.checkTime(m, verr)
+	l.checkTags(m, verr)
+	l.checkAttributes(m, verr)
+
+	if len(verr.Errors) > 0 {
+		return verr
+	}
+	return nil
+}
+
+func (l *Limits) allowedState(state string) bool {
+	for _, s := range l.States {
+		if s == state {
+			return true
+		}
+	}
+	return false
+}
+
+func (l *Limits) checkTime(m *MetricPayload, verr *ValidationError) {
+	if m.Time == nil {
+		return
+	}
+	now := time.Now()
+	if l.MaxPast > 0 && m.Time.Before(now.Add(-l.MaxPast)) {
+		verr.Add("time", "%s is more than %s in the past", m.Time.UTC().Format(time.RFC3339), l.MaxPast)
+	}
+	if l.MaxFuture > 0 && m.Time.After(now.Add(l.MaxFuture)) {
+		verr.Add("time", "%s is more than %s in the future", m.Time.UTC().Format(time.RFC3339), l.MaxFuture)
+	}
+}
+
+func (l *Limits) checkTags(m *MetricPayload, verr *ValidationError) {
+	if l.MaxTags > 0 && len(m.Tags) > l.MaxTags {
+		verr.Add("tags", "has %d tags, the max is %d", len(m.Tags), l.MaxTags)
+	}
+	for i, tag := range m.Tags {
+		field := fmt.Sprintf("tags[%d]", i)
+		if tag == "" {
+			verr.Add(field, "is empty")
+		} else if l.MaxTagLength > 0 && len(tag) > l.MaxTagLength {
+			verr.Add(field, "is longer than %d bytes", l.MaxTagLength)
+		}
+	}
+}
+
+func (l *Limits) checkAttributes(m *MetricPayload, verr *ValidationError) {
+	if l.MaxAttributes > 0 && len(m.Attributes) > l.MaxAttributes {
+		verr.Add("attributes", "has %d attributes, the max is %d", len(m.Attributes), l.MaxAttributes)
+	}
+
+	keys := make([]string, 0, len(m.Attributes))
+	for key := range m.Attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if key == "" {
+			verr.Add("attributes", "has an empty key")
+			continue
+		}
+		if l.MaxAttributeKeyLength > 0 && len(key) > l.MaxAttributeKeyLength {
+			verr.Add("attributes", "key %.32q... is longer than %d bytes", key, l.MaxAttributeKeyLength)
+			continue
+		}
+		if l.MaxAttributeValueLength > 0 && len(m.Attributes[key]) > l.MaxAttributeValueLength {
+			verr.Add("attributes."+key, "is longer than %d bytes", l.MaxAttributeValueLength)
+		}
+	}
+}
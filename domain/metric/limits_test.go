@@ -0,0 +1,97 @@
+package metric
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func validMetric() *MetricPayload {
+	return &MetricPayload{Metric: &Metric{
+		Service:     "api.latency",
+		Description: "d",
+		Host:        "h",
+		Metric:      IntValue(1),
+	}}
+}
+
+func TestLimitsValidate(t *testing.T) {
+	limits := &Limits{
+		MaxPast:                 time.Hour,
+		MaxFuture:               time.Minute,
+		States:                  []string{"ok", "critical"},
+		MaxTags:                 2,
+		MaxTagLength:            5,
+		MaxAttributes:           2,
+		MaxAttributeKeyLength:   5,
+		MaxAttributeValueLength: 5,
+	}
+	tests := []struct {
+		name   string
+		change func(m *MetricPayload)
+		fields []string
+	}{
+		{"valid", func(m *MetricPayload) {}, nil},
+		{"nil metric", func(m *MetricPayload) { m.Metric = nil }, []string{"metric"}},
+		{"required fields", func(m *MetricPayload) {
+			m.Service, m.Description, m.Host, m.Metric.Metric = "", "", "", nil
+		}, []string{"service", "description", "metric", "host"}},
+		{"negative ttl", func(m *MetricPayload) { m.TTL = -1 }, []string{"ttl"}},
+		{"unknown transport", func(m *MetricPayload) { m.Transport = "http" }, []string{"transport"}},
+		{"allowed state", func(m *MetricPayload) { m.State = "critical" }, nil},
+		{"unknown state", func(m *MetricPayload) { m.State = "warning" }, []string{"state"}},
+		{"recent time", func(m *MetricPayload) { m.Time = &Timestamp{time.Now().Add(-time.Minute)} }, nil},
+		{"past time", func(m *MetricPayload) { m.Time = &Timestamp{time.Now().Add(-2 * time.Hour)} }, []string{"time"}},
+		{"future time", func(m *MetricPayload) { m.Time = &Timestamp{time.Now().Add(time.Hour)} }, []string{"time"}},
+		{"too many tags", func(m *MetricPayload) { m.Tags = []string{"a", "b", "c"} }, []string{"tags"}},
+		{"invalid tags", func(m *MetricPayload) { m.Tags = []string{"", "long tag"} }, []string{"tags[0]", "tags[1]"}},
+		{"too many attributes", func(m *MetricPayload) {
+			m.Attributes = map[string]string{"a": "1", "b": "2", "c": "3"}
+		}, []string{"attributes"}},
+		{"invalid attributes", func(m *MetricPayload) {
+			m.Attributes = map[string]string{"": "1", "long key": "2"}
+		}, []string{"attributes", "attributes"}},
+		{"long attribute value", func(m *MetricPayload) {
+			m.Attributes = map[string]string{"ip": "10.0.0.1"}
+		}, []string{"attributes.ip"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := validMetric()
+			tt.change(m)
+			err := limits.Validate(m)
+			var fields []string
+			for _, fe := range fieldErrors(err) {
+				fields = append(fields, fe.Field)
+			}
+			if !reflect.DeepEqual(fields, tt.fields) {
+				t.Fatalf("Validate() fields = %v, want %v: %v", fields, tt.fields, err)
+			}
+			if (err != nil) != (tt.fields != nil) {
+				t.Fatalf("Validate() = %v", err)
+			}
+		})
+	}
+}
+
+func TestZeroLimits(t *testing.T) {
+	m := validMetric()
+	m.State = "anything"
+	m.Time = &Timestamp{time.Unix(0, 0)}
+	m.Tags = []string{strings.Repeat("t", 1000)}
+	m.Attributes = map[string]string{strings.Repeat("k", 1000): strings.Repeat("v", 1000)}
+	if err := (&Limits{}).Validate(m); err != nil {
+		t.Fatalf("Validate() = %v, the zero limits are not checked", err)
+	}
+}
+
+func TestValidationErrorMessage(t *testing.T) {
+	verr := &ValidationError{}
+	verr.Add("service", "is required")
+	verr.Add("tags", "has %d tags, the max is %d", 3, 2)
+	want := "service is required; tags has 3 tags, the max is 2"
+	if verr.Error() != want {
+		t.Fatalf("Error() = %q, want %q", verr.Error(), want)
+	}
+}
@@ -6,6 +6,8 @@ import (
   "gopkg.in/go-playground/validator.v9"
 )
 
+var validate = validator.New()
+
 type MetricState string
 
 const (
@@ -18,12 +20,14 @@ const (
 type Metric struct {
   Service     string            `json:"service" validate:"required"`
   Description string            `json:"description" validate:"required"`
-  Metric      *int64            `json:"metric" validate:"required"`
-  State       MetricState       `json:"state" validate:"required"`
+  Metric      *Value            `json:"metric" validate:"required"`
+  State       MetricState       `json:"state,omitempty"`
   Host        string            `json:"host" validate:"required"`
   Tags        []string          `json:"tags,omitempty"`
-  TTL         int64             `json:"ttl,omitempty"`
+  TTL         int64             `json:"ttl,omitempty" validate:"gte=0"`
   Attributes  map[string]string `json:"attributes,omitempty"`
+  Time        *Timestamp        `json:"time,omitempty"`
+  Transport   string            `json:"transport,omitempty" validate:"omitempty,oneof=tcp udp"`
 }
 
 type MetricPayload struct {
@@ -34,7 +38,7 @@ func (mp *MetricPayload) Render(w http.ResponseWriter, r *http.Request) error {
   return nil
 }
 
+// Bind only decodes the metric, it is validated with the configured Limits
 func (mp *MetricPayload) Bind(r *http.Request) error {
-  v := validator.New()
-  return v.Struct(mp)
+  return nil
 }
@@ -0,0 +1,65 @@
+package metric
+
+import "strings"
+
+// Normalizer renames the attributes sent with alternate names. The aliases
+// and the canonical names are matched ignoring the case, so "statusCode",
+// "StatusCode" and "STATUS_CODE" can all become "status_code".
+type Normalizer struct {
+	// names maps the lowercase aliases and canonical names to the canonical name
+	names         map[string]string
+	lowercaseKeys bool
+}
+
+// NewNormalizer builds a Normalizer from a map of alias to canonical name
+// and a list of canonical names without aliases. With lowercaseKeys the
+// other attributes are lowercased too.
+func NewNormalizer(aliases map[string]string, canonicalNames []string, lowercaseKeys bool) *Normalizer {
+	names := make(map[string]string)
+	for _, canonical := range canonicalNames {
+		names[strings.ToLower(canonical)] = canonical
+	}
+	for alias, canonical := range aliases {
+		names[strings.ToLower(alias)] = canonical
+		names[strings.ToLower(canonical)] = canonical
+	}
+	return &Normalizer{names: names, lowercaseKeys: lowercaseKeys}
+}
+
+// Normalize renames the attributes of the metric. If an attribute is sent
+// with its canonical name and an alias, the canonical one is kept. Between
+// several aliases the first in alphabetical order is kept.
+func (n *Normalizer) Normalize(m *MetricPayload) {
+	if len(m.Attributes) == 0 {
+		return
+	}
+
+	attributes := make(map[string]string, len(m.Attributes))
+	// sources has the key of the value kept for every canonical name
+	sources := make(map[string]string)
+	for key, value := range m.Attributes {
+		name, found := n.names[strings.ToLower(key)]
+		if !found {
+			if n.lowercaseKeys {
+				key = strings.ToLower(key)
+			}
+			attributes[key] = value
+			continue
+		}
+
+		if source, exists := sources[name]; exists && !preferred(key, source, name) {
+			continue
+		}
+		attributes[name] = value
+		sources[name] = key
+	}
+	m.Attributes = attributes
+}
+
+// preferred reports whether the value of key replaces the one of source
+func preferred(key, source, canonical string) bool {
+	if source == canonical {
+		return false
+	}
+	return key == canonical || key < source
+}
@@ -0,0 +1,105 @@
+package metric
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"riemannhttp/domain/cerberus"
+)
+
+func TestNormalize(t *testing.T) {
+	aliases := map[string]string{"statusCode": "status_code", "code": "status_code", "clientIp": "ip"}
+	names := []string{"ip", "url", "status_code"}
+	tests := []struct {
+		name       string
+		lowercase  bool
+		attributes map[string]string
+		want       map[string]string
+	}{
+		{"canonical", false, map[string]string{"ip": "1", "url": "/"}, map[string]string{"ip": "1", "url": "/"}},
+		{"canonical ignoring the case", false, map[string]string{"URL": "/", "Status_Code": "200"}, map[string]string{"url": "/", "status_code": "200"}},
+		{"alias", false, map[string]string{"statusCode": "200", "CLIENTIP": "1"}, map[string]string{"status_code": "200", "ip": "1"}},
+		{"canonical over alias", false, map[string]string{"statusCode": "500", "status_code": "200", "code": "404"}, map[string]string{"status_code": "200"}},
+		{"first alias", false, map[string]string{"statusCode": "500", "code": "404"}, map[string]string{"status_code": "404"}},
+		{"alias over canonical in another case", false, map[string]string{"STATUS_CODE": "500", "code": "404"}, map[string]string{"status_code": "500"}},
+		{"other keys", false, map[string]string{"Region": "eu"}, map[string]string{"Region": "eu"}},
+		{"lowercase keys", true, map[string]string{"Region": "eu", "clientIp": "1"}, map[string]string{"region": "eu", "ip": "1"}},
+	}
+	n := NewNormalizer(aliases, names, false)
+	lowercase := NewNormalizer(aliases, names, true)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			normalizer := n
+			if tt.lowercase {
+				normalizer = lowercase
+			}
+			// The order of the map must not change the result
+			for i := 0; i < 20; i++ {
+				m := validMetric()
+				m.Attributes = make(map[string]string)
+				for k, v := range tt.attributes {
+					m.Attributes[k] = v
+				}
+				normalizer.Normalize(m)
+				if !reflect.DeepEqual(m.Attributes, tt.want) {
+					t.Fatalf("Normalize() = %v, want %v", m.Attributes, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestPrepareIncomplete(t *testing.T) {
+	complete := map[string]string{"clientIp": "10.0.0.1", "asn": "64500", "URL": "/", "statusCode": "200"}
+	incomplete := map[string]string{"ip": "10.0.0.1", "url": "/"}
+	tests := []struct {
+		name             string
+		service          string
+		attributes       map[string]string
+		rejectIncomplete bool
+		status           int
+		incomplete       int64
+	}{
+		{"complete", "core_api.response_time", complete, true, http.StatusAccepted, 0},
+		{"incomplete counted", "core_api.response_time", incomplete, false, http.StatusAccepted, 1},
+		{"incomplete rejected", "core_api.response_time", incomplete, true, http.StatusUnprocessableEntity, 1},
+		{"other service", "api.latency", incomplete, true, http.StatusAccepted, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tcp := &testPublisher{}
+			guardian := cerberus.NewCerberus(&cerberus.Options{Classifier: cerberus.DefaultClassifier()})
+			svc := NewService(Options{
+				Transports:       NewTransports(tcp, TransportTCP, nil),
+				Normalizer:       NewNormalizer(map[string]string{"clientIp": "ip", "statusCode": "status_code"}, []string{"ip", "asn", "url", "status_code"}, false),
+				Enricher:         &testEnricher{},
+				Guardian:         guardian,
+				RejectIncomplete: tt.rejectIncomplete,
+			})
+			m := validMetric()
+			m.Service, m.Attributes = tt.service, tt.attributes
+			body, _ := json.Marshal(m)
+			r := httptest.NewRequest(http.MethodPost, "/metric", strings.NewReader(string(body)))
+			r.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			NewHTTP(svc, &Limits{}).Create(w, r)
+
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			if tt.status == http.StatusUnprocessableEntity && !strings.Contains(w.Body.String(), "Missing attributes: asn, status_code") {
+				t.Fatalf("the error does not list the missing attributes: %s", w.Body)
+			}
+			if sent := len(tcp.events) == 1; sent != (tt.status == http.StatusAccepted) {
+				t.Fatalf("sent %d events with status %d", len(tcp.events), w.Code)
+			}
+			if stats := guardian.Stats(); stats.Incomplete != tt.incomplete {
+				t.Fatalf("%d incomplete metrics, want %d", stats.Incomplete, tt.incomplete)
+			}
+		})
+	}
+}
@@ -1,7 +1,6 @@
 package metric
 
 import (
-	"fmt"
 	"log"
 	"riemannhttp/domain/cerberus"
 	"time"
@@ -9,106 +8,202 @@ import (
 	riemann "github.com/riemann/riemann-go-client"
 )
 
-type ASNService interface {
-	GetASNForIP(string) (string, error)
+// Enricher adds data to the metrics before they are analyzed and sent
+type Enricher interface {
+	Enrich(m *MetricPayload)
 }
 
+// Publisher queues events to be delivered to riemann
+type Publisher interface {
+	Publish(events ...riemann.Event) error
+}
+
+// Service sends the metrics to riemann. Every metric must go through
+// Prepare before it is sent.
 type Service interface {
+	Prepare(*MetricPayload) error
 	Send(*MetricPayload) error
+	SendBatch([]*MetricPayload) error
 }
 
-func NewService(rc *riemann.TCPClient, asnSvc ASNService, guardian *cerberus.Cerberus) Service {
+type Options struct {
+	Transports *Transports
+	Normalizer *Normalizer
+	Enricher   Enricher
+	// Limits are checked again once the metrics are enriched and
+	// transformed, nil skips the checks
+	Limits   *Limits
+	Guardian *cerberus.Cerberus
+	// Thresholds computes the state of the metrics, nil keeps the state sent
+	Thresholds *Thresholds
+	// Transformer rewrites the metrics after the analysis, nil keeps them
+	Transformer *Transformer
+	// Aggregator sends the statistics of the aggregated services instead of
+	// their metrics, nil sends every metric
+	Aggregator *Aggregator
+	// Stream receives a copy of the events accepted to be sent, nil disables it
+	Stream Publisher
+	// RejectIncomplete fails Prepare for the metrics that Cerberus can not
+	// analyze, usually because of missing attributes
+	RejectIncomplete bool
+}
+
+func NewService(opts Options) Service {
 	return &svc{
-		client:   rc,
-		asnSvc:   asnSvc,
-		guardian: guardian,
+		transports:       opts.Transports,
+		normalizer:       opts.Normalizer,
+		enricher:         opts.Enricher,
+		limits:           opts.Limits,
+		guardian:         opts.Guardian,
+		thresholds:       opts.Thresholds,
+		transformer:      opts.Transformer,
+		aggregator:       opts.Aggregator,
+		stream:           opts.Stream,
+		rejectIncomplete: opts.RejectIncomplete,
 	}
 }
 
 type svc struct {
-	guardian *cerberus.Cerberus
-	client   *riemann.TCPClient
-	asnSvc   ASNService
+	guardian         *cerberus.Cerberus
+	transports       *Transports
+	normalizer       *Normalizer
+	enricher         Enricher
+	limits           *Limits
+	thresholds       *Thresholds
+	transformer      *Transformer
+	aggregator       *Aggregator
+	stream           Publisher
+	rejectIncomplete bool
+}
+
+// Prepare normalizes the attributes, enriches the metric and checks it can be
+// analyzed by Cerberus. The limits are checked again since the enrichers add
+// attributes.
+func (s *svc) Prepare(m *MetricPayload) error {
+	s.normalizer.Normalize(m)
+	s.enricher.Enrich(m)
+	if err := s.checkLimits(m); err != nil {
+		return err
+	}
+	if err := s.guardian.Check(m.Service, m.Attributes); err != nil && s.rejectIncomplete {
+		return &IncompleteError{Err: err}
+	}
+	return nil
 }
 
-func (s *svc) GetAttributes(m *MetricPayload) map[string]string {
-	if m.Service != "core_api.response_time" {
-		return m.Attributes
+func (s *svc) checkLimits(m *MetricPayload) error {
+	if s.limits == nil {
+		return nil
 	}
+	return s.limits.Validate(m)
+}
 
-	ip, hasIp := m.Attributes["ip"]
-	if !hasIp {
-		log.Printf("Ip not found in attributes")
-		return m.Attributes
+func (s *svc) Event(m *MetricPayload) riemann.Event {
+	eventTime := time.Now()
+	if m.Time != nil {
+		eventTime = m.Time.Time
 	}
 
-	log.Printf("Getting asn for metric")
-	asn, err := s.asnSvc.GetASNForIP(ip)
-	if err != nil {
-		log.Printf("Error getting asn %s", err)
-		return m.Attributes
+	return riemann.Event{
+		Time:        eventTime,
+		Service:     m.Service,
+		Description: m.Description,
+		Metric:      m.Metric.Metric.Riemann(),
+		State:       string(m.State),
+		Host:        m.Host,
+		Tags:        m.Tags,
+		TTL:         time.Duration(m.TTL) * time.Second,
+		Attributes:  m.Attributes,
 	}
+}
 
-	m.Attributes["asn"] = asn
-	return m.Attributes
+func (s *svc) Send(m *MetricPayload) error {
+	return s.SendBatch([]*MetricPayload{m})
 }
 
-func (s *svc) Analyze(m *MetricPayload) error {
-	if m.Service != "core_api.response_time" {
+// analysis is the service and attributes of a metric before it is
+// transformed, Cerberus analyzes them once the metric is accepted
+type analysis struct {
+	service    string
+	attributes map[string]string
+}
+
+// SendBatch queues all the metrics to be sent to riemann by TCP, or sends
+// them right away by UDP. Cerberus and the aggregator only get the metrics
+// once they are accepted, so a rejected batch sent again is not counted twice.
+func (s *svc) SendBatch(metrics []*MetricPayload) error {
+	if len(metrics) == 0 {
 		return nil
 	}
 
-	ip, hasIp := m.Attributes["ip"]
-	if !hasIp {
-		return fmt.Errorf("Ip not found in attributes")
+	analyses := make([]analysis, 0, len(metrics))
+	aggregated := []*MetricPayload{}
+	tcp := []riemann.Event{}
+	udp := []riemann.Event{}
+	for _, m := range metrics {
+		// Cerberus analyzes the metrics before they are transformed or dropped
+		analyses = append(analyses, analysis{service: m.Service, attributes: copyAttributes(m.Attributes)})
+
+		s.thresholds.Apply(m)
+		transport := s.transports.Transport(m)
+		if !s.transformer.Transform(m) {
+			continue
+		}
+		if s.aggregator.Aggregates(m) {
+			aggregated = append(aggregated, m)
+			continue
+		}
+		if err := s.checkLimits(m); err != nil {
+			log.Printf("Metric %s dropped, invalid after the transforms: %s", m.Service, err)
+			continue
+		}
+		if transport == TransportUDP {
+			udp = append(udp, s.Event(m))
+		} else {
+			tcp = append(tcp, s.Event(m))
+		}
 	}
 
-	asn, hasAsn := m.Attributes["asn"]
-	if !hasAsn {
-		return fmt.Errorf("ASN not found in attributes")
+	// The TCP events are queued first, the queue can reject them and then the
+	// client sends the whole batch again. The UDP events are sent right away
+	// and would be sent twice.
+	if len(tcp) > 0 {
+		if err := s.transports.TCP.Publish(tcp...); err != nil {
+			return err
+		}
+		s.streamEvents(tcp)
 	}
-
-	url, hasUrl := m.Attributes["url"]
-	if !hasUrl {
-		return fmt.Errorf("URL not found in attributes")
+	if len(udp) > 0 {
+		if err := s.transports.UDP.Publish(udp...); err != nil {
+			return err
+		}
+		s.streamEvents(udp)
 	}
 
-	statusCode, hasStatusCode := m.Attributes["status_code"]
-	if !hasStatusCode {
-		return fmt.Errorf("Status Code not found in attributes")
+	for _, a := range analyses {
+		if err := s.guardian.AnalyzeMetric(a.service, a.attributes); err != nil {
+			log.Printf("Error in analyze %s", err)
+		}
+	}
+	for _, m := range aggregated {
+		s.aggregator.Add(m)
 	}
-
-	isLogin := url == "/api/v2/access/login" || url == "/api/access/login"
-	isUnauthorized := statusCode == "401" || statusCode == "403"
-	s.guardian.Analyze(ip, asn, isLogin, isUnauthorized)
 	return nil
 }
 
-func (s *svc) Send(m *MetricPayload) error {
-	atts := s.GetAttributes(m)
-	if err := s.Analyze(m); err != nil {
-		log.Printf("Error in analyze %s", err)
-	}
-
-	e := &riemann.Event{
-		Service:     m.Service,
-		Description: m.Description,
-		Metric:      *m.Metric.Metric,
-		State:       string(m.State),
-		Host:        m.Host,
-		Tags:        m.Tags,
-		TTL:         time.Duration(m.TTL) * time.Second,
-		Attributes:  atts,
-	}
-	if _, err := riemann.SendEvent(s.client, e); err == nil {
+func copyAttributes(attributes map[string]string) map[string]string {
+	if attributes == nil {
 		return nil
 	}
-
-	// If fail to send event retry the connection
-	if err := s.client.Connect(); err != nil {
-		return err
+	c := make(map[string]string, len(attributes))
+	for k, v := range attributes {
+		c[k] = v
 	}
+	return c
+}
 
-	_, err := riemann.SendEvent(s.client, e)
-	return err
+func (s *svc) streamEvents(events []riemann.Event) {
+	if s.stream != nil {
+		s.stream.Publish(events...)
+	}
 }
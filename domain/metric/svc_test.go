@@ -0,0 +1,154 @@
+package metric
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"riemannhttp/domain/cerberus"
+
+	riemann "github.com/riemann/riemann-go-client"
+)
+
+type testPublisher struct {
+	err    error
+	events []riemann.Event
+}
+
+func (p *testPublisher) Publish(events ...riemann.Event) error {
+	if p.err != nil {
+		return p.err
+	}
+	p.events = append(p.events, events...)
+	return nil
+}
+
+func TestSendBatchTransports(t *testing.T) {
+	tests := []struct {
+		name   string
+		tcpErr error
+		tcp    int
+		udp    int
+	}{
+		{"both sent", nil, 1, 1},
+		{"tcp rejected before udp is sent", errors.New("queue is full"), 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tcp := &testPublisher{err: tt.tcpErr}
+			udp := &testPublisher{}
+			transports := NewTransports(tcp, TransportTCP, []string{"udp.service"})
+			transports.UDP = udp
+			svc := NewService(Options{
+				Transports: transports,
+				Guardian:   cerberus.NewCerberus(&cerberus.Options{}),
+			})
+
+			err := svc.SendBatch([]*MetricPayload{
+				{Metric: &Metric{Service: "udp.service", Host: "h", Metric: IntValue(1)}},
+				{Metric: &Metric{Service: "tcp.service", Host: "h", Metric: IntValue(1)}},
+			})
+			if err != tt.tcpErr {
+				t.Fatalf("err = %v, want %v", err, tt.tcpErr)
+			}
+			if len(tcp.events) != tt.tcp || len(udp.events) != tt.udp {
+				t.Fatalf("sent %d tcp and %d udp events, want %d and %d", len(tcp.events), len(udp.events), tt.tcp, tt.udp)
+			}
+		})
+	}
+}
+
+func TestSendBatchRejectedIsNotCounted(t *testing.T) {
+	tcp := &testPublisher{err: errors.New("queue is full")}
+	aggregated := &testPublisher{}
+	guardian := cerberus.NewCerberus(&cerberus.Options{})
+	aggregator := NewAggregator([]Aggregation{{
+		Name:       "latency",
+		Services:   []string{"web.latency"},
+		Interval:   time.Hour,
+		Stats:      []string{StatCount},
+		MaxSamples: 10,
+	}}, aggregated)
+	aggregator.Start()
+	svc := NewService(Options{
+		Transports: NewTransports(tcp, TransportTCP, nil),
+		Guardian:   guardian,
+		Aggregator: aggregator,
+	})
+
+	batch := func() []*MetricPayload {
+		return []*MetricPayload{
+			{Metric: &Metric{Service: "core_api.response_time", Host: "h", Metric: IntValue(1), Attributes: map[string]string{
+				"ip": "10.0.0.1", "asn": "1", "url": "/api", "status_code": "200",
+			}}},
+			{Metric: &Metric{Service: "web.latency", Host: "h", Metric: IntValue(1)}},
+		}
+	}
+	if err := svc.SendBatch(batch()); err != tcp.err {
+		t.Fatalf("err = %v, want %v", err, tcp.err)
+	}
+	if analyzed := guardian.Stats().Analyzed; analyzed != 0 {
+		t.Fatalf("analyzed %d requests of a rejected batch", analyzed)
+	}
+
+	tcp.err = nil
+	if err := svc.SendBatch(batch()); err != nil {
+		t.Fatalf("SendBatch: %s", err)
+	}
+	if analyzed := guardian.Stats().Analyzed; analyzed != 1 {
+		t.Fatalf("analyzed %d requests, want 1", analyzed)
+	}
+	aggregator.Stop()
+	if len(aggregated.events) != 1 || aggregated.events[0].Metric != int64(1) {
+		t.Fatalf("aggregated %+v, want a count of 1", aggregated.events)
+	}
+}
+
+type testEnricher struct {
+	attributes map[string]string
+}
+
+func (e *testEnricher) Enrich(m *MetricPayload) {
+	for k, v := range e.attributes {
+		m.Attributes[k] = v
+	}
+}
+
+func TestLimitsCheckedAfterPrepare(t *testing.T) {
+	tcp := &testPublisher{}
+	svc := NewService(Options{
+		Transports: NewTransports(tcp, TransportTCP, nil),
+		Normalizer: NewNormalizer(nil, nil, false),
+		Enricher:   &testEnricher{attributes: map[string]string{"asn": "1", "country": "ES"}},
+		Limits:     &Limits{MaxAttributes: 3, MaxTags: 1},
+		Guardian:   cerberus.NewCerberus(&cerberus.Options{}),
+		Transformer: &Transformer{Rules: []TransformRule{{
+			When:    Condition{Services: []string{"tagged"}},
+			Actions: []Action{&AddTags{Tags: []string{"a", "b"}}},
+		}}},
+	})
+
+	enriched := validMetric()
+	enriched.Attributes = map[string]string{"ip": "10.0.0.1", "url": "/"}
+	var verr *ValidationError
+	if err := svc.Prepare(enriched); !errors.As(err, &verr) {
+		t.Fatalf("Prepare() = %v, want the attributes added by the enrichers rejected", err)
+	}
+
+	sent := validMetric()
+	sent.Attributes = map[string]string{}
+	tagged := validMetric()
+	tagged.Service = "tagged"
+	tagged.Attributes = map[string]string{}
+	for _, m := range []*MetricPayload{sent, tagged} {
+		if err := svc.Prepare(m); err != nil {
+			t.Fatalf("Prepare: %s", err)
+		}
+	}
+	if err := svc.SendBatch([]*MetricPayload{sent, tagged}); err != nil {
+		t.Fatalf("SendBatch: %s", err)
+	}
+	if len(tcp.events) != 1 || tcp.events[0].Service != sent.Service {
+		t.Fatalf("sent %+v, want the metric over the limits after the transforms dropped", tcp.events)
+	}
+}
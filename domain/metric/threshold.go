@@ -0,0 +1,161 @@
+package metric
+
+import (
+	"sync"
+	"time"
+)
+
+// Threshold derives the state of the metrics of Services, glob patterns, from
+// their value or from their moving average over Window. The values at or
+// above Warning and Critical are worse, or at or below them with Below.
+type Threshold struct {
+	Name     string
+	Services []string
+	Warning  *float64
+	Critical *float64
+	Below    bool
+	// Window of the moving average, 0 uses the value of every metric
+	Window time.Duration
+	// Override replaces the state sent by the client
+	Override bool
+}
+
+// State returns the state of the value
+func (t *Threshold) State(value float64) MetricState {
+	switch {
+	case t.Critical != nil && t.reached(value, *t.Critical):
+		return MetricCritical
+	case t.Warning != nil && t.reached(value, *t.Warning):
+		return MetricWarning
+	}
+	return MetricOK
+}
+
+func (t *Threshold) reached(value, boundary float64) bool {
+	if t.Below {
+		return value <= boundary
+	}
+	return value >= boundary
+}
+
+type sample struct {
+	at    time.Time
+	value float64
+}
+
+// movingAverage is the average of the samples added in the window
+type movingAverage struct {
+	window  time.Duration
+	samples []sample
+	sum     float64
+}
+
+func (ma *movingAverage) add(now time.Time, value float64) float64 {
+	ma.samples = append(ma.samples, sample{at: now, value: value})
+	ma.sum += value
+	ma.expire(now)
+	return ma.sum / float64(len(ma.samples))
+}
+
+func (ma *movingAverage) expire(now time.Time) {
+	oldest := now.Add(-ma.window)
+	i := 0
+	for ; i < len(ma.samples) && ma.samples[i].at.Before(oldest); i++ {
+		ma.sum -= ma.samples[i].value
+	}
+	ma.samples = ma.samples[i:]
+}
+
+type averageKey struct {
+	threshold int
+	service   string
+	host      string
+}
+
+// Thresholds computes the state of the metrics before they are sent to
+// riemann. The moving averages are kept by threshold, service and host.
+type Thresholds struct {
+	thresholds []Threshold
+	maxWindow  time.Duration
+
+	mu        sync.Mutex
+	averages  map[averageKey]*movingAverage
+	lastSweep time.Time
+}
+
+func NewThresholds(thresholds []Threshold) *Thresholds {
+	t := &Thresholds{
+		thresholds: thresholds,
+		averages:   make(map[averageKey]*movingAverage),
+		lastSweep:  time.Now(),
+	}
+	for _, threshold := range thresholds {
+		if threshold.Window > t.maxWindow {
+			t.maxWindow = threshold.Window
+		}
+	}
+	return t
+}
+
+// Apply sets the state of the metric with the first threshold of its
+// service. The state sent by the client is kept unless the threshold
+// overrides it, but the value is always added to the moving average. The
+// metrics without state and without threshold are ok, also with nil
+// Thresholds.
+func (t *Thresholds) Apply(m *MetricPayload) {
+	if t != nil && t.apply(m) {
+		return
+	}
+	if m.State == "" {
+		m.State = MetricOK
+	}
+}
+
+// apply returns false if no threshold matches the service of the metric
+func (t *Thresholds) apply(m *MetricPayload) bool {
+	for i := range t.thresholds {
+		threshold := &t.thresholds[i]
+		if !globAny(threshold.Services, m.Service) {
+			continue
+		}
+
+		value := m.Metric.Metric.Float64()
+		if threshold.Window > 0 {
+			value = t.average(i, m, value)
+		}
+		if m.State == "" || threshold.Override {
+			m.State = threshold.State(value)
+		}
+		return true
+	}
+	return false
+}
+
+func (t *Thresholds) average(i int, m *MetricPayload, value float64) float64 {
+	now := time.Now()
+	key := averageKey{threshold: i, service: m.Service, host: m.Host}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.sweep(now)
+	ma, ok := t.averages[key]
+	if !ok {
+		ma = &movingAverage{window: t.thresholds[i].Window}
+		t.averages[key] = ma
+	}
+	return ma.add(now, value)
+}
+
+// sweep removes the averages without samples in their window, at most once
+// per the longest window
+func (t *Thresholds) sweep(now time.Time) {
+	if now.Sub(t.lastSweep) < t.maxWindow {
+		return
+	}
+	t.lastSweep = now
+	for key, ma := range t.averages {
+		if ma.expire(now); len(ma.samples) == 0 {
+			delete(t.averages, key)
+		}
+	}
+}
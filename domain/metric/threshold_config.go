@@ -0,0 +1,135 @@
+package metric
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	DirectionAbove = "above"
+	DirectionBelow = "below"
+)
+
+type ThresholdConfig struct {
+	Name     string   `yaml:"name"`
+	Services []string `yaml:"services"`
+	Warning  *float64 `yaml:"warning"`
+	Critical *float64 `yaml:"critical"`
+	// above (default) or below
+	Direction string        `yaml:"direction"`
+	Window    time.Duration `yaml:"window"`
+	Override  bool          `yaml:"override"`
+}
+
+// ThresholdsConfig is the content of a thresholds file
+type ThresholdsConfig struct {
+	Thresholds []ThresholdConfig `yaml:"thresholds"`
+}
+
+// LoadThresholds reads the thresholds file in path. Without a path the
+// states are not computed.
+func LoadThresholds(path string) (*Thresholds, error) {
+	if path == "" {
+		return nil, nil
+	}
+	tc, err := ReadThresholds(path)
+	if err != nil {
+		return nil, err
+	}
+	return tc.Build()
+}
+
+// ReadThresholds parses the thresholds file in path. Unknown fields are
+// rejected.
+func ReadThresholds(path string) (*ThresholdsConfig, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot open thresholds file: %s", err)
+	}
+	defer f.Close()
+
+	tc := &ThresholdsConfig{}
+	decoder := yaml.NewDecoder(f)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(tc); err != nil {
+		return nil, fmt.Errorf("Invalid thresholds file %s: %s", path, err)
+	}
+	return tc, nil
+}
+
+// Build validates every threshold and builds the Thresholds. All the
+// validation errors are reported at once.
+func (tc *ThresholdsConfig) Build() (*Thresholds, error) {
+	var errs []string
+	names := make(map[string]bool)
+	thresholds := make([]Threshold, 0, len(tc.Thresholds))
+	for i, c := range tc.Thresholds {
+		threshold, thresholdErrs := c.threshold()
+		name := c.Name
+		if name == "" {
+			name = fmt.Sprintf("#%d", i)
+		} else if names[name] {
+			thresholdErrs = append(thresholdErrs, "duplicated name")
+		}
+		names[name] = true
+
+		for _, e := range thresholdErrs {
+			errs = append(errs, fmt.Sprintf("threshold %s: %s", name, e))
+		}
+		thresholds = append(thresholds, threshold)
+	}
+
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("Invalid thresholds: %s", strings.Join(errs, "; "))
+	}
+	return NewThresholds(thresholds), nil
+}
+
+func (c ThresholdConfig) threshold() (Threshold, []string) {
+	var errs []string
+	if len(c.Services) == 0 {
+		errs = append(errs, "services are required")
+	}
+	for _, pattern := range c.Services {
+		if _, err := path.Match(pattern, ""); err != nil {
+			errs = append(errs, fmt.Sprintf("invalid pattern %q", pattern))
+		}
+	}
+
+	below := false
+	switch c.Direction {
+	case "", DirectionAbove:
+	case DirectionBelow:
+		below = true
+	default:
+		errs = append(errs, fmt.Sprintf("direction must be %s or %s", DirectionAbove, DirectionBelow))
+	}
+
+	if c.Warning == nil && c.Critical == nil {
+		errs = append(errs, "warning or critical is required")
+	} else if c.Warning != nil && c.Critical != nil {
+		if !below && *c.Warning > *c.Critical {
+			errs = append(errs, "warning must not be greater than critical")
+		} else if below && *c.Warning < *c.Critical {
+			errs = append(errs, "warning must not be less than critical when direction is below")
+		}
+	}
+	if c.Window < 0 {
+		errs = append(errs, "window must not be negative")
+	}
+
+	return Threshold{
+		Name:     c.Name,
+		Services: c.Services,
+		Warning:  c.Warning,
+		Critical: c.Critical,
+		Below:    below,
+		Window:   c.Window,
+		Override: c.Override,
+	}, errs
+}
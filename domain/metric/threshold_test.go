@@ -0,0 +1,173 @@
+package metric
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestThresholdState(t *testing.T) {
+	above := &Threshold{Warning: float(70), Critical: float(90)}
+	below := &Threshold{Warning: float(20), Critical: float(10), Below: true}
+	onlyCritical := &Threshold{Critical: float(90)}
+	tests := []struct {
+		threshold *Threshold
+		value     float64
+		want      MetricState
+	}{
+		{above, 50, MetricOK},
+		{above, 70, MetricWarning},
+		{above, 89.9, MetricWarning},
+		{above, 90, MetricCritical},
+		{below, 50, MetricOK},
+		{below, 20, MetricWarning},
+		{below, 5, MetricCritical},
+		{onlyCritical, 80, MetricOK},
+		{onlyCritical, 95, MetricCritical},
+	}
+	for _, tt := range tests {
+		if got := tt.threshold.State(tt.value); got != tt.want {
+			t.Errorf("State(%v) with %+v = %s, want %s", tt.value, tt.threshold, got, tt.want)
+		}
+	}
+}
+
+func TestMovingAverage(t *testing.T) {
+	start := time.Now()
+	ma := &movingAverage{window: time.Minute}
+	tests := []struct {
+		at    time.Duration
+		value float64
+		want  float64
+	}{
+		{0, 10, 10},
+		{20 * time.Second, 20, 15},
+		{40 * time.Second, 60, 30},
+		// The first sample is at the edge of the window and is kept
+		{time.Minute, 30, 30},
+		{70 * time.Second, 10, 30},
+		// Only the last sample is in the window
+		{3 * time.Minute, 4, 4},
+	}
+	for _, tt := range tests {
+		if got := ma.add(start.Add(tt.at), tt.value); got != tt.want {
+			t.Errorf("average at %s = %v, want %v", tt.at, got, tt.want)
+		}
+	}
+	if len(ma.samples) != 1 || ma.sum != 4 {
+		t.Fatalf("%d samples with sum %v kept, want 1 and 4", len(ma.samples), ma.sum)
+	}
+}
+
+func thresholdMetric(service, host string, value float64, state MetricState) *MetricPayload {
+	m := validMetric()
+	m.Service, m.Host, m.Metric.Metric, m.State = service, host, FloatValue(value), state
+	return m
+}
+
+func TestThresholdsApply(t *testing.T) {
+	thresholds := NewThresholds([]Threshold{
+		{Name: "latency", Services: []string{"api.latency"}, Warning: float(100), Critical: float(500), Override: true},
+		{Name: "memory", Services: []string{"*.memory_free"}, Warning: float(20), Critical: float(10), Below: true},
+		// The default of the other services of the api
+		{Name: "default", Services: []string{"api.*"}, Critical: float(1)},
+	})
+	tests := []struct {
+		name    string
+		service string
+		value   float64
+		state   MetricState
+		want    MetricState
+	}{
+		{"service threshold", "api.latency", 200, "", MetricWarning},
+		{"service threshold over the default", "api.latency", 50, "", MetricOK},
+		{"override", "api.latency", 600, MetricOK, MetricCritical},
+		{"below", "db.memory_free", 5, "", MetricCritical},
+		{"state kept", "db.memory_free", 5, MetricOK, MetricOK},
+		{"default", "api.errors", 1, "", MetricCritical},
+		{"default kept state", "api.errors", 1, MetricWarning, MetricWarning},
+		{"no threshold", "web.latency", 1000, "", MetricOK},
+		{"no threshold kept state", "web.latency", 1000, MetricError, MetricError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := thresholdMetric(tt.service, "h", tt.value, tt.state)
+			thresholds.Apply(m)
+			if m.State != tt.want {
+				t.Fatalf("state = %s, want %s", m.State, tt.want)
+			}
+		})
+	}
+
+	var none *Thresholds
+	m := thresholdMetric("api.latency", "h", 1000, "")
+	none.Apply(m)
+	if m.State != MetricOK {
+		t.Fatalf("state = %q without thresholds, want ok", m.State)
+	}
+}
+
+func TestThresholdsWindow(t *testing.T) {
+	thresholds := NewThresholds([]Threshold{
+		{Services: []string{"api.latency"}, Warning: float(100), Window: time.Hour},
+	})
+	apply := func(host string, value float64) MetricState {
+		m := thresholdMetric("api.latency", host, value, "")
+		thresholds.Apply(m)
+		return m.State
+	}
+
+	if state := apply("a", 150); state != MetricWarning {
+		t.Fatalf("state = %s, want warning", state)
+	}
+	// The average of 150 and 30 is below the warning
+	if state := apply("a", 30); state != MetricOK {
+		t.Fatalf("state = %s, want ok", state)
+	}
+	// The averages are kept by host
+	if state := apply("b", 120); state != MetricWarning {
+		t.Fatalf("state of the other host = %s, want warning", state)
+	}
+	if len(thresholds.averages) != 2 {
+		t.Fatalf("%d averages, want one by host", len(thresholds.averages))
+	}
+
+	// The averages without samples in the window are removed
+	thresholds.sweep(time.Now().Add(2 * time.Hour))
+	if len(thresholds.averages) != 0 {
+		t.Fatalf("%d averages kept after the window", len(thresholds.averages))
+	}
+}
+
+func TestThresholdsConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		config ThresholdConfig
+		err    string
+	}{
+		{"valid", ThresholdConfig{Services: []string{"api.*"}, Warning: float(1), Critical: float(2)}, ""},
+		{"below", ThresholdConfig{Services: []string{"api.*"}, Warning: float(2), Critical: float(1), Direction: DirectionBelow}, ""},
+		{"no services", ThresholdConfig{Critical: float(1)}, "services are required"},
+		{"invalid pattern", ThresholdConfig{Services: []string{"["}, Critical: float(1)}, `invalid pattern "["`},
+		{"unknown direction", ThresholdConfig{Services: []string{"a"}, Critical: float(1), Direction: "up"}, "direction must be above or below"},
+		{"no boundary", ThresholdConfig{Services: []string{"a"}}, "warning or critical is required"},
+		{"warning above critical", ThresholdConfig{Services: []string{"a"}, Warning: float(2), Critical: float(1)}, "warning must not be greater than critical"},
+		{"warning below critical", ThresholdConfig{Services: []string{"a"}, Warning: float(1), Critical: float(2), Direction: DirectionBelow}, "warning must not be less than critical"},
+		{"negative window", ThresholdConfig{Services: []string{"a"}, Critical: float(1), Window: -time.Second}, "window must not be negative"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tc := &ThresholdsConfig{Thresholds: []ThresholdConfig{tt.config}}
+			_, err := tc.Build()
+			if tt.err == "" {
+				if err != nil {
+					t.Fatalf("Build: %s", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("Build() error = %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,193 @@
+package metric
+
+import (
+	"net"
+	"os"
+	"path"
+)
+
+// MetricCondition compares the metric value, the nil bounds are not checked
+type MetricCondition struct {
+	GT  *float64
+	GTE *float64
+	LT  *float64
+	LTE *float64
+}
+
+func (mc *MetricCondition) Matches(v *Value) bool {
+	f := v.Float64()
+	return (mc.GT == nil || f > *mc.GT) &&
+		(mc.GTE == nil || f >= *mc.GTE) &&
+		(mc.LT == nil || f < *mc.LT) &&
+		(mc.LTE == nil || f <= *mc.LTE)
+}
+
+// Condition selects the metrics of a transform rule. Services, hosts and the
+// attribute values are glob patterns, all the tags are required. The empty
+// fields match any metric.
+type Condition struct {
+	Services   []string
+	Hosts      []string
+	Tags       []string
+	Attributes map[string]string
+	Metric     *MetricCondition
+}
+
+func (c *Condition) Matches(m *MetricPayload) bool {
+	if !globAny(c.Services, m.Service) || !globAny(c.Hosts, m.Host) {
+		return false
+	}
+	for _, tag := range c.Tags {
+		if !hasTag(m.Tags, tag) {
+			return false
+		}
+	}
+	for key, pattern := range c.Attributes {
+		value, found := m.Attributes[key]
+		if !found {
+			return false
+		}
+		if ok, _ := path.Match(pattern, value); !ok {
+			return false
+		}
+	}
+	return c.Metric == nil || c.Metric.Matches(m.Metric.Metric)
+}
+
+func globAny(patterns []string, value string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, value); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func hasTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// Action changes a metric, it returns false to drop it
+type Action interface {
+	Apply(m *MetricPayload) bool
+}
+
+// expand replaces ${name} with the value of the attribute name
+func expand(s string, m *MetricPayload) string {
+	return os.Expand(s, func(name string) string {
+		return m.Attributes[name]
+	})
+}
+
+type RenameService struct {
+	Service string
+}
+
+func (a *RenameService) Apply(m *MetricPayload) bool {
+	m.Service = expand(a.Service, m)
+	return true
+}
+
+type DropAttributes struct {
+	Attributes []string
+}
+
+func (a *DropAttributes) Apply(m *MetricPayload) bool {
+	for _, key := range a.Attributes {
+		delete(m.Attributes, key)
+	}
+	return true
+}
+
+// MaskIP keeps the network prefix of the IP in Attribute. Values that are
+// not an IP are dropped.
+type MaskIP struct {
+	Attribute  string
+	IPv4Prefix int
+	IPv6Prefix int
+}
+
+func (a *MaskIP) Apply(m *MetricPayload) bool {
+	value, found := m.Attributes[a.Attribute]
+	if !found {
+		return true
+	}
+	ip := net.ParseIP(value)
+	if ip == nil {
+		delete(m.Attributes, a.Attribute)
+		return true
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		m.Attributes[a.Attribute] = ip4.Mask(net.CIDRMask(a.IPv4Prefix, 32)).String()
+	} else {
+		m.Attributes[a.Attribute] = ip.Mask(net.CIDRMask(a.IPv6Prefix, 128)).String()
+	}
+	return true
+}
+
+type AddTags struct {
+	Tags []string
+}
+
+func (a *AddTags) Apply(m *MetricPayload) bool {
+	for _, tag := range a.Tags {
+		if tag = expand(tag, m); tag != "" && !hasTag(m.Tags, tag) {
+			m.Tags = append(m.Tags, tag)
+		}
+	}
+	return true
+}
+
+type SetState struct {
+	State MetricState
+}
+
+func (a *SetState) Apply(m *MetricPayload) bool {
+	m.State = a.State
+	return true
+}
+
+type Drop struct{}
+
+func (a *Drop) Apply(m *MetricPayload) bool {
+	return false
+}
+
+type TransformRule struct {
+	Name    string
+	When    Condition
+	Actions []Action
+}
+
+// Transformer rewrites the metrics before they are sent to riemann. The rules
+// are applied in order, every matching rule runs all its actions.
+type Transformer struct {
+	Rules []TransformRule
+}
+
+// Transform applies the rules to the metric, it returns false if the metric
+// must be dropped.
+func (t *Transformer) Transform(m *MetricPayload) bool {
+	if t == nil {
+		return true
+	}
+	for _, rule := range t.Rules {
+		if !rule.When.Matches(m) {
+			continue
+		}
+		for _, action := range rule.Actions {
+			if !action.Apply(m) {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,212 @@
+package metric
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+type MetricConditionConfig struct {
+	GT  *float64 `yaml:"gt"`
+	GTE *float64 `yaml:"gte"`
+	LT  *float64 `yaml:"lt"`
+	LTE *float64 `yaml:"lte"`
+}
+
+type ConditionConfig struct {
+	Services   []string               `yaml:"services"`
+	Hosts      []string               `yaml:"hosts"`
+	Tags       []string               `yaml:"tags"`
+	Attributes map[string]string      `yaml:"attributes"`
+	Metric     *MetricConditionConfig `yaml:"metric"`
+}
+
+// MaskIPConfig has pointers to the prefixes, 0 masks the whole IP and nil
+// keeps the default
+type MaskIPConfig struct {
+	Attribute  string `yaml:"attribute"`
+	IPv4Prefix *int   `yaml:"ipv4_prefix"`
+	IPv6Prefix *int   `yaml:"ipv6_prefix"`
+}
+
+// ActionConfig must have exactly one field set
+type ActionConfig struct {
+	RenameService  string        `yaml:"rename_service"`
+	DropAttributes []string      `yaml:"drop_attributes"`
+	MaskIP         *MaskIPConfig `yaml:"mask_ip"`
+	AddTags        []string      `yaml:"add_tags"`
+	SetState       string        `yaml:"set_state"`
+	Drop           bool          `yaml:"drop"`
+}
+
+type TransformRuleConfig struct {
+	Name    string          `yaml:"name"`
+	When    ConditionConfig `yaml:"when"`
+	Actions []ActionConfig  `yaml:"actions"`
+}
+
+// TransformsConfig is the content of a transforms file
+type TransformsConfig struct {
+	Transforms []TransformRuleConfig `yaml:"transforms"`
+}
+
+// LoadTransformer reads the transforms file in path. Without a path there
+// are no transforms. The states set by the transforms must be in states,
+// any state is accepted if it is empty.
+func LoadTransformer(path string, states []string) (*Transformer, error) {
+	if path == "" {
+		return nil, nil
+	}
+	tc, err := ReadTransforms(path)
+	if err != nil {
+		return nil, err
+	}
+	return tc.Transformer(states)
+}
+
+// ReadTransforms parses the transforms file in path. Unknown fields are
+// rejected.
+func ReadTransforms(path string) (*TransformsConfig, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot open transforms file: %s", err)
+	}
+	defer f.Close()
+
+	tc := &TransformsConfig{}
+	decoder := yaml.NewDecoder(f)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(tc); err != nil {
+		return nil, fmt.Errorf("Invalid transforms file %s: %s", path, err)
+	}
+	return tc, nil
+}
+
+// Transformer validates every rule and builds the Transformer. All the
+// validation errors are reported at once.
+func (tc *TransformsConfig) Transformer(states []string) (*Transformer, error) {
+	var errs []string
+	names := make(map[string]bool)
+	rules := make([]TransformRule, 0, len(tc.Transforms))
+	for i, r := range tc.Transforms {
+		rule, ruleErrs := r.rule(states)
+		name := r.Name
+		if name == "" {
+			name = fmt.Sprintf("#%d", i)
+		} else if names[name] {
+			ruleErrs = append(ruleErrs, "duplicated name")
+		}
+		names[name] = true
+
+		for _, e := range ruleErrs {
+			errs = append(errs, fmt.Sprintf("transform %s: %s", name, e))
+		}
+		rules = append(rules, rule)
+	}
+
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("Invalid transforms: %s", strings.Join(errs, "; "))
+	}
+	return &Transformer{Rules: rules}, nil
+}
+
+func (r TransformRuleConfig) rule(states []string) (TransformRule, []string) {
+	var errs []string
+	patterns := append(append([]string{}, r.When.Services...), r.When.Hosts...)
+	for _, pattern := range r.When.Attributes {
+		patterns = append(patterns, pattern)
+	}
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			errs = append(errs, fmt.Sprintf("invalid pattern %q", pattern))
+		}
+	}
+
+	when := Condition{
+		Services:   r.When.Services,
+		Hosts:      r.When.Hosts,
+		Tags:       r.When.Tags,
+		Attributes: r.When.Attributes,
+	}
+	if mc := r.When.Metric; mc != nil {
+		when.Metric = &MetricCondition{GT: mc.GT, GTE: mc.GTE, LT: mc.LT, LTE: mc.LTE}
+	}
+
+	if len(r.Actions) == 0 {
+		errs = append(errs, "actions are required")
+	}
+	actions := make([]Action, 0, len(r.Actions))
+	for i, ac := range r.Actions {
+		action, err := ac.action(states)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("action #%d: %s", i, err))
+			continue
+		}
+		actions = append(actions, action)
+	}
+
+	return TransformRule{Name: r.Name, When: when, Actions: actions}, errs
+}
+
+func (ac ActionConfig) action(states []string) (Action, error) {
+	var actions []Action
+	if ac.RenameService != "" {
+		actions = append(actions, &RenameService{Service: ac.RenameService})
+	}
+	if len(ac.DropAttributes) > 0 {
+		actions = append(actions, &DropAttributes{Attributes: ac.DropAttributes})
+	}
+	if ac.MaskIP != nil {
+		mask, err := ac.MaskIP.action()
+		if err != nil {
+			return nil, err
+		}
+		actions = append(actions, mask)
+	}
+	if len(ac.AddTags) > 0 {
+		actions = append(actions, &AddTags{Tags: ac.AddTags})
+	}
+	if ac.SetState != "" {
+		if len(states) > 0 && !contains(states, ac.SetState) {
+			return nil, fmt.Errorf("set_state %q must be one of: %s", ac.SetState, strings.Join(states, ", "))
+		}
+		actions = append(actions, &SetState{State: MetricState(ac.SetState)})
+	}
+	if ac.Drop {
+		actions = append(actions, &Drop{})
+	}
+
+	if len(actions) != 1 {
+		return nil, fmt.Errorf("exactly one of rename_service, drop_attributes, mask_ip, add_tags, set_state or drop is required")
+	}
+	return actions[0], nil
+}
+
+func (mc MaskIPConfig) action() (*MaskIP, error) {
+	mask := &MaskIP{Attribute: mc.Attribute, IPv4Prefix: 24, IPv6Prefix: 48}
+	if mask.Attribute == "" {
+		mask.Attribute = "ip"
+	}
+	if mc.IPv4Prefix != nil {
+		mask.IPv4Prefix = *mc.IPv4Prefix
+	}
+	if mc.IPv6Prefix != nil {
+		mask.IPv6Prefix = *mc.IPv6Prefix
+	}
+	if mask.IPv4Prefix < 0 || mask.IPv4Prefix > 32 || mask.IPv6Prefix < 0 || mask.IPv6Prefix > 128 {
+		return nil, fmt.Errorf("mask_ip prefixes must be between 0 and 32 for IPv4 and 128 for IPv6")
+	}
+	return mask, nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,221 @@
+package metric
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func transformMetric() *MetricPayload {
+	m := validMetric()
+	m.Tags = []string{"web"}
+	m.Attributes = map[string]string{"ip": "192.168.10.42", "env": "prod", "app": "shop"}
+	return m
+}
+
+func float(f float64) *float64 {
+	return &f
+}
+
+func prefix(i int) *int {
+	return &i
+}
+
+func TestConditionMatches(t *testing.T) {
+	tests := []struct {
+		name string
+		when Condition
+		want bool
+	}{
+		{"empty", Condition{}, true},
+		{"service glob", Condition{Services: []string{"web.*", "api.*"}}, true},
+		{"other service", Condition{Services: []string{"web.*"}}, false},
+		{"host", Condition{Hosts: []string{"h"}}, true},
+		{"other host", Condition{Hosts: []string{"db-*"}}, false},
+		{"tags", Condition{Tags: []string{"web"}}, true},
+		{"every tag required", Condition{Tags: []string{"web", "db"}}, false},
+		{"attribute glob", Condition{Attributes: map[string]string{"ip": "192.168.*", "env": "prod"}}, true},
+		{"other attribute value", Condition{Attributes: map[string]string{"env": "dev"}}, false},
+		{"missing attribute", Condition{Attributes: map[string]string{"user": "*"}}, false},
+		{"metric bounds", Condition{Metric: &MetricCondition{GT: float(0), LTE: float(1)}}, true},
+		{"metric above", Condition{Metric: &MetricCondition{LT: float(1)}}, false},
+		{"metric below", Condition{Metric: &MetricCondition{GTE: float(2)}}, false},
+		{"every field", Condition{
+			Services:   []string{"api.*"},
+			Hosts:      []string{"h"},
+			Tags:       []string{"web"},
+			Attributes: map[string]string{"env": "prod"},
+			Metric:     &MetricCondition{GTE: float(1)},
+		}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.when.Matches(transformMetric()); got != tt.want {
+				t.Fatalf("Matches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestActions(t *testing.T) {
+	tests := []struct {
+		name   string
+		action Action
+		change func(m *MetricPayload)
+		drop   bool
+	}{
+		{"rename service", &RenameService{Service: "shop.${env}.latency"}, func(m *MetricPayload) {
+			m.Service = "shop.prod.latency"
+		}, false},
+		{"rename with a missing attribute", &RenameService{Service: "${user}.latency"}, func(m *MetricPayload) {
+			m.Service = ".latency"
+		}, false},
+		{"drop attributes", &DropAttributes{Attributes: []string{"env", "user"}}, func(m *MetricPayload) {
+			delete(m.Attributes, "env")
+		}, false},
+		{"mask ipv4", &MaskIP{Attribute: "ip", IPv4Prefix: 24, IPv6Prefix: 48}, func(m *MetricPayload) {
+			m.Attributes["ip"] = "192.168.10.0"
+		}, false},
+		{"mask ipv4 prefix 0", &MaskIP{Attribute: "ip", IPv4Prefix: 0, IPv6Prefix: 48}, func(m *MetricPayload) {
+			m.Attributes["ip"] = "0.0.0.0"
+		}, false},
+		{"mask other attribute", &MaskIP{Attribute: "client", IPv4Prefix: 24, IPv6Prefix: 48}, func(m *MetricPayload) {}, false},
+		{"mask not an ip", &MaskIP{Attribute: "env", IPv4Prefix: 24, IPv6Prefix: 48}, func(m *MetricPayload) {
+			delete(m.Attributes, "env")
+		}, false},
+		{"add tags", &AddTags{Tags: []string{"web", "${env}", "${user}", "shop"}}, func(m *MetricPayload) {
+			m.Tags = []string{"web", "prod", "shop"}
+		}, false},
+		{"set state", &SetState{State: "critical"}, func(m *MetricPayload) {
+			m.State = "critical"
+		}, false},
+		{"drop", &Drop{}, func(m *MetricPayload) {}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := transformMetric()
+			want := transformMetric()
+			tt.change(want)
+			if got := tt.action.Apply(m); got == tt.drop {
+				t.Fatalf("Apply() = %v, want %v", got, !tt.drop)
+			}
+			if !reflect.DeepEqual(m, want) {
+				t.Fatalf("Apply() metric = %+v, want %+v", m.Metric, want.Metric)
+			}
+		})
+	}
+}
+
+func TestMaskIPv6(t *testing.T) {
+	tests := []struct {
+		prefix int
+		want   string
+	}{
+		{48, "2001:db8:1::"},
+		{0, "::"},
+	}
+	for _, tt := range tests {
+		m := transformMetric()
+		m.Attributes["ip"] = "2001:db8:1:2::42"
+		(&MaskIP{Attribute: "ip", IPv4Prefix: 24, IPv6Prefix: tt.prefix}).Apply(m)
+		if m.Attributes["ip"] != tt.want {
+			t.Errorf("prefix %d masked the ip to %s, want %s", tt.prefix, m.Attributes["ip"], tt.want)
+		}
+	}
+}
+
+func TestTransform(t *testing.T) {
+	transformer := &Transformer{Rules: []TransformRule{
+		{Name: "rename", When: Condition{Services: []string{"api.*"}}, Actions: []Action{
+			&RenameService{Service: "shop.${env}"},
+			&AddTags{Tags: []string{"renamed"}},
+		}},
+		// Matches the renamed service
+		{Name: "state", When: Condition{Services: []string{"shop.*"}}, Actions: []Action{
+			&SetState{State: "warning"},
+		}},
+		{Name: "skipped", When: Condition{Hosts: []string{"db"}}, Actions: []Action{
+			&Drop{},
+		}},
+		{Name: "drop", When: Condition{Attributes: map[string]string{"env": "dev"}}, Actions: []Action{
+			&Drop{},
+			&AddTags{Tags: []string{"not-run"}},
+		}},
+		{Name: "not run", Actions: []Action{
+			&AddTags{Tags: []string{"last"}},
+		}},
+	}}
+
+	m := transformMetric()
+	if !transformer.Transform(m) {
+		t.Fatal("the metric was dropped")
+	}
+	if m.Service != "shop.prod" || m.State != "warning" || !reflect.DeepEqual(m.Tags, []string{"web", "renamed", "last"}) {
+		t.Fatalf("transformed to %+v", m.Metric)
+	}
+
+	m = transformMetric()
+	m.Attributes["env"] = "dev"
+	if transformer.Transform(m) {
+		t.Fatal("the metric was not dropped")
+	}
+	if hasTag(m.Tags, "not-run") || hasTag(m.Tags, "last") {
+		t.Fatalf("actions ran after the drop: %v", m.Tags)
+	}
+
+	var none *Transformer
+	if !none.Transform(transformMetric()) {
+		t.Fatal("the nil transformer dropped the metric")
+	}
+}
+
+func TestTransformsConfig(t *testing.T) {
+	states := []string{"ok", "warning", "critical"}
+	tests := []struct {
+		name    string
+		actions []ActionConfig
+		want    Action
+		err     string
+	}{
+		{"rename", []ActionConfig{{RenameService: "a"}}, &RenameService{Service: "a"}, ""},
+		{"mask defaults", []ActionConfig{{MaskIP: &MaskIPConfig{}}}, &MaskIP{Attribute: "ip", IPv4Prefix: 24, IPv6Prefix: 48}, ""},
+		{"mask prefix 0", []ActionConfig{{MaskIP: &MaskIPConfig{Attribute: "client", IPv4Prefix: prefix(0), IPv6Prefix: prefix(0)}}}, &MaskIP{Attribute: "client", IPv4Prefix: 0, IPv6Prefix: 0}, ""},
+		{"mask invalid prefix", []ActionConfig{{MaskIP: &MaskIPConfig{IPv4Prefix: prefix(33)}}}, nil, "mask_ip prefixes"},
+		{"allowed state", []ActionConfig{{SetState: "critical"}}, &SetState{State: "critical"}, ""},
+		{"unknown state", []ActionConfig{{SetState: "broken"}}, nil, `set_state "broken" must be one of: ok, warning, critical`},
+		{"no action", []ActionConfig{{}}, nil, "exactly one of"},
+		{"two fields", []ActionConfig{{RenameService: "a", Drop: true}}, nil, "exactly one of"},
+		{"no actions", nil, nil, "actions are required"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tc := &TransformsConfig{Transforms: []TransformRuleConfig{{Name: "rule", Actions: tt.actions}}}
+			transformer, err := tc.Transformer(states)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("Transformer() error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Transformer: %s", err)
+			}
+			if got := transformer.Rules[0].Actions[0]; !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("action = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTransformsConfigErrors(t *testing.T) {
+	tc := &TransformsConfig{Transforms: []TransformRuleConfig{
+		{Name: "a", When: ConditionConfig{Services: []string{"["}}, Actions: []ActionConfig{{Drop: true}}},
+		{Name: "a", Actions: []ActionConfig{{Drop: true}}},
+		{Actions: []ActionConfig{{SetState: "anything"}}},
+	}}
+	_, err := tc.Transformer(nil)
+	want := `Invalid transforms: transform a: invalid pattern "["; transform a: duplicated name`
+	if err == nil || err.Error() != want {
+		t.Fatalf("Transformer() error = %v, want %q", err, want)
+	}
+}
@@ -0,0 +1,44 @@
+package metric
+
+const (
+	TransportTCP = "tcp"
+	TransportUDP = "udp"
+)
+
+// Transports chooses the publisher of every event. The transport of the
+// payload has priority, then the UDP services and then the default.
+type Transports struct {
+	TCP Publisher
+	// UDP is nil when UDP is disabled, the events are sent by TCP
+	UDP         Publisher
+	Default     string
+	UDPServices map[string]bool
+}
+
+func NewTransports(tcp Publisher, defaultTransport string, udpServices []string) *Transports {
+	services := make(map[string]bool)
+	for _, service := range udpServices {
+		services[service] = true
+	}
+	return &Transports{
+		TCP:         tcp,
+		Default:     defaultTransport,
+		UDPServices: services,
+	}
+}
+
+func (t *Transports) Transport(m *MetricPayload) string {
+	if t.UDP == nil {
+		return TransportTCP
+	}
+	if m.Transport != "" {
+		return m.Transport
+	}
+	if t.UDPServices[m.Service] {
+		return TransportUDP
+	}
+	if t.Default == TransportUDP {
+		return TransportUDP
+	}
+	return TransportTCP
+}
@@ -0,0 +1,74 @@
+package metric
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"gopkg.in/go-playground/validator.v9"
+)
+
+func init() {
+	// Report the fields with their JSON names
+	validate.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name := strings.SplitN(field.Tag.Get("json"), ",", 2)[0]
+		if name == "-" {
+			return ""
+		}
+		return name
+	})
+}
+
+type FieldError struct {
+	Field string `json:"field"`
+	Error string `json:"error"`
+}
+
+// ValidationError lists every invalid field of a metric
+type ValidationError struct {
+	Errors []FieldError
+}
+
+func (e *ValidationError) Add(field, format string, args ...interface{}) {
+	e.Errors = append(e.Errors, FieldError{Field: field, Error: fmt.Sprintf(format, args...)})
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, fe := range e.Errors {
+		msgs[i] = fmt.Sprintf("%s %s", fe.Field, fe.Error)
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// fieldErrors returns the field errors of err, if it is a validation error
+func fieldErrors(err error) []FieldError {
+	var validationErr *ValidationError
+	if errors.As(err, &validationErr) {
+		return validationErr.Errors
+	}
+	return nil
+}
+
+// addStructErrors adds the errors of the struct tags validation
+func (e *ValidationError) addStructErrors(err error) {
+	var validationErrs validator.ValidationErrors
+	if !errors.As(err, &validationErrs) {
+		e.Add("metric", "%s", err)
+		return
+	}
+
+	for _, fe := range validationErrs {
+		switch fe.Tag() {
+		case "required":
+			e.Add(fe.Field(), "is required")
+		case "gte":
+			e.Add(fe.Field(), "must be greater or equal than %s", fe.Param())
+		case "oneof":
+			e.Add(fe.Field(), "must be one of: %s", strings.Join(strings.Fields(fe.Param()), ", "))
+		default:
+			e.Add(fe.Field(), "failed on the %s validation", fe.Tag())
+		}
+	}
+}
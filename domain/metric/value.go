@@ -0,0 +1,115 @@
+package metric
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// valueError is an invalid value of a well formed JSON field
+type valueError struct {
+	msg string
+}
+
+func (e *valueError) Error() string {
+	return e.msg
+}
+
+func invalidValue(format string, args ...interface{}) error {
+	return &valueError{msg: fmt.Sprintf(format, args...)}
+}
+
+// Value is an integer or floating point metric. Integers are sent to riemann
+// as metric_sint64 and floats as metric_d.
+type Value struct {
+	Int     int64
+	Float   float64
+	IsFloat bool
+}
+
+func IntValue(i int64) *Value {
+	return &Value{Int: i}
+}
+
+func FloatValue(f float64) *Value {
+	return &Value{Float: f, IsFloat: true}
+}
+
+func (v *Value) UnmarshalJSON(data []byte) error {
+	var n json.Number
+	if bytes.HasPrefix(data, []byte(`"`)) || json.Unmarshal(data, &n) != nil {
+		return invalidValue("Invalid metric %s, a number is required", data)
+	}
+	s := n.String()
+	if !strings.ContainsAny(s, ".eE") {
+		if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+			*v = Value{Int: i}
+			return nil
+		}
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsInf(f, 0) {
+		return invalidValue("Invalid metric %s", s)
+	}
+	*v = Value{Float: f, IsFloat: true}
+	return nil
+}
+
+func (v Value) MarshalJSON() ([]byte, error) {
+	if v.IsFloat {
+		return json.Marshal(v.Float)
+	}
+	return json.Marshal(v.Int)
+}
+
+func (v Value) Float64() float64 {
+	if v.IsFloat {
+		return v.Float
+	}
+	return float64(v.Int)
+}
+
+// Riemann returns the value with the type expected by the riemann client
+func (v Value) Riemann() interface{} {
+	if v.IsFloat {
+		return v.Float
+	}
+	return v.Int
+}
+
+// Timestamp is the time of an event, as an RFC3339 string or Unix seconds
+// with an optional fraction.
+type Timestamp struct {
+	time.Time
+}
+
+func (t *Timestamp) UnmarshalJSON(data []byte) error {
+	if bytes.HasPrefix(data, []byte(`"`)) {
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		parsed, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			return invalidValue("Invalid time %q, RFC3339 or Unix seconds are required", s)
+		}
+		t.Time = parsed
+		return nil
+	}
+
+	seconds, err := strconv.ParseFloat(string(data), 64)
+	if err != nil || math.IsInf(seconds, 0) {
+		return invalidValue("Invalid time %s, RFC3339 or Unix seconds are required", data)
+	}
+	whole, frac := math.Modf(seconds)
+	t.Time = time.Unix(int64(whole), int64(frac*1e9))
+	return nil
+}
+
+func (t Timestamp) MarshalJSON() ([]byte, error) {
+	return json.Marshal(t.Time.UTC().Format(time.RFC3339Nano))
+}
@@ -0,0 +1,104 @@
+package metric
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestValueUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		input string
+		want  Value
+		err   bool
+	}{
+		{`42`, Value{Int: 42}, false},
+		{`-7`, Value{Int: -7}, false},
+		{`1.5`, Value{Float: 1.5, IsFloat: true}, false},
+		{`1e3`, Value{Float: 1000, IsFloat: true}, false},
+		{`0.0`, Value{Float: 0, IsFloat: true}, false},
+		// Too large for an int64
+		{`9223372036854775808`, Value{Float: 9223372036854775808, IsFloat: true}, false},
+		{`1e400`, Value{}, true},
+		{`"42"`, Value{}, true},
+		{`true`, Value{}, true},
+		{`null`, Value{}, true},
+		{`{}`, Value{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			var v Value
+			err := json.Unmarshal([]byte(tt.input), &v)
+			if (err != nil) != tt.err {
+				t.Fatalf("err = %v", err)
+			}
+			if err == nil && v != tt.want {
+				t.Fatalf("value = %+v, want %+v", v, tt.want)
+			}
+		})
+	}
+}
+
+func TestValueMarshalJSON(t *testing.T) {
+	tests := []struct {
+		value Value
+		want  string
+	}{
+		{Value{Int: 42}, `42`},
+		{Value{Float: 1.5, IsFloat: true}, `1.5`},
+	}
+	for _, tt := range tests {
+		data, err := json.Marshal(tt.value)
+		if err != nil || string(data) != tt.want {
+			t.Fatalf("Marshal(%+v) = %s, %v, want %s", tt.value, data, err, tt.want)
+		}
+	}
+}
+
+func TestTimestampUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		input string
+		want  time.Time
+		err   bool
+	}{
+		{`"2021-06-01T10:00:00Z"`, time.Date(2021, 6, 1, 10, 0, 0, 0, time.UTC), false},
+		{`"2021-06-01T12:00:00.5+02:00"`, time.Date(2021, 6, 1, 10, 0, 0, 5e8, time.UTC), false},
+		{`1622541600`, time.Date(2021, 6, 1, 10, 0, 0, 0, time.UTC), false},
+		{`1622541600.25`, time.Date(2021, 6, 1, 10, 0, 0, 25e7, time.UTC), false},
+		{`"2021-06-01"`, time.Time{}, true},
+		{`"yesterday"`, time.Time{}, true},
+		{`1e400`, time.Time{}, true},
+		{`true`, time.Time{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			var ts Timestamp
+			err := json.Unmarshal([]byte(tt.input), &ts)
+			if (err != nil) != tt.err {
+				t.Fatalf("err = %v", err)
+			}
+			if err == nil && !ts.Time.Equal(tt.want) {
+				t.Fatalf("time = %s, want %s", ts.Time, tt.want)
+			}
+		})
+	}
+}
+
+func TestMetricPayloadJSON(t *testing.T) {
+	var m Metric
+	input := `{"service":"s","description":"d","host":"h","metric":0.25,"time":1622541600}`
+	if err := json.Unmarshal([]byte(input), &m); err != nil {
+		t.Fatal(err)
+	}
+	if m.Metric == nil || m.Metric.Float64() != 0.25 || m.Time == nil {
+		t.Fatalf("metric = %+v", m)
+	}
+	data, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var back Metric
+	if err := json.Unmarshal(data, &back); err != nil || !back.Time.Equal(m.Time.Time) || *back.Metric != *m.Metric {
+		t.Fatalf("round trip = %s, %v", data, err)
+	}
+}
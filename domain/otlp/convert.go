@@ -0,0 +1,265 @@
+package otlp
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"riemannhttp/domain/metric"
+)
+
+var errNoName = errors.New("metric name is required")
+
+// Converter maps the OTLP data points and log records to metrics
+type Converter struct {
+	// HostAttributes are the resource attributes used as the host, the
+	// first one found
+	HostAttributes []string
+	// ResourceAttributes copied to the attributes of the metrics, all of
+	// them if empty
+	ResourceAttributes []string
+	// LogService is the service of the log records
+	LogService string
+}
+
+// Item is a converted metric, or the error of a data point or log record
+// that can not be converted
+type Item struct {
+	Metric *metric.MetricPayload
+	Err    error
+}
+
+// resource returns the host and the attributes of a resource
+func (c *Converter) resource(r Resource) (string, map[string]string) {
+	values := make(map[string]string, len(r.Attributes))
+	for _, kv := range r.Attributes {
+		values[kv.Key] = kv.Value.String()
+	}
+
+	host := ""
+	for _, key := range c.HostAttributes {
+		if value := values[key]; value != "" {
+			host = value
+			delete(values, key)
+			break
+		}
+	}
+
+	if len(c.ResourceAttributes) == 0 {
+		return host, values
+	}
+	attributes := make(map[string]string, len(c.ResourceAttributes))
+	for _, key := range c.ResourceAttributes {
+		if value, ok := values[key]; ok {
+			attributes[key] = value
+		}
+	}
+	return host, attributes
+}
+
+// attributes merges the resource attributes and the data point attributes,
+// the data point ones win
+func attributes(resource map[string]string, kvs []KeyValue) map[string]string {
+	attributes := make(map[string]string, len(resource)+len(kvs))
+	for k, v := range resource {
+		attributes[k] = v
+	}
+	for _, kv := range kvs {
+		attributes[kv.Key] = kv.Value.String()
+	}
+	return attributes
+}
+
+func timestamp(nanos Uint64) *metric.Timestamp {
+	if nanos == 0 {
+		return nil
+	}
+	return &metric.Timestamp{Time: time.Unix(0, int64(nanos))}
+}
+
+// Metrics converts every data point. Gauges and sums are sent with the metric
+// name as service. The histograms are sent as <name>.count, sum, min and max
+// and the summaries as <name>.count, sum and a service per quantile, e.g.
+// <name>.p99.
+func (c *Converter) Metrics(req *MetricsRequest) []Item {
+	items := []Item{}
+	for _, rm := range req.ResourceMetrics {
+		host, resource := c.resource(rm.Resource)
+		for _, sm := range rm.ScopeMetrics {
+			for _, m := range sm.Metrics {
+				items = append(items, c.metric(m, host, resource)...)
+			}
+		}
+	}
+	return items
+}
+
+func (c *Converter) metric(m Metric, host string, resource map[string]string) []Item {
+	items := []Item{}
+	add := func(service string, value *metric.Value, kvs []KeyValue, nanos Uint64) {
+		if m.Name == "" {
+			items = append(items, Item{Err: errNoName})
+			return
+		}
+		description := m.Description
+		if description == "" {
+			description = "OpenTelemetry metric"
+		}
+		items = append(items, Item{Metric: &metric.MetricPayload{Metric: &metric.Metric{
+			Service:     service,
+			Description: description,
+			Metric:      value,
+			Host:        host,
+			Attributes:  attributes(resource, kvs),
+			Time:        timestamp(nanos),
+		}}})
+	}
+	float := func(d Double) *metric.Value {
+		return metric.FloatValue(float64(d))
+	}
+
+	var numbers []NumberDataPoint
+	if m.Gauge != nil {
+		numbers = m.Gauge.DataPoints
+	} else if m.Sum != nil {
+		numbers = m.Sum.DataPoints
+	}
+	for _, p := range numbers {
+		switch {
+		case p.AsInt != nil:
+			add(m.Name, metric.IntValue(int64(*p.AsInt)), p.Attributes, p.TimeUnixNano)
+		case p.AsDouble != nil && finite(*p.AsDouble):
+			add(m.Name, float(*p.AsDouble), p.Attributes, p.TimeUnixNano)
+		}
+	}
+
+	histogram := m.Histogram
+	if histogram == nil {
+		histogram = m.ExponentialHistogram
+	}
+	if histogram != nil {
+		for _, p := range histogram.DataPoints {
+			add(m.Name+"."+metric.StatCount, metric.IntValue(int64(p.Count)), p.Attributes, p.TimeUnixNano)
+			stats := []struct {
+				name  string
+				value *Double
+			}{{metric.StatSum, p.Sum}, {metric.StatMin, p.Min}, {metric.StatMax, p.Max}}
+			for _, stat := range stats {
+				if stat.value != nil && finite(*stat.value) {
+					add(m.Name+"."+stat.name, float(*stat.value), p.Attributes, p.TimeUnixNano)
+				}
+			}
+		}
+	}
+
+	if m.Summary != nil {
+		for _, p := range m.Summary.DataPoints {
+			add(m.Name+"."+metric.StatCount, metric.IntValue(int64(p.Count)), p.Attributes, p.TimeUnixNano)
+			if finite(p.Sum) {
+				add(m.Name+"."+metric.StatSum, float(p.Sum), p.Attributes, p.TimeUnixNano)
+			}
+			for _, q := range p.QuantileValues {
+				if finite(q.Value) {
+					add(m.Name+"."+quantileName(float64(q.Quantile)), float(q.Value), p.Attributes, p.TimeUnixNano)
+				}
+			}
+		}
+	}
+	return items
+}
+
+func finite(d Double) bool {
+	return !math.IsNaN(float64(d)) && !math.IsInf(float64(d), 0)
+}
+
+// quantileName is min for 0, max for 1 and the percentile for the rest,
+// e.g. p99 or p99.9. The percentile is rounded to 2 decimals, q*100 is not
+// exact for quantiles like 0.29.
+func quantileName(q float64) string {
+	switch q {
+	case 0:
+		return metric.StatMin
+	case 1:
+		return metric.StatMax
+	}
+	return "p" + strconv.FormatFloat(math.Round(q*1e4)/1e2, 'f', -1, 64)
+}
+
+// Logs converts every log record to a metric of the LogService. The body is
+// the description, the severity number the metric and the state is derived
+// from the severity.
+func (c *Converter) Logs(req *LogsRequest) []Item {
+	items := []Item{}
+	for _, rl := range req.ResourceLogs {
+		host, resource := c.resource(rl.Resource)
+		for _, sl := range rl.ScopeLogs {
+			for _, r := range sl.LogRecords {
+				items = append(items, Item{Metric: c.log(r, host, resource)})
+			}
+		}
+	}
+	return items
+}
+
+func (c *Converter) log(r LogRecord, host string, resource map[string]string) *metric.MetricPayload {
+	attrs := attributes(resource, r.Attributes)
+	if r.SeverityText != "" {
+		attrs["severity"] = r.SeverityText
+	}
+	if r.TraceID != "" {
+		attrs["trace_id"] = r.TraceID
+	}
+	if r.SpanID != "" {
+		attrs["span_id"] = r.SpanID
+	}
+
+	description := "OpenTelemetry log"
+	if r.Body != nil && r.Body.String() != "" {
+		description = r.Body.String()
+	}
+	nanos := r.TimeUnixNano
+	if nanos == 0 {
+		nanos = r.ObservedTimeUnixNano
+	}
+
+	return &metric.MetricPayload{Metric: &metric.Metric{
+		Service:     c.LogService,
+		Description: description,
+		Metric:      metric.IntValue(int64(r.SeverityNumber)),
+		State:       severityState(r.SeverityNumber, r.SeverityText),
+		Host:        host,
+		Attributes:  attrs,
+		Time:        timestamp(nanos),
+	}}
+}
+
+// severityState maps the severity number ranges, or the severity text when
+// the number is not set: TRACE, DEBUG and INFO are ok, WARN is warning, ERROR
+// is error and FATAL is critical.
+func severityState(number int, text string) metric.MetricState {
+	switch {
+	case number >= 21:
+		return metric.MetricCritical
+	case number >= 17:
+		return metric.MetricError
+	case number >= 13:
+		return metric.MetricWarning
+	case number >= 1:
+		return metric.MetricOK
+	}
+
+	text = strings.ToLower(text)
+	switch {
+	case strings.HasPrefix(text, "fatal"), strings.HasPrefix(text, "crit"):
+		return metric.MetricCritical
+	case strings.HasPrefix(text, "err"):
+		return metric.MetricError
+	case strings.HasPrefix(text, "warn"):
+		return metric.MetricWarning
+	case strings.HasPrefix(text, "trace"), strings.HasPrefix(text, "debug"), strings.HasPrefix(text, "info"):
+		return metric.MetricOK
+	}
+	return ""
+}
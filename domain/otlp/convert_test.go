@@ -0,0 +1,69 @@
+package otlp
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"testing"
+)
+
+func TestQuantileName(t *testing.T) {
+	tests := []struct {
+		quantile float64
+		want     string
+	}{
+		{0, "min"},
+		{1, "max"},
+		{0.5, "p50"},
+		{0.29, "p29"},
+		{0.57, "p57"},
+		{0.99, "p99"},
+		{0.999, "p99.9"},
+		{0.9999, "p99.99"},
+	}
+	for _, tt := range tests {
+		if got := quantileName(tt.quantile); got != tt.want {
+			t.Errorf("quantileName(%v) = %s, want %s", tt.quantile, got, tt.want)
+		}
+	}
+}
+
+func TestConvertMetricsJSON(t *testing.T) {
+	body := `{"resourceMetrics": [{
+		"resource": {"attributes": [
+			{"key": "host.name", "value": {"stringValue": "web1"}},
+			{"key": "service.name", "value": {"stringValue": "api"}},
+			{"key": "ignored", "value": {"stringValue": "x"}}
+		]},
+		"scopeMetrics": [{"metrics": [
+			{"name": "requests", "sum": {"dataPoints": [{"asInt": "3", "timeUnixNano": "1622541600000000000"}]}},
+			{"name": "temp", "gauge": {"dataPoints": [{"asDouble": "NaN"}, {"asDouble": 21.5, "attributes": [{"key": "room", "value": {"intValue": 4}}]}]}},
+			{"name": "latency", "summary": {"dataPoints": [{"count": 2, "sum": 3, "quantileValues": [{"quantile": 0.29, "value": 1}, {"quantile": 1, "value": 2}]}]}},
+			{"gauge": {"dataPoints": [{"asInt": 1}]}}
+		]}]
+	}]}`
+	req := &MetricsRequest{}
+	if err := json.Unmarshal([]byte(body), req); err != nil {
+		t.Fatal(err)
+	}
+
+	c := &Converter{HostAttributes: []string{"host.name"}, ResourceAttributes: []string{"service.name"}}
+	services := []string{}
+	errs := 0
+	for _, item := range c.Metrics(req) {
+		if item.Err != nil {
+			errs++
+			continue
+		}
+		m := item.Metric
+		if m.Host != "web1" || m.Attributes["service.name"] != "api" || m.Attributes["ignored"] != "" {
+			t.Fatalf("metric = %+v", m.Metric)
+		}
+		services = append(services, m.Service)
+	}
+	sort.Strings(services)
+	want := "[latency.count latency.max latency.p29 latency.sum requests temp]"
+	if got := fmt.Sprint(services); got != want || errs != 1 {
+		t.Fatalf("services = %s and %d errors, want %s and 1 error", got, errs, want)
+	}
+}
@@ -0,0 +1,208 @@
+package otlp
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"riemannhttp/domain/metric"
+
+	"github.com/go-chi/render"
+)
+
+const (
+	maxBodySize    = 16 << 20
+	maxDecodedSize = 64 << 20
+
+	contentTypeProtobuf = "application/x-protobuf"
+	contentTypeJSON     = "application/json"
+)
+
+// The gRPC status codes of the errors
+const (
+	codeInvalidArgument   = 3
+	codeResourceExhausted = 8
+	codeInternal          = 13
+	codeUnavailable       = 14
+)
+
+type HttpTransport interface {
+	Metrics(w http.ResponseWriter, r *http.Request)
+	Logs(w http.ResponseWriter, r *http.Request)
+}
+
+type httpTransport struct {
+	svc       metric.Service
+	limits    *metric.Limits
+	converter *Converter
+}
+
+func NewHTTP(svc metric.Service, limits *metric.Limits, converter *Converter) HttpTransport {
+	return &httpTransport{
+		svc:       svc,
+		limits:    limits,
+		converter: converter,
+	}
+}
+
+// Metrics receives an OTLP/HTTP metrics export request in protobuf or JSON
+func (h httpTransport) Metrics(w http.ResponseWriter, r *http.Request) {
+	log.Print("otlp metrics received")
+	data, contentType, err := readBody(w, r)
+	if err != nil {
+		renderError(w, r, contentType, metric.ErrInvalidRequest(err))
+		return
+	}
+
+	req := &MetricsRequest{}
+	if contentType == contentTypeJSON {
+		err = json.Unmarshal(data, req)
+	} else {
+		req, err = DecodeMetricsRequest(data)
+	}
+	if err != nil {
+		renderError(w, r, contentType, metric.ErrInvalidRequest(fmt.Errorf("Invalid metrics request: %s", err)))
+		return
+	}
+
+	h.send(w, r, contentType, h.converter.Metrics(req), "rejectedDataPoints")
+}
+
+// Logs receives an OTLP/HTTP logs export request in protobuf or JSON
+func (h httpTransport) Logs(w http.ResponseWriter, r *http.Request) {
+	log.Print("otlp logs received")
+	data, contentType, err := readBody(w, r)
+	if err != nil {
+		renderError(w, r, contentType, metric.ErrInvalidRequest(err))
+		return
+	}
+
+	req := &LogsRequest{}
+	if contentType == contentTypeJSON {
+		err = json.Unmarshal(data, req)
+	} else {
+		req, err = DecodeLogsRequest(data)
+	}
+	if err != nil {
+		renderError(w, r, contentType, metric.ErrInvalidRequest(fmt.Errorf("Invalid logs request: %s", err)))
+		return
+	}
+
+	h.send(w, r, contentType, h.converter.Logs(req), "rejectedLogRecords")
+}
+
+// send validates and sends the items like the metrics of POST /metrics. The
+// rejected items are reported as a partial success, so they are not retried.
+func (h httpTransport) send(w http.ResponseWriter, r *http.Request, contentType string, items []Item, rejectedField string) {
+	var rejected []error
+	metrics := []*metric.MetricPayload{}
+	for _, item := range items {
+		err := item.Err
+		if err == nil {
+			err = h.limits.Validate(item.Metric)
+		}
+		if err == nil {
+			err = h.svc.Prepare(item.Metric)
+		}
+		if err != nil {
+			if item.Metric != nil {
+				err = fmt.Errorf("%s: %s", item.Metric.Service, err)
+			}
+			rejected = append(rejected, err)
+			continue
+		}
+		metrics = append(metrics, item.Metric)
+	}
+
+	if err := h.svc.SendBatch(metrics); err != nil {
+		renderError(w, r, contentType, metric.ErrSendError(err))
+		log.Printf("Error sending otlp data: %s", err)
+		return
+	}
+	log.Printf("otlp data queued, accepted: %d rejected: %d", len(metrics), len(rejected))
+
+	message := ""
+	if len(rejected) > 0 {
+		message = fmt.Sprintf("%d of %d rejected, %s", len(rejected), len(items), rejected[0])
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+	if contentType == contentTypeProtobuf {
+		w.Write(encodePartialSuccess(len(rejected), message))
+		return
+	}
+
+	resp := map[string]interface{}{}
+	if len(rejected) > 0 {
+		resp["partialSuccess"] = map[string]string{
+			rejectedField:  strconv.Itoa(len(rejected)),
+			"errorMessage": message,
+		}
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+// renderError renders the error as a google.rpc.Status to the protobuf
+// requests, as required by OTLP/HTTP, and as JSON to the rest
+func renderError(w http.ResponseWriter, r *http.Request, contentType string, renderer render.Renderer) {
+	e, ok := renderer.(*metric.ErrResponse)
+	if !ok || contentType != contentTypeProtobuf {
+		render.Render(w, r, renderer)
+		return
+	}
+	w.Header().Set("Content-Type", contentTypeProtobuf)
+	w.WriteHeader(e.HTTPStatusCode)
+	w.Write(encodeStatus(grpcCode(e.HTTPStatusCode), e.ErrorText))
+}
+
+// grpcCode is the gRPC status code of an HTTP status code
+func grpcCode(status int) int32 {
+	switch status {
+	case http.StatusBadRequest, http.StatusUnprocessableEntity:
+		return codeInvalidArgument
+	case http.StatusRequestEntityTooLarge:
+		return codeResourceExhausted
+	case http.StatusServiceUnavailable:
+		return codeUnavailable
+	}
+	return codeInternal
+}
+
+// readBody returns the uncompressed body and its content type, protobuf or
+// JSON. The content type is returned with the errors too, to render them.
+func readBody(w http.ResponseWriter, r *http.Request) ([]byte, string, error) {
+	contentType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if contentType != contentTypeProtobuf && contentType != contentTypeJSON {
+		return nil, contentType, fmt.Errorf("Unsupported Content-Type %q, %s or %s is required", contentType, contentTypeProtobuf, contentTypeJSON)
+	}
+
+	var body io.Reader = http.MaxBytesReader(w, r.Body, maxBodySize)
+	switch encoding := r.Header.Get("Content-Encoding"); encoding {
+	case "", "identity":
+	case "gzip":
+		gz, err := gzip.NewReader(body)
+		if err != nil {
+			return nil, contentType, fmt.Errorf("Invalid gzip data: %s", err)
+		}
+		defer gz.Close()
+		body = gz
+	default:
+		return nil, contentType, fmt.Errorf("Unsupported Content-Encoding %s", encoding)
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(body, maxDecodedSize+1))
+	if err != nil {
+		return nil, contentType, fmt.Errorf("Cannot read the request: %s", err)
+	}
+	if len(data) > maxDecodedSize {
+		return nil, contentType, errors.New("The request is too large")
+	}
+	return data, contentType, nil
+}
@@ -0,0 +1,117 @@
+package otlp
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"riemannhttp/domain/delivery"
+	"riemannhttp/domain/metric"
+	"riemannhttp/internal/protofield"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+type testService struct {
+	sendErr error
+	sent    int
+}
+
+func (s *testService) Prepare(m *metric.MetricPayload) error {
+	return nil
+}
+
+func (s *testService) Send(m *metric.MetricPayload) error {
+	return s.SendBatch([]*metric.MetricPayload{m})
+}
+
+func (s *testService) SendBatch(metrics []*metric.MetricPayload) error {
+	if s.sendErr != nil {
+		return s.sendErr
+	}
+	s.sent += len(metrics)
+	return nil
+}
+
+// decodeStatus parses a google.rpc.Status message
+func decodeStatus(t *testing.T, data []byte) (int32, string) {
+	t.Helper()
+	var code int32
+	message := ""
+	err := protofield.Each(data, func(f protofield.Field) error {
+		switch {
+		case f.Num == 1 && f.Type == protowire.VarintType:
+			code = int32(f.Number)
+		case f.Num == 2 && f.Message():
+			message = string(f.Bytes)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("invalid status: %s", err)
+	}
+	return code, message
+}
+
+func TestMetricsErrors(t *testing.T) {
+	valid := encodeGaugeRequest("cpu", 0.5)
+	tests := []struct {
+		name        string
+		contentType string
+		body        []byte
+		sendErr     error
+		status      int
+		code        int32
+		err         string
+	}{
+		{"invalid protobuf", contentTypeProtobuf, []byte{0xff}, nil, http.StatusBadRequest, codeInvalidArgument, "Invalid metrics request"},
+		{"queue full", contentTypeProtobuf, valid, delivery.ErrQueueFull, http.StatusServiceUnavailable, codeUnavailable, "full"},
+		{"send error", contentTypeProtobuf, valid, errors.New("closed"), http.StatusInternalServerError, codeInternal, "closed"},
+		{"invalid json", contentTypeJSON, []byte("{"), nil, http.StatusBadRequest, 0, "Invalid metrics request"},
+		{"unsupported content type", "text/plain", valid, nil, http.StatusBadRequest, 0, "Unsupported Content-Type"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := &testService{sendErr: tt.sendErr}
+			r := httptest.NewRequest(http.MethodPost, "/v1/metrics", bytes.NewReader(tt.body))
+			r.Header.Set("Content-Type", tt.contentType)
+			w := httptest.NewRecorder()
+			NewHTTP(svc, &metric.Limits{}, &Converter{}).Metrics(w, r)
+
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			if tt.contentType != contentTypeProtobuf {
+				if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, contentTypeJSON) || !strings.Contains(w.Body.String(), tt.err) {
+					t.Fatalf("Content-Type = %s, body %s, want the JSON error %q", ct, w.Body, tt.err)
+				}
+				return
+			}
+			if ct := w.Header().Get("Content-Type"); ct != contentTypeProtobuf {
+				t.Fatalf("Content-Type = %s, want %s", ct, contentTypeProtobuf)
+			}
+			code, message := decodeStatus(t, w.Body.Bytes())
+			if code != tt.code || !strings.Contains(message, tt.err) {
+				t.Fatalf("status code %d and message %q, want %d and %q", code, message, tt.code, tt.err)
+			}
+		})
+	}
+}
+
+func TestLogsInvalidProtobuf(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, "/v1/logs", bytes.NewReader([]byte{0xff}))
+	r.Header.Set("Content-Type", contentTypeProtobuf)
+	w := httptest.NewRecorder()
+	NewHTTP(&testService{}, &metric.Limits{}, &Converter{}).Logs(w, r)
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+	code, message := decodeStatus(t, w.Body.Bytes())
+	if code != codeInvalidArgument || !strings.Contains(message, "Invalid logs request") {
+		t.Fatalf("status code %d and message %q", code, message)
+	}
+}
@@ -0,0 +1,232 @@
+package otlp
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"math"
+	"strconv"
+)
+
+// The OTLP messages, only the fields used to build the events are decoded.
+// The JSON tags follow the OTLP/JSON encoding:
+// https://opentelemetry.io/docs/specs/otlp/#json-protobuf-encoding
+
+// Uint64 is a 64 bits integer, a string or a number in JSON
+type Uint64 uint64
+
+func (u *Uint64) UnmarshalJSON(data []byte) error {
+	v, err := strconv.ParseUint(string(bytes.Trim(data, `"`)), 10, 64)
+	if err != nil {
+		return err
+	}
+	*u = Uint64(v)
+	return nil
+}
+
+// Int64 is a 64 bits integer, a string or a number in JSON
+type Int64 int64
+
+func (i *Int64) UnmarshalJSON(data []byte) error {
+	v, err := strconv.ParseInt(string(bytes.Trim(data, `"`)), 10, 64)
+	if err != nil {
+		return err
+	}
+	*i = Int64(v)
+	return nil
+}
+
+// Double is a number, or "NaN", "Infinity" and "-Infinity" in JSON
+type Double float64
+
+func (d *Double) UnmarshalJSON(data []byte) error {
+	switch string(data) {
+	case `"NaN"`:
+		*d = Double(math.NaN())
+	case `"Infinity"`:
+		*d = Double(math.Inf(1))
+	case `"-Infinity"`:
+		*d = Double(math.Inf(-1))
+	default:
+		v, err := strconv.ParseFloat(string(bytes.Trim(data, `"`)), 64)
+		if err != nil {
+			return err
+		}
+		*d = Double(v)
+	}
+	return nil
+}
+
+type AnyValue struct {
+	StringValue *string       `json:"stringValue"`
+	BoolValue   *bool         `json:"boolValue"`
+	IntValue    *Int64        `json:"intValue"`
+	DoubleValue *Double       `json:"doubleValue"`
+	ArrayValue  *ArrayValue   `json:"arrayValue"`
+	KvlistValue *KeyValueList `json:"kvlistValue"`
+	BytesValue  []byte        `json:"bytesValue"`
+}
+
+type ArrayValue struct {
+	Values []AnyValue `json:"values"`
+}
+
+type KeyValueList struct {
+	Values []KeyValue `json:"values"`
+}
+
+type KeyValue struct {
+	Key   string   `json:"key"`
+	Value AnyValue `json:"value"`
+}
+
+// String returns the value as an attribute value, the arrays and lists are
+// JSON encoded
+func (v AnyValue) String() string {
+	switch {
+	case v.StringValue != nil:
+		return *v.StringValue
+	case v.ArrayValue != nil, v.KvlistValue != nil:
+		data, _ := json.Marshal(v.plain())
+		return string(data)
+	}
+	return toString(v.plain())
+}
+
+func toString(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case bool:
+		return strconv.FormatBool(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+	return ""
+}
+
+func (v AnyValue) plain() interface{} {
+	switch {
+	case v.StringValue != nil:
+		return *v.StringValue
+	case v.BoolValue != nil:
+		return *v.BoolValue
+	case v.IntValue != nil:
+		return int64(*v.IntValue)
+	case v.DoubleValue != nil:
+		return float64(*v.DoubleValue)
+	case v.ArrayValue != nil:
+		values := make([]interface{}, 0, len(v.ArrayValue.Values))
+		for _, value := range v.ArrayValue.Values {
+			values = append(values, value.plain())
+		}
+		return values
+	case v.KvlistValue != nil:
+		values := make(map[string]interface{}, len(v.KvlistValue.Values))
+		for _, kv := range v.KvlistValue.Values {
+			values[kv.Key] = kv.Value.plain()
+		}
+		return values
+	case v.BytesValue != nil:
+		return base64.StdEncoding.EncodeToString(v.BytesValue)
+	}
+	return nil
+}
+
+type Resource struct {
+	Attributes []KeyValue `json:"attributes"`
+}
+
+type MetricsRequest struct {
+	ResourceMetrics []ResourceMetrics `json:"resourceMetrics"`
+}
+
+type ResourceMetrics struct {
+	Resource     Resource       `json:"resource"`
+	ScopeMetrics []ScopeMetrics `json:"scopeMetrics"`
+}
+
+type ScopeMetrics struct {
+	Metrics []Metric `json:"metrics"`
+}
+
+// Metric has one of the data types. The exponential histograms are decoded
+// as histograms without their buckets.
+type Metric struct {
+	Name                 string        `json:"name"`
+	Description          string        `json:"description"`
+	Unit                 string        `json:"unit"`
+	Gauge                *NumberPoints `json:"gauge"`
+	Sum                  *NumberPoints `json:"sum"`
+	Histogram            *Histogram    `json:"histogram"`
+	ExponentialHistogram *Histogram    `json:"exponentialHistogram"`
+	Summary              *Summary      `json:"summary"`
+}
+
+type NumberPoints struct {
+	DataPoints []NumberDataPoint `json:"dataPoints"`
+}
+
+type NumberDataPoint struct {
+	Attributes   []KeyValue `json:"attributes"`
+	TimeUnixNano Uint64     `json:"timeUnixNano"`
+	AsDouble     *Double    `json:"asDouble"`
+	AsInt        *Int64     `json:"asInt"`
+}
+
+type Histogram struct {
+	DataPoints []HistogramDataPoint `json:"dataPoints"`
+}
+
+type HistogramDataPoint struct {
+	Attributes   []KeyValue `json:"attributes"`
+	TimeUnixNano Uint64     `json:"timeUnixNano"`
+	Count        Uint64     `json:"count"`
+	Sum          *Double    `json:"sum"`
+	Min          *Double    `json:"min"`
+	Max          *Double    `json:"max"`
+}
+
+type Summary struct {
+	DataPoints []SummaryDataPoint `json:"dataPoints"`
+}
+
+type SummaryDataPoint struct {
+	Attributes     []KeyValue        `json:"attributes"`
+	TimeUnixNano   Uint64            `json:"timeUnixNano"`
+	Count          Uint64            `json:"count"`
+	Sum            Double            `json:"sum"`
+	QuantileValues []ValueAtQuantile `json:"quantileValues"`
+}
+
+type ValueAtQuantile struct {
+	Quantile Double `json:"quantile"`
+	Value    Double `json:"value"`
+}
+
+type LogsRequest struct {
+	ResourceLogs []ResourceLogs `json:"resourceLogs"`
+}
+
+type ResourceLogs struct {
+	Resource  Resource    `json:"resource"`
+	ScopeLogs []ScopeLogs `json:"scopeLogs"`
+}
+
+type ScopeLogs struct {
+	LogRecords []LogRecord `json:"logRecords"`
+}
+
+// LogRecord has the trace and span ids hex encoded, like in OTLP/JSON
+type LogRecord struct {
+	TimeUnixNano         Uint64     `json:"timeUnixNano"`
+	ObservedTimeUnixNano Uint64     `json:"observedTimeUnixNano"`
+	SeverityNumber       int        `json:"severityNumber"`
+	SeverityText         string     `json:"severityText"`
+	Body                 *AnyValue  `json:"body"`
+	Attributes           []KeyValue `json:"attributes"`
+	TraceID              string     `json:"traceId"`
+	SpanID               string     `json:"spanId"`
+}
@@ -0,0 +1,421 @@
+package otlp
+
+import (
+	"encoding/hex"
+	"errors"
+
+	"riemannhttp/internal/protofield"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// maxAnyValueDepth is the maximum nesting of the array and key value list
+// attributes
+const maxAnyValueDepth = 32
+
+var errTooDeep = errors.New("attribute values are nested too deep")
+
+// DecodeMetricsRequest parses an ExportMetricsServiceRequest message
+func DecodeMetricsRequest(data []byte) (*MetricsRequest, error) {
+	req := &MetricsRequest{}
+	err := protofield.Each(data, func(f protofield.Field) error {
+		if f.Num != 1 || !f.Message() {
+			return nil
+		}
+		rm, err := decodeResourceMetrics(f.Bytes)
+		req.ResourceMetrics = append(req.ResourceMetrics, rm)
+		return err
+	})
+	return req, err
+}
+
+func decodeResourceMetrics(data []byte) (ResourceMetrics, error) {
+	rm := ResourceMetrics{}
+	err := protofield.Each(data, func(f protofield.Field) error {
+		if !f.Message() {
+			return nil
+		}
+		switch f.Num {
+		case 1:
+			return decodeResource(f.Bytes, &rm.Resource)
+		// 1000 is the deprecated instrumentation_library_metrics
+		case 2, 1000:
+			sm, err := decodeScopeMetrics(f.Bytes)
+			rm.ScopeMetrics = append(rm.ScopeMetrics, sm)
+			return err
+		}
+		return nil
+	})
+	return rm, err
+}
+
+func decodeResource(data []byte, r *Resource) error {
+	return protofield.Each(data, func(f protofield.Field) error {
+		if f.Num != 1 || !f.Message() {
+			return nil
+		}
+		kv, err := decodeKeyValue(f.Bytes)
+		r.Attributes = append(r.Attributes, kv)
+		return err
+	})
+}
+
+func decodeKeyValue(data []byte) (KeyValue, error) {
+	return decodeNestedKeyValue(data, 0)
+}
+
+// decodeNestedKeyValue decodes a key value inside depth AnyValue messages
+func decodeNestedKeyValue(data []byte, depth int) (KeyValue, error) {
+	kv := KeyValue{}
+	err := protofield.Each(data, func(f protofield.Field) error {
+		if !f.Message() {
+			return nil
+		}
+		switch f.Num {
+		case 1:
+			kv.Key = string(f.Bytes)
+		case 2:
+			value, err := decodeNestedAnyValue(f.Bytes, depth)
+			kv.Value = value
+			return err
+		}
+		return nil
+	})
+	return kv, err
+}
+
+func decodeAnyValue(data []byte) (AnyValue, error) {
+	return decodeNestedAnyValue(data, 0)
+}
+
+// decodeNestedAnyValue decodes an AnyValue inside depth AnyValue messages.
+// The arrays and lists nested too deep are rejected, they could exhaust the
+// stack.
+func decodeNestedAnyValue(data []byte, depth int) (AnyValue, error) {
+	if depth > maxAnyValueDepth {
+		return AnyValue{}, errTooDeep
+	}
+	v := AnyValue{}
+	err := protofield.Each(data, func(f protofield.Field) error {
+		switch {
+		case f.Num == 1 && f.Message():
+			s := string(f.Bytes)
+			v.StringValue = &s
+		case f.Num == 2 && f.Type == protowire.VarintType:
+			b := f.Number != 0
+			v.BoolValue = &b
+		case f.Num == 3 && f.Type == protowire.VarintType:
+			i := Int64(f.Number)
+			v.IntValue = &i
+		case f.Num == 4 && f.Type == protowire.Fixed64Type:
+			d := Double(f.Double())
+			v.DoubleValue = &d
+		case f.Num == 5 && f.Message():
+			v.ArrayValue = &ArrayValue{}
+			return protofield.Each(f.Bytes, func(f protofield.Field) error {
+				if f.Num != 1 || !f.Message() {
+					return nil
+				}
+				value, err := decodeNestedAnyValue(f.Bytes, depth+1)
+				v.ArrayValue.Values = append(v.ArrayValue.Values, value)
+				return err
+			})
+		case f.Num == 6 && f.Message():
+			v.KvlistValue = &KeyValueList{}
+			return protofield.Each(f.Bytes, func(f protofield.Field) error {
+				if f.Num != 1 || !f.Message() {
+					return nil
+				}
+				kv, err := decodeNestedKeyValue(f.Bytes, depth+1)
+				v.KvlistValue.Values = append(v.KvlistValue.Values, kv)
+				return err
+			})
+		case f.Num == 7 && f.Message():
+			v.BytesValue = append([]byte{}, f.Bytes...)
+		}
+		return nil
+	})
+	return v, err
+}
+
+func decodeAttribute(f protofield.Field, attributes *[]KeyValue) error {
+	kv, err := decodeKeyValue(f.Bytes)
+	*attributes = append(*attributes, kv)
+	return err
+}
+
+func decodeScopeMetrics(data []byte) (ScopeMetrics, error) {
+	sm := ScopeMetrics{}
+	err := protofield.Each(data, func(f protofield.Field) error {
+		if f.Num != 2 || !f.Message() {
+			return nil
+		}
+		m, err := decodeMetric(f.Bytes)
+		sm.Metrics = append(sm.Metrics, m)
+		return err
+	})
+	return sm, err
+}
+
+func decodeMetric(data []byte) (Metric, error) {
+	m := Metric{}
+	err := protofield.Each(data, func(f protofield.Field) error {
+		if !f.Message() {
+			return nil
+		}
+		switch f.Num {
+		case 1:
+			m.Name = string(f.Bytes)
+		case 2:
+			m.Description = string(f.Bytes)
+		case 3:
+			m.Unit = string(f.Bytes)
+		case 5:
+			m.Gauge = &NumberPoints{}
+			return decodeNumberPoints(f.Bytes, m.Gauge)
+		case 7:
+			m.Sum = &NumberPoints{}
+			return decodeNumberPoints(f.Bytes, m.Sum)
+		case 9:
+			m.Histogram = &Histogram{}
+			return decodeHistogram(f.Bytes, m.Histogram, decodeHistogramDataPoint)
+		case 10:
+			m.ExponentialHistogram = &Histogram{}
+			return decodeHistogram(f.Bytes, m.ExponentialHistogram, decodeExponentialHistogramDataPoint)
+		case 11:
+			m.Summary = &Summary{}
+			return decodeSummary(f.Bytes, m.Summary)
+		}
+		return nil
+	})
+	return m, err
+}
+
+func decodeNumberPoints(data []byte, points *NumberPoints) error {
+	return protofield.Each(data, func(f protofield.Field) error {
+		if f.Num != 1 || !f.Message() {
+			return nil
+		}
+		p := NumberDataPoint{}
+		err := protofield.Each(f.Bytes, func(f protofield.Field) error {
+			switch {
+			case f.Num == 3 && f.Type == protowire.Fixed64Type:
+				p.TimeUnixNano = Uint64(f.Number)
+			case f.Num == 4 && f.Type == protowire.Fixed64Type:
+				d := Double(f.Double())
+				p.AsDouble = &d
+			case f.Num == 6 && f.Type == protowire.Fixed64Type:
+				i := Int64(f.Number)
+				p.AsInt = &i
+			case f.Num == 7 && f.Message():
+				return decodeAttribute(f, &p.Attributes)
+			}
+			return nil
+		})
+		points.DataPoints = append(points.DataPoints, p)
+		return err
+	})
+}
+
+func decodeHistogram(data []byte, h *Histogram, decodePoint func([]byte) (HistogramDataPoint, error)) error {
+	return protofield.Each(data, func(f protofield.Field) error {
+		if f.Num != 1 || !f.Message() {
+			return nil
+		}
+		p, err := decodePoint(f.Bytes)
+		h.DataPoints = append(h.DataPoints, p)
+		return err
+	})
+}
+
+func decodeHistogramDataPoint(data []byte) (HistogramDataPoint, error) {
+	p := HistogramDataPoint{}
+	err := protofield.Each(data, func(f protofield.Field) error {
+		switch {
+		case f.Num == 3 && f.Type == protowire.Fixed64Type:
+			p.TimeUnixNano = Uint64(f.Number)
+		case f.Num == 4 && f.Type == protowire.Fixed64Type:
+			p.Count = Uint64(f.Number)
+		case f.Num == 5 && f.Type == protowire.Fixed64Type:
+			d := Double(f.Double())
+			p.Sum = &d
+		case f.Num == 9 && f.Message():
+			return decodeAttribute(f, &p.Attributes)
+		case f.Num == 11 && f.Type == protowire.Fixed64Type:
+			d := Double(f.Double())
+			p.Min = &d
+		case f.Num == 12 && f.Type == protowire.Fixed64Type:
+			d := Double(f.Double())
+			p.Max = &d
+		}
+		return nil
+	})
+	return p, err
+}
+
+func decodeExponentialHistogramDataPoint(data []byte) (HistogramDataPoint, error) {
+	p := HistogramDataPoint{}
+	err := protofield.Each(data, func(f protofield.Field) error {
+		switch {
+		case f.Num == 1 && f.Message():
+			return decodeAttribute(f, &p.Attributes)
+		case f.Num == 3 && f.Type == protowire.Fixed64Type:
+			p.TimeUnixNano = Uint64(f.Number)
+		case f.Num == 4 && f.Type == protowire.Fixed64Type:
+			p.Count = Uint64(f.Number)
+		case f.Num == 5 && f.Type == protowire.Fixed64Type:
+			d := Double(f.Double())
+			p.Sum = &d
+		case f.Num == 12 && f.Type == protowire.Fixed64Type:
+			d := Double(f.Double())
+			p.Min = &d
+		case f.Num == 13 && f.Type == protowire.Fixed64Type:
+			d := Double(f.Double())
+			p.Max = &d
+		}
+		return nil
+	})
+	return p, err
+}
+
+func decodeSummary(data []byte, s *Summary) error {
+	return protofield.Each(data, func(f protofield.Field) error {
+		if f.Num != 1 || !f.Message() {
+			return nil
+		}
+		p := SummaryDataPoint{}
+		err := protofield.Each(f.Bytes, func(f protofield.Field) error {
+			switch {
+			case f.Num == 3 && f.Type == protowire.Fixed64Type:
+				p.TimeUnixNano = Uint64(f.Number)
+			case f.Num == 4 && f.Type == protowire.Fixed64Type:
+				p.Count = Uint64(f.Number)
+			case f.Num == 5 && f.Type == protowire.Fixed64Type:
+				p.Sum = Double(f.Double())
+			case f.Num == 6 && f.Message():
+				q := ValueAtQuantile{}
+				err := protofield.Each(f.Bytes, func(f protofield.Field) error {
+					if f.Type != protowire.Fixed64Type {
+						return nil
+					}
+					switch f.Num {
+					case 1:
+						q.Quantile = Double(f.Double())
+					case 2:
+						q.Value = Double(f.Double())
+					}
+					return nil
+				})
+				p.QuantileValues = append(p.QuantileValues, q)
+				return err
+			case f.Num == 7 && f.Message():
+				return decodeAttribute(f, &p.Attributes)
+			}
+			return nil
+		})
+		s.DataPoints = append(s.DataPoints, p)
+		return err
+	})
+}
+
+// DecodeLogsRequest parses an ExportLogsServiceRequest message
+func DecodeLogsRequest(data []byte) (*LogsRequest, error) {
+	req := &LogsRequest{}
+	err := protofield.Each(data, func(f protofield.Field) error {
+		if f.Num != 1 || !f.Message() {
+			return nil
+		}
+		rl, err := decodeResourceLogs(f.Bytes)
+		req.ResourceLogs = append(req.ResourceLogs, rl)
+		return err
+	})
+	return req, err
+}
+
+func decodeResourceLogs(data []byte) (ResourceLogs, error) {
+	rl := ResourceLogs{}
+	err := protofield.Each(data, func(f protofield.Field) error {
+		if !f.Message() {
+			return nil
+		}
+		switch f.Num {
+		case 1:
+			return decodeResource(f.Bytes, &rl.Resource)
+		// 1000 is the deprecated instrumentation_library_logs
+		case 2, 1000:
+			sl := ScopeLogs{}
+			err := protofield.Each(f.Bytes, func(f protofield.Field) error {
+				if f.Num != 2 || !f.Message() {
+					return nil
+				}
+				record, err := decodeLogRecord(f.Bytes)
+				sl.LogRecords = append(sl.LogRecords, record)
+				return err
+			})
+			rl.ScopeLogs = append(rl.ScopeLogs, sl)
+			return err
+		}
+		return nil
+	})
+	return rl, err
+}
+
+func decodeLogRecord(data []byte) (LogRecord, error) {
+	r := LogRecord{}
+	err := protofield.Each(data, func(f protofield.Field) error {
+		switch {
+		case f.Num == 1 && f.Type == protowire.Fixed64Type:
+			r.TimeUnixNano = Uint64(f.Number)
+		case f.Num == 11 && f.Type == protowire.Fixed64Type:
+			r.ObservedTimeUnixNano = Uint64(f.Number)
+		case f.Num == 2 && f.Type == protowire.VarintType:
+			r.SeverityNumber = int(f.Number)
+		case f.Num == 3 && f.Message():
+			r.SeverityText = string(f.Bytes)
+		case f.Num == 5 && f.Message():
+			body, err := decodeAnyValue(f.Bytes)
+			r.Body = &body
+			return err
+		case f.Num == 6 && f.Message():
+			return decodeAttribute(f, &r.Attributes)
+		case f.Num == 9 && f.Message():
+			r.TraceID = hex.EncodeToString(f.Bytes)
+		case f.Num == 10 && f.Message():
+			r.SpanID = hex.EncodeToString(f.Bytes)
+		}
+		return nil
+	})
+	return r, err
+}
+
+// encodePartialSuccess encodes the export response, field 1 of the partial
+// success is the number of rejected data points or log records
+func encodePartialSuccess(rejected int, message string) []byte {
+	if rejected == 0 {
+		return []byte{}
+	}
+	var ps []byte
+	ps = protowire.AppendTag(ps, 1, protowire.VarintType)
+	ps = protowire.AppendVarint(ps, uint64(rejected))
+	ps = protowire.AppendTag(ps, 2, protowire.BytesType)
+	ps = protowire.AppendString(ps, message)
+
+	var resp []byte
+	resp = protowire.AppendTag(resp, 1, protowire.BytesType)
+	return protowire.AppendBytes(resp, ps)
+}
+
+// encodeStatus encodes a google.rpc.Status, the body of the errors of the
+// protobuf requests
+func encodeStatus(code int32, message string) []byte {
+	var status []byte
+	if code != 0 {
+		status = protowire.AppendTag(status, 1, protowire.VarintType)
+		status = protowire.AppendVarint(status, uint64(code))
+	}
+	if message != "" {
+		status = protowire.AppendTag(status, 2, protowire.BytesType)
+		status = protowire.AppendString(status, message)
+	}
+	return status
+}
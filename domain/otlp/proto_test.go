@@ -0,0 +1,126 @@
+package otlp
+
+import (
+	"math"
+	"testing"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func appendMessage(b []byte, num protowire.Number, msg []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, msg)
+}
+
+func encodeStringValue(s string) []byte {
+	return appendMessage(nil, 1, []byte(s))
+}
+
+func encodeKeyValue(key string, value []byte) []byte {
+	b := appendMessage(nil, 1, []byte(key))
+	return appendMessage(b, 2, value)
+}
+
+// encodeNestedArray returns an AnyValue of depth nested arrays around a string
+func encodeNestedArray(depth int) []byte {
+	value := encodeStringValue("leaf")
+	for i := 0; i < depth; i++ {
+		value = appendMessage(nil, 5, appendMessage(nil, 1, value))
+	}
+	return value
+}
+
+func encodeGaugeRequest(name string, value float64) []byte {
+	point := protowire.AppendTag(nil, 3, protowire.Fixed64Type)
+	point = protowire.AppendFixed64(point, 1622541600e9)
+	point = protowire.AppendTag(point, 4, protowire.Fixed64Type)
+	point = protowire.AppendFixed64(point, math.Float64bits(value))
+	point = appendMessage(point, 7, encodeKeyValue("path", encodeStringValue("/api")))
+
+	m := appendMessage(nil, 1, []byte(name))
+	m = appendMessage(m, 5, appendMessage(nil, 1, point))
+	resource := appendMessage(nil, 1, encodeKeyValue("host.name", encodeStringValue("web1")))
+	rm := appendMessage(nil, 1, resource)
+	rm = appendMessage(rm, 2, appendMessage(nil, 2, m))
+	return appendMessage(nil, 1, rm)
+}
+
+func TestDecodeMetricsRequest(t *testing.T) {
+	valid := encodeGaugeRequest("cpu", 0.5)
+	tests := []struct {
+		name    string
+		data    []byte
+		metrics int
+		err     bool
+	}{
+		{"empty", nil, 0, false},
+		{"gauge", valid, 1, false},
+		{"truncated", valid[:len(valid)-4], 0, true},
+		{"invalid tag", []byte{0xff}, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := DecodeMetricsRequest(tt.data)
+			if (err != nil) != tt.err {
+				t.Fatalf("err = %v", err)
+			}
+			if err != nil {
+				return
+			}
+			metrics := 0
+			for _, rm := range req.ResourceMetrics {
+				for _, sm := range rm.ScopeMetrics {
+					metrics += len(sm.Metrics)
+				}
+			}
+			if metrics != tt.metrics {
+				t.Fatalf("%d metrics, want %d", metrics, tt.metrics)
+			}
+		})
+	}
+
+	req, _ := DecodeMetricsRequest(valid)
+	m := req.ResourceMetrics[0].ScopeMetrics[0].Metrics[0]
+	p := m.Gauge.DataPoints[0]
+	if m.Name != "cpu" || p.AsDouble == nil || *p.AsDouble != 0.5 || p.Attributes[0].Value.String() != "/api" {
+		t.Fatalf("metric = %+v", m)
+	}
+}
+
+func TestDecodeAnyValueDepth(t *testing.T) {
+	tests := []struct {
+		name  string
+		depth int
+		err   bool
+	}{
+		{"flat", 0, false},
+		{"max depth", maxAnyValueDepth, false},
+		{"too deep", maxAnyValueDepth + 1, true},
+		{"very deep", 10000, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := decodeAnyValue(encodeNestedArray(tt.depth))
+			if (err != nil) != tt.err {
+				t.Fatalf("err = %v", err)
+			}
+		})
+	}
+
+	// Key value lists count as a level too
+	value := encodeStringValue("leaf")
+	for i := 0; i <= maxAnyValueDepth; i++ {
+		value = appendMessage(nil, 6, appendMessage(nil, 1, encodeKeyValue("k", value)))
+	}
+	if _, err := decodeAnyValue(value); err != errTooDeep {
+		t.Fatalf("err = %v, want %v", err, errTooDeep)
+	}
+}
+
+func TestDecodeLogsRequestDepth(t *testing.T) {
+	record := appendMessage(nil, 5, encodeNestedArray(maxAnyValueDepth+1))
+	req := appendMessage(nil, 1, appendMessage(nil, 2, appendMessage(nil, 2, record)))
+	if _, err := DecodeLogsRequest(req); err == nil {
+		t.Fatal("nested log body accepted")
+	}
+}
@@ -0,0 +1,51 @@
+package passthrough
+
+import (
+	"math"
+	"time"
+
+	"riemannhttp/domain/metric"
+
+	"github.com/riemann/riemann-go-client/proto"
+)
+
+// Metric converts a riemann event. The events without description get a
+// default one, the metric is metric_sint64, metric_d or metric_f and the
+// time is time_micros or time.
+func Metric(e *proto.Event) *metric.MetricPayload {
+	m := &metric.Metric{
+		Service:     e.GetService(),
+		Description: e.GetDescription(),
+		State:       metric.MetricState(e.GetState()),
+		Host:        e.GetHost(),
+		Tags:        e.GetTags(),
+		TTL:         int64(math.Ceil(float64(e.GetTtl()))),
+	}
+	if m.Description == "" {
+		m.Description = "Riemann event"
+	}
+
+	switch {
+	case e.MetricSint64 != nil:
+		m.Metric = metric.IntValue(*e.MetricSint64)
+	case e.MetricD != nil:
+		m.Metric = metric.FloatValue(*e.MetricD)
+	case e.MetricF != nil:
+		m.Metric = metric.FloatValue(float64(*e.MetricF))
+	}
+
+	switch {
+	case e.GetTimeMicros() != 0:
+		m.Time = &metric.Timestamp{Time: time.Unix(0, e.GetTimeMicros()*int64(time.Microsecond))}
+	case e.GetTime() != 0:
+		m.Time = &metric.Timestamp{Time: time.Unix(e.GetTime(), 0)}
+	}
+
+	if len(e.Attributes) > 0 {
+		m.Attributes = make(map[string]string, len(e.Attributes))
+		for _, attr := range e.Attributes {
+			m.Attributes[attr.GetKey()] = attr.GetValue()
+		}
+	}
+	return &metric.MetricPayload{Metric: m}
+}
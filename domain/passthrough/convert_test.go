@@ -0,0 +1,82 @@
+package passthrough
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"riemannhttp/domain/metric"
+
+	pb "github.com/golang/protobuf/proto"
+	"github.com/riemann/riemann-go-client/proto"
+)
+
+func TestMetric(t *testing.T) {
+	micros := time.Date(2026, 10, 18, 6, 0, 0, 123456000, time.UTC)
+	seconds := time.Unix(micros.Unix(), 0)
+	tests := []struct {
+		name  string
+		event *proto.Event
+		value *metric.Value
+		time  *time.Time
+		ttl   int64
+	}{
+		{"sint64", &proto.Event{MetricSint64: pb.Int64(-3)}, metric.IntValue(-3), nil, 0},
+		{"double", &proto.Event{MetricD: pb.Float64(1.5)}, metric.FloatValue(1.5), nil, 0},
+		{"float", &proto.Event{MetricF: pb.Float32(0.25)}, metric.FloatValue(0.25), nil, 0},
+		{"sint64 over double", &proto.Event{MetricSint64: pb.Int64(2), MetricD: pb.Float64(1.5)}, metric.IntValue(2), nil, 0},
+		{"no metric", &proto.Event{}, nil, nil, 0},
+		{"time", &proto.Event{Time: pb.Int64(micros.Unix())}, nil, &seconds, 0},
+		{"time_micros over time", &proto.Event{Time: pb.Int64(1), TimeMicros: pb.Int64(micros.UnixNano() / 1000)}, nil, &micros, 0},
+		{"integer ttl", &proto.Event{Ttl: pb.Float32(60)}, nil, nil, 60},
+		{"ttl rounded up", &proto.Event{Ttl: pb.Float32(0.2)}, nil, nil, 1},
+		{"fractional ttl rounded up", &proto.Event{Ttl: pb.Float32(60.5)}, nil, nil, 61},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := Metric(tt.event)
+			if !reflect.DeepEqual(m.Metric.Metric, tt.value) {
+				t.Fatalf("metric = %+v, want %+v", m.Metric.Metric, tt.value)
+			}
+			if m.TTL != tt.ttl {
+				t.Fatalf("ttl = %d, want %d", m.TTL, tt.ttl)
+			}
+			switch {
+			case tt.time == nil && m.Time != nil:
+				t.Fatalf("time = %s, want none", m.Time.Time)
+			case tt.time != nil && m.Time == nil:
+				t.Fatal("time not set")
+			case tt.time != nil && !m.Time.Time.Equal(*tt.time):
+				t.Fatalf("time = %s, want %s", m.Time.Time, *tt.time)
+			}
+		})
+	}
+}
+
+func TestMetricFields(t *testing.T) {
+	m := Metric(&proto.Event{
+		Service:      pb.String("api.latency"),
+		Host:         pb.String("h"),
+		State:        pb.String("warning"),
+		Tags:         []string{"a", "b"},
+		Attributes:   []*proto.Attribute{{Key: pb.String("ip"), Value: pb.String("10.0.0.1")}},
+		MetricSint64: pb.Int64(1),
+	})
+	want := &metric.Metric{
+		Service:     "api.latency",
+		Description: "Riemann event",
+		Host:        "h",
+		State:       "warning",
+		Tags:        []string{"a", "b"},
+		Attributes:  map[string]string{"ip": "10.0.0.1"},
+		Metric:      metric.IntValue(1),
+	}
+	if !reflect.DeepEqual(m.Metric, want) {
+		t.Fatalf("Metric() = %+v, want %+v", m.Metric, want)
+	}
+
+	described := Metric(&proto.Event{Description: pb.String("latency"), MetricSint64: pb.Int64(1)})
+	if described.Description != "latency" || described.Attributes != nil {
+		t.Fatalf("Metric() = %+v", described.Metric)
+	}
+}
@@ -0,0 +1,118 @@
+package passthrough
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"mime"
+	"net/http"
+
+	"riemannhttp/domain/delivery"
+	"riemannhttp/domain/metric"
+
+	pb "github.com/golang/protobuf/proto"
+	"github.com/riemann/riemann-go-client/proto"
+)
+
+const (
+	maxBodySize         = 16 << 20
+	contentTypeProtobuf = "application/x-protobuf"
+)
+
+type HttpTransport interface {
+	Send(w http.ResponseWriter, r *http.Request)
+}
+
+type httpTransport struct {
+	svc    metric.Service
+	limits *metric.Limits
+}
+
+func NewHTTP(svc metric.Service, limits *metric.Limits) HttpTransport {
+	return &httpTransport{
+		svc:    svc,
+		limits: limits,
+	}
+}
+
+// Send receives a riemann Msg and sends its events like the metrics of
+// POST /metrics. The response is a Msg with ok or the error. Like riemann, a
+// Msg is accepted or rejected whole, nothing is sent if an event is invalid.
+func (h httpTransport) Send(w http.ResponseWriter, r *http.Request) {
+	log.Print("riemann message received")
+	msg, err := readMsg(w, r)
+	if err != nil {
+		writeMsg(w, http.StatusBadRequest, err)
+		return
+	}
+	if msg.Query != nil {
+		writeMsg(w, http.StatusBadRequest, errors.New("Queries are not supported"))
+		return
+	}
+	if len(msg.Events) == 0 {
+		writeMsg(w, http.StatusBadRequest, errors.New("Empty message"))
+		return
+	}
+
+	var rejected []error
+	metrics := []*metric.MetricPayload{}
+	for i, e := range msg.Events {
+		m := Metric(e)
+		err := h.limits.Validate(m)
+		if err == nil {
+			err = h.svc.Prepare(m)
+		}
+		if err != nil {
+			rejected = append(rejected, fmt.Errorf("event %d: %s", i, err))
+			continue
+		}
+		metrics = append(metrics, m)
+	}
+	if len(rejected) > 0 {
+		log.Printf("riemann message rejected, %d of %d events are invalid", len(rejected), len(msg.Events))
+		writeMsg(w, http.StatusBadRequest, fmt.Errorf("%d of %d events rejected, %s", len(rejected), len(msg.Events), rejected[0]))
+		return
+	}
+
+	if err := h.svc.SendBatch(metrics); err != nil {
+		log.Printf("Error sending riemann events: %s", err)
+		status := http.StatusInternalServerError
+		if errors.Is(err, delivery.ErrQueueFull) {
+			status = http.StatusServiceUnavailable
+		}
+		writeMsg(w, status, err)
+		return
+	}
+
+	log.Printf("riemann message queued, events: %d", len(metrics))
+	writeMsg(w, http.StatusOK, nil)
+}
+
+func readMsg(w http.ResponseWriter, r *http.Request) (*proto.Msg, error) {
+	contentType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if contentType != contentTypeProtobuf {
+		return nil, fmt.Errorf("Unsupported Content-Type %q, %s is required", contentType, contentTypeProtobuf)
+	}
+	data, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxBodySize))
+	if err != nil {
+		return nil, fmt.Errorf("Cannot read the request: %s", err)
+	}
+	msg := &proto.Msg{}
+	if err := pb.Unmarshal(data, msg); err != nil {
+		return nil, fmt.Errorf("Invalid riemann message: %s", err)
+	}
+	return msg, nil
+}
+
+// writeMsg answers with a Msg like riemann does, ok without error
+func writeMsg(w http.ResponseWriter, status int, err error) {
+	resp := &proto.Msg{Ok: pb.Bool(err == nil)}
+	if err != nil {
+		resp.Error = pb.String(err.Error())
+	}
+	data, _ := pb.Marshal(resp)
+	w.Header().Set("Content-Type", contentTypeProtobuf)
+	w.WriteHeader(status)
+	w.Write(data)
+}
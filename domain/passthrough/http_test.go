@@ -0,0 +1,102 @@
+package passthrough
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"riemannhttp/domain/delivery"
+	"riemannhttp/domain/metric"
+
+	pb "github.com/golang/protobuf/proto"
+	"github.com/riemann/riemann-go-client/proto"
+)
+
+type testService struct {
+	sendErr error
+	sent    int
+}
+
+func (s *testService) Prepare(m *metric.MetricPayload) error {
+	if m.Service == "incomplete" {
+		return &metric.IncompleteError{Err: errors.New("Missing attributes: ip")}
+	}
+	return nil
+}
+
+func (s *testService) Send(m *metric.MetricPayload) error {
+	return s.SendBatch([]*metric.MetricPayload{m})
+}
+
+func (s *testService) SendBatch(metrics []*metric.MetricPayload) error {
+	if s.sendErr != nil {
+		return s.sendErr
+	}
+	s.sent += len(metrics)
+	return nil
+}
+
+func testEvent(service string) *proto.Event {
+	return &proto.Event{Service: pb.String(service), Host: pb.String("h"), MetricSint64: pb.Int64(1)}
+}
+
+func marshalMsg(t *testing.T, msg *proto.Msg) []byte {
+	t.Helper()
+	data, err := pb.Marshal(msg)
+	if err != nil {
+		t.Fatalf("Marshal: %s", err)
+	}
+	return data
+}
+
+func TestSend(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        []byte
+		sendErr     error
+		status      int
+		err         string
+		sent        int
+	}{
+		{"events", contentTypeProtobuf, marshalMsg(t, &proto.Msg{Events: []*proto.Event{testEvent("a"), testEvent("b")}}), nil, http.StatusOK, "", 2},
+		{"invalid event", contentTypeProtobuf, marshalMsg(t, &proto.Msg{Events: []*proto.Event{testEvent("a"), {Service: pb.String("b")}}}), nil, http.StatusBadRequest, "1 of 2 events rejected, event 1:", 0},
+		{"incomplete event", contentTypeProtobuf, marshalMsg(t, &proto.Msg{Events: []*proto.Event{testEvent("incomplete"), testEvent("b")}}), nil, http.StatusBadRequest, "event 0: Missing attributes: ip", 0},
+		{"empty", contentTypeProtobuf, marshalMsg(t, &proto.Msg{}), nil, http.StatusBadRequest, "Empty message", 0},
+		{"query", contentTypeProtobuf, marshalMsg(t, &proto.Msg{Query: &proto.Query{String_: pb.String("true")}}), nil, http.StatusBadRequest, "Queries are not supported", 0},
+		{"json", "application/json", []byte("{}"), nil, http.StatusBadRequest, "Unsupported Content-Type", 0},
+		{"invalid protobuf", contentTypeProtobuf, []byte{0xff, 0xff}, nil, http.StatusBadRequest, "Invalid riemann message", 0},
+		{"too large", contentTypeProtobuf, make([]byte, maxBodySize+1), nil, http.StatusBadRequest, "Cannot read the request", 0},
+		{"queue full", contentTypeProtobuf, marshalMsg(t, &proto.Msg{Events: []*proto.Event{testEvent("a")}}), delivery.ErrQueueFull, http.StatusServiceUnavailable, "full", 0},
+		{"send error", contentTypeProtobuf, marshalMsg(t, &proto.Msg{Events: []*proto.Event{testEvent("a")}}), errors.New("closed"), http.StatusInternalServerError, "closed", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := &testService{sendErr: tt.sendErr}
+			r := httptest.NewRequest(http.MethodPost, "/riemann", bytes.NewReader(tt.body))
+			r.Header.Set("Content-Type", tt.contentType)
+			w := httptest.NewRecorder()
+			NewHTTP(svc, &metric.Limits{}).Send(w, r)
+
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			if ct := w.Header().Get("Content-Type"); ct != contentTypeProtobuf {
+				t.Fatalf("Content-Type = %s, want %s", ct, contentTypeProtobuf)
+			}
+			resp := &proto.Msg{}
+			if err := pb.Unmarshal(w.Body.Bytes(), resp); err != nil {
+				t.Fatalf("Unmarshal: %s", err)
+			}
+			if resp.GetOk() != (tt.err == "") || !strings.Contains(resp.GetError(), tt.err) {
+				t.Fatalf("response ok %v and error %q, want the error %q", resp.GetOk(), resp.GetError(), tt.err)
+			}
+			if svc.sent != tt.sent {
+				t.Fatalf("sent %d events, want %d", svc.sent, tt.sent)
+			}
+		})
+	}
+}
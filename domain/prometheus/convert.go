@@ -0,0 +1,57 @@
+package prometheus
+
+import (
+	"errors"
+	"math"
+	"time"
+
+	"riemannhttp/domain/metric"
+)
+
+const nameLabel = "__name__"
+
+var errNoName = errors.New("__name__ label is required")
+
+// Metrics converts every sample of the series to a metric. The metric name
+// is the service, the hostLabel the host and the rest of the labels are the
+// attributes. The samples that are not a number, like the stale markers, are
+// skipped.
+func Metrics(ts TimeSeries, hostLabel string) ([]*metric.MetricPayload, error) {
+	var name, host string
+	labels := make(map[string]string, len(ts.Labels))
+	for _, label := range ts.Labels {
+		switch label.Name {
+		case nameLabel:
+			name = label.Value
+		case hostLabel:
+			host = label.Value
+		default:
+			labels[label.Name] = label.Value
+		}
+	}
+	if name == "" {
+		return nil, errNoName
+	}
+
+	metrics := make([]*metric.MetricPayload, 0, len(ts.Samples))
+	for _, sample := range ts.Samples {
+		if math.IsNaN(sample.Value) || math.IsInf(sample.Value, 0) {
+			continue
+		}
+
+		// every metric gets its own attributes, they can be changed later
+		attributes := make(map[string]string, len(labels))
+		for k, v := range labels {
+			attributes[k] = v
+		}
+		metrics = append(metrics, &metric.MetricPayload{Metric: &metric.Metric{
+			Service:     name,
+			Description: "Prometheus remote write",
+			Metric:      metric.FloatValue(sample.Value),
+			Host:        host,
+			Attributes:  attributes,
+			Time:        &metric.Timestamp{Time: time.Unix(0, sample.Timestamp*int64(time.Millisecond))},
+		}})
+	}
+	return metrics, nil
+}
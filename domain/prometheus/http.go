@@ -0,0 +1,111 @@
+package prometheus
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+
+	"riemannhttp/domain/metric"
+
+	"github.com/go-chi/render"
+	"github.com/golang/snappy"
+)
+
+const (
+	maxBodySize    = 16 << 20
+	maxDecodedSize = 64 << 20
+)
+
+type HttpTransport interface {
+	Write(w http.ResponseWriter, r *http.Request)
+}
+
+type httpTransport struct {
+	svc       metric.Service
+	limits    *metric.Limits
+	hostLabel string
+}
+
+func NewHTTP(svc metric.Service, limits *metric.Limits, hostLabel string) HttpTransport {
+	return &httpTransport{
+		svc:       svc,
+		limits:    limits,
+		hostLabel: hostLabel,
+	}
+}
+
+// Write receives a snappy compressed remote write request. The samples are
+// validated and sent like the metrics of POST /metrics, the accepted samples
+// are sent even if others are rejected.
+func (h httpTransport) Write(w http.ResponseWriter, r *http.Request) {
+	log.Print("prometheus write received")
+	wr, err := readWriteRequest(w, r)
+	if err != nil {
+		render.Render(w, r, metric.ErrInvalidRequest(err))
+		return
+	}
+
+	total := 0
+	var rejected []error
+	metrics := []*metric.MetricPayload{}
+	for _, ts := range wr.Timeseries {
+		total += len(ts.Samples)
+		tsMetrics, err := Metrics(ts, h.hostLabel)
+		if err != nil {
+			for range ts.Samples {
+				rejected = append(rejected, err)
+			}
+			continue
+		}
+
+		for _, m := range tsMetrics {
+			err := h.limits.Validate(m)
+			if err == nil {
+				err = h.svc.Prepare(m)
+			}
+			if err != nil {
+				rejected = append(rejected, fmt.Errorf("%s: %s", m.Service, err))
+				continue
+			}
+			metrics = append(metrics, m)
+		}
+	}
+
+	if err := h.svc.SendBatch(metrics); err != nil {
+		render.Render(w, r, metric.ErrSendError(err))
+		log.Printf("Error sending prometheus samples: %s", err)
+		return
+	}
+
+	log.Printf("prometheus write queued, samples: %d accepted: %d rejected: %d", total, len(metrics), len(rejected))
+	if len(rejected) > 0 {
+		// Prometheus does not retry the 4xx responses
+		render.Render(w, r, metric.ErrInvalidRequest(fmt.Errorf("%d of %d samples rejected, %s", len(rejected), total, rejected[0])))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func readWriteRequest(w http.ResponseWriter, r *http.Request) (*WriteRequest, error) {
+	if encoding := r.Header.Get("Content-Encoding"); encoding != "" && encoding != "snappy" {
+		return nil, fmt.Errorf("Unsupported Content-Encoding %s, snappy is required", encoding)
+	}
+
+	compressed, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxBodySize))
+	if err != nil {
+		return nil, fmt.Errorf("Cannot read the request: %s", err)
+	}
+	size, err := snappy.DecodedLen(compressed)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid snappy data: %s", err)
+	}
+	if size > maxDecodedSize {
+		return nil, fmt.Errorf("The request is larger than %d bytes", maxDecodedSize)
+	}
+	data, err := snappy.Decode(nil, compressed)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid snappy data: %s", err)
+	}
+	return DecodeWriteRequest(data)
+}
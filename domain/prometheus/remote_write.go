@@ -0,0 +1,108 @@
+package prometheus
+
+import (
+	"fmt"
+
+	"riemannhttp/internal/protofield"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// The remote write protocol, only the fields used to build the events are
+// decoded: https://prometheus.io/docs/concepts/remote_write_spec/
+
+type Label struct {
+	Name  string
+	Value string
+}
+
+type Sample struct {
+	Value float64
+	// Timestamp in milliseconds
+	Timestamp int64
+}
+
+type TimeSeries struct {
+	Labels  []Label
+	Samples []Sample
+}
+
+type WriteRequest struct {
+	Timeseries []TimeSeries
+}
+
+// DecodeWriteRequest parses an uncompressed WriteRequest message
+func DecodeWriteRequest(data []byte) (*WriteRequest, error) {
+	wr := &WriteRequest{}
+	err := protofield.Each(data, func(f protofield.Field) error {
+		if f.Num != 1 || !f.Message() {
+			return nil
+		}
+		ts, err := decodeTimeSeries(f.Bytes)
+		if err != nil {
+			return err
+		}
+		wr.Timeseries = append(wr.Timeseries, ts)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Invalid write request: %s", err)
+	}
+	return wr, nil
+}
+
+func decodeTimeSeries(data []byte) (TimeSeries, error) {
+	ts := TimeSeries{}
+	err := protofield.Each(data, func(f protofield.Field) error {
+		if !f.Message() {
+			return nil
+		}
+		switch f.Num {
+		case 1:
+			label, err := decodeLabel(f.Bytes)
+			if err != nil {
+				return err
+			}
+			ts.Labels = append(ts.Labels, label)
+		case 2:
+			sample, err := decodeSample(f.Bytes)
+			if err != nil {
+				return err
+			}
+			ts.Samples = append(ts.Samples, sample)
+		}
+		return nil
+	})
+	return ts, err
+}
+
+func decodeLabel(data []byte) (Label, error) {
+	label := Label{}
+	err := protofield.Each(data, func(f protofield.Field) error {
+		if !f.Message() {
+			return nil
+		}
+		switch f.Num {
+		case 1:
+			label.Name = string(f.Bytes)
+		case 2:
+			label.Value = string(f.Bytes)
+		}
+		return nil
+	})
+	return label, err
+}
+
+func decodeSample(data []byte) (Sample, error) {
+	sample := Sample{}
+	err := protofield.Each(data, func(f protofield.Field) error {
+		switch {
+		case f.Num == 1 && f.Type == protowire.Fixed64Type:
+			sample.Value = f.Double()
+		case f.Num == 2 && f.Type == protowire.VarintType:
+			sample.Timestamp = int64(f.Number)
+		}
+		return nil
+	})
+	return sample, err
+}
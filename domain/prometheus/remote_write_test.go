@@ -0,0 +1,113 @@
+package prometheus
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func appendMessage(b []byte, num protowire.Number, msg []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, msg)
+}
+
+func encodeLabel(name, value string) []byte {
+	var b []byte
+	b = protowire.AppendTag(b, 1, protowire.BytesType)
+	b = protowire.AppendString(b, name)
+	b = protowire.AppendTag(b, 2, protowire.BytesType)
+	return protowire.AppendString(b, value)
+}
+
+func encodeSample(value float64, timestamp int64) []byte {
+	var b []byte
+	b = protowire.AppendTag(b, 1, protowire.Fixed64Type)
+	b = protowire.AppendFixed64(b, math.Float64bits(value))
+	b = protowire.AppendTag(b, 2, protowire.VarintType)
+	return protowire.AppendVarint(b, uint64(timestamp))
+}
+
+func encodeTimeSeries(labels []Label, samples []Sample) []byte {
+	var b []byte
+	for _, l := range labels {
+		b = appendMessage(b, 1, encodeLabel(l.Name, l.Value))
+	}
+	for _, s := range samples {
+		b = appendMessage(b, 2, encodeSample(s.Value, s.Timestamp))
+	}
+	return b
+}
+
+func TestDecodeWriteRequest(t *testing.T) {
+	series := TimeSeries{
+		Labels:  []Label{{"__name__", "up"}, {"instance", "h:9100"}},
+		Samples: []Sample{{1, 1622541600000}, {0.5, 1622541601000}},
+	}
+	valid := appendMessage(nil, 1, encodeTimeSeries(series.Labels, series.Samples))
+	// metadata (field 3) is not decoded
+	withMetadata := appendMessage(append([]byte{}, valid...), 3, []byte{0x08, 0x01})
+
+	tests := []struct {
+		name string
+		data []byte
+		want *WriteRequest
+		err  bool
+	}{
+		{"empty", nil, &WriteRequest{}, false},
+		{"one series", valid, &WriteRequest{Timeseries: []TimeSeries{series}}, false},
+		{"unknown fields", withMetadata, &WriteRequest{Timeseries: []TimeSeries{series}}, false},
+		{"truncated", valid[:len(valid)-3], nil, true},
+		{"invalid tag", []byte{0xff}, nil, true},
+		{"invalid series", appendMessage(nil, 1, []byte{0x0a, 0x05, 0x01}), nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DecodeWriteRequest(tt.data)
+			if (err != nil) != tt.err {
+				t.Fatalf("err = %v", err)
+			}
+			if err == nil && !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("request = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	tests := []struct {
+		name    string
+		series  TimeSeries
+		metrics int
+		err     bool
+	}{
+		{"samples", TimeSeries{Labels: []Label{{"__name__", "up"}, {"instance", "h"}, {"job", "node"}}, Samples: []Sample{{1, 0}, {2, 1000}}}, 2, false},
+		{"not a number", TimeSeries{Labels: []Label{{"__name__", "up"}}, Samples: []Sample{{math.NaN(), 0}, {math.Inf(1), 0}, {3, 0}}}, 1, false},
+		{"without name", TimeSeries{Labels: []Label{{"instance", "h"}}, Samples: []Sample{{1, 0}}}, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metrics, err := Metrics(tt.series, "instance")
+			if (err != nil) != tt.err {
+				t.Fatalf("err = %v", err)
+			}
+			if len(metrics) != tt.metrics {
+				t.Fatalf("%d metrics, want %d", len(metrics), tt.metrics)
+			}
+		})
+	}
+
+	metrics, _ := Metrics(tests[0].series, "instance")
+	m := metrics[1]
+	if m.Service != "up" || m.Host != "h" || m.Attributes["job"] != "node" || m.Attributes["instance"] != "" {
+		t.Fatalf("metric = %+v", m.Metric)
+	}
+	if m.Time.Unix() != 1 || m.Metric.Metric.Float64() != 2 {
+		t.Fatalf("time %s, value %v", m.Time, m.Metric.Metric.Float64())
+	}
+	m.Attributes["job"] = "changed"
+	if metrics[0].Attributes["job"] != "node" {
+		t.Fatal("the metrics share their attributes")
+	}
+}
@@ -0,0 +1,94 @@
+package query
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/render"
+	riemann "github.com/riemann/riemann-go-client"
+)
+
+type Event struct {
+	Time        time.Time         `json:"time"`
+	Service     string            `json:"service"`
+	Host        string            `json:"host"`
+	State       string            `json:"state,omitempty"`
+	Description string            `json:"description,omitempty"`
+	Metric      interface{}       `json:"metric,omitempty"`
+	Tags        []string          `json:"tags,omitempty"`
+	TTL         float64           `json:"ttl,omitempty"`
+	Attributes  map[string]string `json:"attributes,omitempty"`
+}
+
+func NewEvent(e riemann.Event) Event {
+	return Event{
+		Time:        e.Time,
+		Service:     e.Service,
+		Host:        e.Host,
+		State:       e.State,
+		Description: e.Description,
+		Metric:      e.Metric,
+		Tags:        e.Tags,
+		TTL:         e.TTL.Seconds(),
+		Attributes:  e.Attributes,
+	}
+}
+
+type QueryResponse struct {
+	Events []Event `json:"events"`
+}
+
+func (qr *QueryResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	render.Status(r, http.StatusOK)
+	return nil
+}
+
+type HttpTransport interface {
+	Get(w http.ResponseWriter, r *http.Request)
+}
+
+type httpTransport struct {
+	svc Service
+}
+
+func NewHTTP(svc Service) HttpTransport {
+	return &httpTransport{
+		svc: svc,
+	}
+}
+
+// Get runs the riemann query in q as the authenticated user
+func (h httpTransport) Get(w http.ResponseWriter, r *http.Request) {
+	log.Print("query received")
+	q := r.URL.Query().Get("q")
+	if q == "" {
+		render.Render(w, r, ErrInvalidRequest(errors.New("Query is required")))
+		return
+	}
+
+	user, _, _ := r.BasicAuth()
+	events, err := h.svc.Query(user, q)
+	if errors.Is(err, ErrForbidden) {
+		render.Render(w, r, ErrForbiddenRequest(err))
+		return
+	}
+	var invalid *InvalidQueryError
+	if errors.As(err, &invalid) {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+	if err != nil {
+		render.Render(w, r, ErrBadGateway(err))
+		log.Printf("Error running query %q: %s", q, err)
+		return
+	}
+
+	resp := &QueryResponse{Events: make([]Event, 0, len(events))}
+	for _, e := range events {
+		resp.Events = append(resp.Events, NewEvent(e))
+	}
+	log.Printf("query of %s returned %d events", user, len(resp.Events))
+	render.Render(w, r, resp)
+}
@@ -0,0 +1,129 @@
+package query
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	riemann "github.com/riemann/riemann-go-client"
+)
+
+// ErrForbidden is returned to the users without allowed prefixes
+var ErrForbidden = errors.New("The user is not allowed to query riemann")
+
+// InvalidQueryError is returned for the queries that can not be restricted
+// to the prefixes of the user
+type InvalidQueryError struct {
+	Reason string
+}
+
+func (e *InvalidQueryError) Error() string {
+	return fmt.Sprintf("Invalid query: %s", e.Reason)
+}
+
+// Querier runs riemann index queries
+type Querier interface {
+	Query(q string) ([]riemann.Event, error)
+}
+
+type Service interface {
+	Query(user string, q string) ([]riemann.Event, error)
+}
+
+// NewService restricts the queries of every user to the services starting
+// with its allowed prefixes. An empty prefix allows every service.
+func NewService(querier Querier, allow map[string][]string) Service {
+	return &svc{
+		querier: querier,
+		allow:   allow,
+	}
+}
+
+type svc struct {
+	querier Querier
+	allow   map[string][]string
+}
+
+// Query runs the query limited to the services of the user. The query is
+// wrapped with the prefixes and the events are checked again, so a query can
+// not escape the allowed services.
+func (s *svc) Query(user string, q string) ([]riemann.Event, error) {
+	prefixes, ok := s.allow[user]
+	if !ok || len(prefixes) == 0 {
+		return nil, ErrForbidden
+	}
+
+	restricted, err := Restrict(q, prefixes)
+	if err != nil {
+		return nil, err
+	}
+	events, err := s.querier.Query(restricted)
+	if err != nil {
+		return nil, err
+	}
+	allowed := make([]riemann.Event, 0, len(events))
+	for _, e := range events {
+		if hasPrefix(e.Service, prefixes) {
+			allowed = append(allowed, e)
+		}
+	}
+	return allowed, nil
+}
+
+// Restrict wraps the query to match only the services with the prefixes.
+// The parentheses of the query must be balanced, otherwise it could close the
+// wrapping parenthesis and add conditions outside of it.
+func Restrict(q string, prefixes []string) (string, error) {
+	if err := checkQuery(q); err != nil {
+		return "", err
+	}
+	conditions := make([]string, 0, len(prefixes))
+	for _, prefix := range prefixes {
+		if prefix == "" {
+			return q, nil
+		}
+		conditions = append(conditions, fmt.Sprintf(`service =~ "%s%%"`, quoteEscaper.Replace(prefix)))
+	}
+	return fmt.Sprintf("(%s) and (%s)", strings.Join(conditions, " or "), q), nil
+}
+
+var quoteEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+// checkQuery checks the parentheses outside of the strings are balanced and
+// every string is terminated
+func checkQuery(q string) error {
+	depth := 0
+	inString := false
+	for i := 0; i < len(q); i++ {
+		switch c := q[i]; {
+		case inString && c == '\\':
+			i++
+		case c == '"':
+			inString = !inString
+		case inString:
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+			if depth < 0 {
+				return &InvalidQueryError{Reason: "unbalanced parentheses"}
+			}
+		}
+	}
+	if inString {
+		return &InvalidQueryError{Reason: "unterminated string"}
+	}
+	if depth != 0 {
+		return &InvalidQueryError{Reason: "unbalanced parentheses"}
+	}
+	return nil
+}
+
+func hasPrefix(service string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(service, prefix) {
+			return true
+		}
+	}
+	return false
+}
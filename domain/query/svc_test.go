@@ -0,0 +1,101 @@
+package query
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	riemann "github.com/riemann/riemann-go-client"
+)
+
+func TestRestrict(t *testing.T) {
+	tests := []struct {
+		name     string
+		q        string
+		prefixes []string
+		want     string
+		err      bool
+	}{
+		{"one prefix", `state = "ok"`, []string{"api."}, `(service =~ "api.%") and (state = "ok")`, false},
+		{"several prefixes", `true`, []string{"api.", "web."}, `(service =~ "api.%" or service =~ "web.%") and (true)`, false},
+		{"empty prefix", `true`, []string{"api.", ""}, `true`, false},
+		{"escaped prefix", `true`, []string{`a"b\c`}, `(service =~ "a\"b\\c%") and (true)`, false},
+		{"nested parentheses", `(state = "ok" or (metric > 1))`, []string{"api."}, `(service =~ "api.%") and ((state = "ok" or (metric > 1)))`, false},
+		{"parentheses in strings", `service = "a) or (true"`, []string{"api."}, `(service =~ "api.%") and (service = "a) or (true")`, false},
+		{"escaped quote in string", `service = "a\") or (true"`, []string{"api."}, `(service =~ "api.%") and (service = "a\") or (true")`, false},
+		{"injection", `x) or (true`, []string{"api."}, "", true},
+		{"injection without prefix", `x) or (true`, []string{""}, "", true},
+		{"unclosed parenthesis", `(true`, []string{"api."}, "", true},
+		{"unterminated string", `service = "a`, []string{"api."}, "", true},
+		{"escaped end of string", `service = "a\"`, []string{"api."}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Restrict(tt.q, tt.prefixes)
+			if (err != nil) != tt.err {
+				t.Fatalf("Restrict() error = %v, want error %v", err, tt.err)
+			}
+			if got != tt.want {
+				t.Fatalf("Restrict() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+type testQuerier struct {
+	queries []string
+	events  []riemann.Event
+}
+
+func (q *testQuerier) Query(query string) ([]riemann.Event, error) {
+	q.queries = append(q.queries, query)
+	return q.events, nil
+}
+
+func TestQuery(t *testing.T) {
+	allow := map[string][]string{
+		"team-a": {"api."},
+		"ops":    {""},
+		"none":   {},
+	}
+	events := []riemann.Event{{Service: "api.latency"}, {Service: "web.latency"}}
+	tests := []struct {
+		name     string
+		user     string
+		q        string
+		services []string
+		err      error
+	}{
+		{"post-filter", "team-a", "true", []string{"api.latency"}, nil},
+		{"every service", "ops", "true", []string{"api.latency", "web.latency"}, nil},
+		{"unknown user", "other", "true", nil, ErrForbidden},
+		{"user without prefixes", "none", "true", nil, ErrForbidden},
+		{"injection", "team-a", "x) or (true", nil, &InvalidQueryError{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			querier := &testQuerier{events: events}
+			got, err := NewService(querier, allow).Query(tt.user, tt.q)
+			var invalid *InvalidQueryError
+			switch {
+			case tt.err == nil && err != nil:
+				t.Fatalf("Query: %s", err)
+			case tt.err == ErrForbidden && !errors.Is(err, ErrForbidden):
+				t.Fatalf("Query() error = %v, want %v", err, ErrForbidden)
+			case tt.err != nil && tt.err != ErrForbidden && !errors.As(err, &invalid):
+				t.Fatalf("Query() error = %v, want an invalid query", err)
+			}
+			if tt.err != nil && len(querier.queries) > 0 {
+				t.Fatalf("query %q was sent to riemann", querier.queries[0])
+			}
+
+			var services []string
+			for _, e := range got {
+				services = append(services, e.Service)
+			}
+			if !reflect.DeepEqual(services, tt.services) {
+				t.Fatalf("Query() = %v, want %v", services, tt.services)
+			}
+		})
+	}
+}
@@ -0,0 +1,211 @@
+package statsd
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"riemannhttp/domain/metric"
+)
+
+// maxSamples of every timer kept for the percentiles, the samples are picked
+// at random when there are more values
+const maxSamples = 1000
+
+// maxIdleFlushes is the number of intervals a gauge is kept without updates,
+// then it is removed so the tags with many values do not grow the buckets
+// forever
+const maxIdleFlushes = 10
+
+var percentiles = map[string]float64{metric.StatP50: 50, metric.StatP95: 95, metric.StatP99: 99}
+
+type bucket struct {
+	name string
+	typ  Type
+	tags []string
+
+	// counters and timers
+	sum   float64
+	count float64
+	// gauges
+	value   float64
+	updated bool
+	idle    int
+	// timers
+	min     float64
+	max     float64
+	seen    int64
+	samples []float64
+	// sets
+	members map[string]struct{}
+}
+
+func (b *bucket) add(s Sample) {
+	switch s.Type {
+	case Counter:
+		b.sum += s.Value / s.Rate
+	case Gauge:
+		if s.Relative {
+			b.value += s.Value
+		} else {
+			b.value = s.Value
+		}
+		b.updated = true
+	case Timer, Histogram, Distribution:
+		if b.seen == 0 || s.Value < b.min {
+			b.min = s.Value
+		}
+		if b.seen == 0 || s.Value > b.max {
+			b.max = s.Value
+		}
+		b.seen++
+		b.count += 1 / s.Rate
+		b.sum += s.Value / s.Rate
+
+		// reservoir sampling keeps an uniform sample of the values
+		if len(b.samples) < maxSamples {
+			b.samples = append(b.samples, s.Value)
+		} else if i := rand.Int63n(b.seen); i < maxSamples {
+			b.samples[i] = s.Value
+		}
+	case Set:
+		if b.members == nil {
+			b.members = make(map[string]struct{})
+		}
+		b.members[s.Member] = struct{}{}
+	}
+}
+
+// values returns the metrics of the interval by service. The gauges are only
+// sent when they were updated.
+func (b *bucket) values() map[string]float64 {
+	switch b.typ {
+	case Counter:
+		return map[string]float64{b.name: b.sum}
+	case Gauge:
+		if !b.updated {
+			return nil
+		}
+		return map[string]float64{b.name: b.value}
+	case Set:
+		return map[string]float64{b.name: float64(len(b.members))}
+	}
+
+	sort.Float64s(b.samples)
+	values := map[string]float64{
+		b.name + "." + metric.StatCount: b.count,
+		b.name + "." + metric.StatSum:   b.sum,
+		b.name + "." + metric.StatMin:   b.min,
+		b.name + "." + metric.StatMax:   b.max,
+		b.name + "." + metric.StatMean:  b.sum / b.count,
+	}
+	for stat, p := range percentiles {
+		rank := int(math.Ceil(p / 100 * float64(len(b.samples))))
+		if rank < 1 {
+			rank = 1
+		}
+		values[b.name+"."+stat] = b.samples[rank-1]
+	}
+	return values
+}
+
+// reset starts a new interval and reports whether the bucket must be
+// removed. The gauges keep their value for the relative changes until they
+// are idle for maxIdleFlushes intervals.
+func (b *bucket) reset() bool {
+	if b.typ != Gauge {
+		return true
+	}
+	if b.updated {
+		b.idle = 0
+	} else {
+		b.idle++
+	}
+	b.updated = false
+	return b.idle >= maxIdleFlushes
+}
+
+type aggregator struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	host    string
+}
+
+func newAggregator(host string) *aggregator {
+	return &aggregator{
+		buckets: make(map[string]*bucket),
+		host:    host,
+	}
+}
+
+func (a *aggregator) add(s Sample) {
+	tags := append([]string{}, s.Tags...)
+	sort.Strings(tags)
+	key := string(s.Type) + "|" + s.Name + "|" + strings.Join(tags, ",")
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	b, ok := a.buckets[key]
+	if !ok {
+		b = &bucket{name: s.Name, typ: s.Type, tags: tags}
+		a.buckets[key] = b
+	}
+	b.add(s)
+}
+
+// flush returns the metrics of the interval and starts a new one
+func (a *aggregator) flush(now time.Time) []*metric.MetricPayload {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	metrics := []*metric.MetricPayload{}
+	for key, b := range a.buckets {
+		for service, value := range b.values() {
+			metrics = append(metrics, a.metric(b, service, value, now))
+		}
+		if b.reset() {
+			delete(a.buckets, key)
+		}
+	}
+	return metrics
+}
+
+// metric builds the metric of a bucket. The DogStatsD key:value tags are
+// attributes, the host tag is the host and the rest are tags.
+func (a *aggregator) metric(b *bucket, service string, value float64, now time.Time) *metric.MetricPayload {
+	m := &metric.Metric{
+		Service:     service,
+		Description: "StatsD " + typeNames[b.typ],
+		Metric:      metric.FloatValue(value),
+		Host:        a.host,
+		Time:        &metric.Timestamp{Time: now},
+	}
+	for _, tag := range b.tags {
+		sep := strings.IndexByte(tag, ':')
+		if sep < 0 {
+			m.Tags = append(m.Tags, tag)
+			continue
+		}
+		if tag[:sep] == "host" {
+			m.Host = tag[sep+1:]
+			continue
+		}
+		if m.Attributes == nil {
+			m.Attributes = make(map[string]string)
+		}
+		m.Attributes[tag[:sep]] = tag[sep+1:]
+	}
+	return &metric.MetricPayload{Metric: m}
+}
+
+var typeNames = map[Type]string{
+	Counter:      "counter",
+	Gauge:        "gauge",
+	Timer:        "timer",
+	Histogram:    "histogram",
+	Distribution: "distribution",
+	Set:          "set",
+}
@@ -0,0 +1,89 @@
+package statsd
+
+import (
+	"testing"
+	"time"
+)
+
+func flushValues(a *aggregator) map[string]float64 {
+	values := map[string]float64{}
+	for _, m := range a.flush(time.Now()) {
+		values[m.Service] = m.Metric.Metric.Float64()
+	}
+	return values
+}
+
+func TestAggregatorFlush(t *testing.T) {
+	tests := []struct {
+		name  string
+		lines []string
+		want  map[string]float64
+	}{
+		{"counter with rate", []string{"hits:1|c", "hits:1|c|@0.5"}, map[string]float64{"hits": 3}},
+		{"gauge", []string{"temp:10|g", "temp:+5|g", "temp:-1|g"}, map[string]float64{"temp": 14}},
+		{"set", []string{"users:a|s", "users:b|s", "users:a|s"}, map[string]float64{"users": 2}},
+		{"timer", []string{"lat:1|ms", "lat:2|ms", "lat:3|ms", "lat:4|ms"}, map[string]float64{
+			"lat.count": 4, "lat.sum": 10, "lat.min": 1, "lat.max": 4, "lat.mean": 2.5,
+			"lat.p50": 2, "lat.p95": 4, "lat.p99": 4,
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newAggregator("h")
+			for _, line := range tt.lines {
+				s, err := ParseLine(line)
+				if err != nil {
+					t.Fatal(err)
+				}
+				a.add(s)
+			}
+			got := flushValues(a)
+			if len(got) != len(tt.want) {
+				t.Fatalf("values = %v, want %v", got, tt.want)
+			}
+			for service, value := range tt.want {
+				if got[service] != value {
+					t.Fatalf("%s = %v, want %v", service, got[service], value)
+				}
+			}
+			if values := flushValues(a); len(values) != 0 {
+				t.Fatalf("values of the next interval = %v", values)
+			}
+		})
+	}
+}
+
+func TestAggregatorTags(t *testing.T) {
+	a := newAggregator("default")
+	s, _ := ParseLine("hits:1|c|#host:web1,env:prod,canary")
+	a.add(s)
+	metrics := a.flush(time.Now())
+	if len(metrics) != 1 {
+		t.Fatalf("%d metrics", len(metrics))
+	}
+	m := metrics[0]
+	if m.Host != "web1" || m.Attributes["env"] != "prod" || len(m.Tags) != 1 || m.Tags[0] != "canary" {
+		t.Fatalf("metric = %+v", m.Metric)
+	}
+}
+
+func TestAggregatorEvictsIdleGauges(t *testing.T) {
+	a := newAggregator("h")
+	for i := 0; i < 100; i++ {
+		a.add(Sample{Name: "g", Value: 1, Type: Gauge, Rate: 1, Tags: []string{"request:" + string(rune('a'+i%26)) + string(rune('0'+i/26))}})
+	}
+	a.add(Sample{Name: "kept", Value: 1, Type: Gauge, Rate: 1})
+	a.flush(time.Now())
+
+	for i := 0; i < maxIdleFlushes; i++ {
+		a.add(Sample{Name: "kept", Value: 1, Type: Gauge, Relative: true, Rate: 1})
+		a.flush(time.Now())
+	}
+	if len(a.buckets) != 1 {
+		t.Fatalf("%d buckets after %d idle intervals, want 1", len(a.buckets), maxIdleFlushes)
+	}
+	a.add(Sample{Name: "kept", Value: 1, Type: Gauge, Relative: true, Rate: 1})
+	if values := flushValues(a); values["kept"] != float64(maxIdleFlushes+2) {
+		t.Fatalf("kept gauge = %v", values["kept"])
+	}
+}
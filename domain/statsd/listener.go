@@ -0,0 +1,161 @@
+package statsd
+
+import (
+	"bytes"
+	"log"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"riemannhttp/domain/metric"
+)
+
+type Options struct {
+	// Address of the UDP listener, e.g. :8125
+	Address       string
+	FlushInterval time.Duration
+	// Host of the metrics without a host tag, the hostname if empty
+	Host string
+}
+
+// Listener receives StatsD and DogStatsD packets and sends the aggregated
+// metrics of every interval through the metric service.
+type Listener struct {
+	opts   Options
+	svc    metric.Service
+	limits *metric.Limits
+	agg    *aggregator
+
+	conn     net.PacketConn
+	mu       sync.Mutex
+	invalid  int
+	done     chan struct{}
+	wg       sync.WaitGroup
+	stopOnce sync.Once
+}
+
+func NewListener(svc metric.Service, limits *metric.Limits, opts Options) *Listener {
+	if opts.Host == "" {
+		opts.Host, _ = os.Hostname()
+	}
+	return &Listener{
+		opts:   opts,
+		svc:    svc,
+		limits: limits,
+		agg:    newAggregator(opts.Host),
+		done:   make(chan struct{}),
+	}
+}
+
+// Start listens on the address and starts the flushes
+func (l *Listener) Start() error {
+	conn, err := net.ListenPacket("udp", l.opts.Address)
+	if err != nil {
+		return err
+	}
+	l.conn = conn
+	log.Printf("StatsD listening on %s", conn.LocalAddr())
+
+	l.wg.Add(2)
+	go l.read()
+	go l.flushLoop()
+	return nil
+}
+
+func (l *Listener) read() {
+	defer l.wg.Done()
+	buf := make([]byte, 65535)
+	for {
+		n, _, err := l.conn.ReadFrom(buf)
+		if err != nil {
+			select {
+			case <-l.done:
+				return
+			default:
+			}
+			log.Printf("Error reading statsd packet: %s", err)
+			continue
+		}
+		l.handle(buf[:n])
+	}
+}
+
+// handle aggregates every line of a packet, the invalid lines are counted and
+// reported on the next flush
+func (l *Listener) handle(packet []byte) {
+	for _, line := range bytes.Split(packet, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		s, err := ParseLine(string(line))
+		if err != nil {
+			l.mu.Lock()
+			l.invalid++
+			l.mu.Unlock()
+			continue
+		}
+		l.agg.add(s)
+	}
+}
+
+func (l *Listener) flushLoop() {
+	defer l.wg.Done()
+	ticker := time.NewTicker(l.opts.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.done:
+			l.flush(time.Now())
+			return
+		case now := <-ticker.C:
+			l.flush(now)
+		}
+	}
+}
+
+// flush validates and sends the metrics of the interval like the ones of
+// POST /metrics
+func (l *Listener) flush(now time.Time) {
+	l.mu.Lock()
+	invalid := l.invalid
+	l.invalid = 0
+	l.mu.Unlock()
+
+	metrics := []*metric.MetricPayload{}
+	rejected := 0
+	for _, m := range l.agg.flush(now) {
+		err := l.limits.Validate(m)
+		if err == nil {
+			err = l.svc.Prepare(m)
+		}
+		if err != nil {
+			rejected++
+			log.Printf("StatsD metric %s rejected: %s", m.Service, err)
+			continue
+		}
+		metrics = append(metrics, m)
+	}
+	if len(metrics) == 0 && rejected == 0 && invalid == 0 {
+		return
+	}
+
+	if err := l.svc.SendBatch(metrics); err != nil {
+		log.Printf("Error sending statsd metrics: %s", err)
+		return
+	}
+	log.Printf("statsd flush, sent: %d rejected: %d invalid lines: %d", len(metrics), rejected, invalid)
+}
+
+// Stop closes the listener and sends the current interval
+func (l *Listener) Stop() {
+	l.stopOnce.Do(func() {
+		close(l.done)
+		if l.conn != nil {
+			l.conn.Close()
+		}
+	})
+	l.wg.Wait()
+}
@@ -0,0 +1,92 @@
+package statsd
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+type Type string
+
+const (
+	Counter      = Type("c")
+	Gauge        = Type("g")
+	Timer        = Type("ms")
+	Histogram    = Type("h")
+	Distribution = Type("d")
+	Set          = Type("s")
+)
+
+var errUnsupported = errors.New("events and service checks are not supported")
+
+// Sample is a StatsD line: name:value|type|@rate|#tags. The DogStatsD tags
+// are key:value pairs or plain tags.
+type Sample struct {
+	Name  string
+	Value float64
+	// Member of a set
+	Member string
+	Type   Type
+	// Relative gauges change the current value, they start with + or -
+	Relative bool
+	Rate     float64
+	Tags     []string
+}
+
+// ParseLine parses a single line of a StatsD packet
+func ParseLine(line string) (Sample, error) {
+	s := Sample{Rate: 1}
+	if strings.HasPrefix(line, "_e{") || strings.HasPrefix(line, "_sc|") {
+		return s, errUnsupported
+	}
+
+	parts := strings.Split(line, "|")
+	if len(parts) < 2 {
+		return s, fmt.Errorf("invalid line %q, name:value|type is required", line)
+	}
+	sep := strings.LastIndexByte(parts[0], ':')
+	if sep <= 0 {
+		return s, fmt.Errorf("invalid line %q, name:value|type is required", line)
+	}
+	s.Name = parts[0][:sep]
+	value := parts[0][sep+1:]
+
+	s.Type = Type(parts[1])
+	switch s.Type {
+	case Set:
+		if value == "" {
+			return s, fmt.Errorf("invalid set member in %q", line)
+		}
+		s.Member = value
+	case Counter, Gauge, Timer, Histogram, Distribution:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+			return s, fmt.Errorf("invalid value %q in %q", value, line)
+		}
+		s.Value = f
+		s.Relative = s.Type == Gauge && (value[0] == '+' || value[0] == '-')
+	default:
+		return s, fmt.Errorf("invalid type %q in %q", parts[1], line)
+	}
+
+	// the container id and timestamp fields of DogStatsD are ignored
+	for _, field := range parts[2:] {
+		switch {
+		case strings.HasPrefix(field, "@"):
+			rate, err := strconv.ParseFloat(field[1:], 64)
+			if err != nil || rate <= 0 || rate > 1 {
+				return s, fmt.Errorf("invalid sample rate %q in %q", field, line)
+			}
+			s.Rate = rate
+		case strings.HasPrefix(field, "#"):
+			for _, tag := range strings.Split(field[1:], ",") {
+				if tag != "" {
+					s.Tags = append(s.Tags, tag)
+				}
+			}
+		}
+	}
+	return s, nil
+}
@@ -0,0 +1,49 @@
+package statsd
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseLine(t *testing.T) {
+	tests := []struct {
+		line string
+		want Sample
+		err  bool
+	}{
+		{"hits:1|c", Sample{Name: "hits", Value: 1, Type: Counter, Rate: 1}, false},
+		{"hits:2|c|@0.5", Sample{Name: "hits", Value: 2, Type: Counter, Rate: 0.5}, false},
+		{"temp:21.5|g", Sample{Name: "temp", Value: 21.5, Type: Gauge, Rate: 1}, false},
+		{"temp:-3|g", Sample{Name: "temp", Value: -3, Type: Gauge, Relative: true, Rate: 1}, false},
+		{"temp:+3|g", Sample{Name: "temp", Value: 3, Type: Gauge, Relative: true, Rate: 1}, false},
+		{"latency:12|ms", Sample{Name: "latency", Value: 12, Type: Timer, Rate: 1}, false},
+		{"size:3|h", Sample{Name: "size", Value: 3, Type: Histogram, Rate: 1}, false},
+		{"size:3|d", Sample{Name: "size", Value: 3, Type: Distribution, Rate: 1}, false},
+		{"users:alice|s", Sample{Name: "users", Member: "alice", Type: Set, Rate: 1}, false},
+		{"a:b:1|c", Sample{Name: "a:b", Value: 1, Type: Counter, Rate: 1}, false},
+		{"hits:1|c|#env:prod,canary,|c:container|T1622541600", Sample{Name: "hits", Value: 1, Type: Counter, Rate: 1, Tags: []string{"env:prod", "canary"}}, false},
+		{"hits", Sample{}, true},
+		{"hits:1", Sample{}, true},
+		{":1|c", Sample{}, true},
+		{"hits:x|c", Sample{}, true},
+		{"hits:NaN|c", Sample{}, true},
+		{"hits:Inf|g", Sample{}, true},
+		{"hits:1|x", Sample{}, true},
+		{"users:|s", Sample{}, true},
+		{"hits:1|c|@0", Sample{}, true},
+		{"hits:1|c|@2", Sample{}, true},
+		{"_e{5,4}:title|text", Sample{}, true},
+		{"_sc|check|0", Sample{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			got, err := ParseLine(tt.line)
+			if (err != nil) != tt.err {
+				t.Fatalf("err = %v", err)
+			}
+			if err == nil && !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("sample = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
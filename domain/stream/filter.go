@@ -0,0 +1,118 @@
+package stream
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// Filter selects the streamed events. Every field must match, the services,
+// hosts and attribute values are glob patterns and all the tags are required.
+// The service must also start with one of the prefixes, an empty prefix
+// allows every service.
+type Filter struct {
+	Prefixes   []string
+	Sources    []string
+	Services   []string
+	Hosts      []string
+	Tags       []string
+	Attributes map[string]string
+}
+
+// ParseFilter reads the filter from the query parameters source, service,
+// host, tag and attribute (key=value), every one can be repeated.
+func ParseFilter(values url.Values) (*Filter, error) {
+	f := &Filter{
+		Sources:    values["source"],
+		Services:   values["service"],
+		Hosts:      values["host"],
+		Tags:       values["tag"],
+		Attributes: make(map[string]string),
+	}
+	for _, source := range f.Sources {
+		if source != SourceMetric && source != SourceAlert {
+			return nil, fmt.Errorf("Invalid source %q, %s or %s is required", source, SourceMetric, SourceAlert)
+		}
+	}
+	for _, attribute := range values["attribute"] {
+		parts := strings.SplitN(attribute, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("Invalid attribute %q, key=value is required", attribute)
+		}
+		f.Attributes[parts[0]] = parts[1]
+	}
+
+	patterns := append(append([]string{}, f.Services...), f.Hosts...)
+	for _, value := range f.Attributes {
+		patterns = append(patterns, value)
+	}
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("Invalid pattern %q", pattern)
+		}
+	}
+	return f, nil
+}
+
+// Match reports whether the event passes the filter, a nil filter matches
+// every event
+func (f *Filter) Match(e Event) bool {
+	if f == nil {
+		return true
+	}
+	if len(f.Prefixes) > 0 && !hasPrefix(e.Service, f.Prefixes) {
+		return false
+	}
+	if len(f.Sources) > 0 && !contains(f.Sources, e.Source) {
+		return false
+	}
+	if !globAny(f.Services, e.Service) || !globAny(f.Hosts, e.Host) {
+		return false
+	}
+	for _, tag := range f.Tags {
+		if !contains(e.Tags, tag) {
+			return false
+		}
+	}
+	for key, pattern := range f.Attributes {
+		value, ok := e.Attributes[key]
+		if !ok {
+			return false
+		}
+		if matched, _ := path.Match(pattern, value); !matched {
+			return false
+		}
+	}
+	return true
+}
+
+func globAny(patterns []string, value string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, value); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func hasPrefix(service string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(service, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
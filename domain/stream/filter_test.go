@@ -0,0 +1,68 @@
+package stream
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestFilterMatch(t *testing.T) {
+	event := Event{
+		Source:     SourceMetric,
+		Service:    "core_api.response_time",
+		Host:       "www.example.com",
+		Tags:       []string{"prod"},
+		Attributes: map[string]string{"status_code": "503"},
+	}
+	tests := []struct {
+		name   string
+		filter *Filter
+		match  bool
+	}{
+		{"nil", nil, true},
+		{"empty", &Filter{}, true},
+		{"prefix", &Filter{Prefixes: []string{"web.", "core_api."}}, true},
+		{"other prefix", &Filter{Prefixes: []string{"web."}}, false},
+		{"empty prefix", &Filter{Prefixes: []string{""}}, true},
+		{"prefix and service", &Filter{Prefixes: []string{"web."}, Services: []string{"core_api.*"}}, false},
+		{"source", &Filter{Sources: []string{SourceAlert}}, false},
+		{"service", &Filter{Services: []string{"core_api.*"}}, true},
+		{"host", &Filter{Hosts: []string{"db.*"}}, false},
+		{"tag", &Filter{Tags: []string{"prod"}}, true},
+		{"missing tag", &Filter{Tags: []string{"prod", "eu"}}, false},
+		{"attribute", &Filter{Attributes: map[string]string{"status_code": "5*"}}, true},
+		{"missing attribute", &Filter{Attributes: map[string]string{"ip": "*"}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.filter.Match(event); got != tt.match {
+				t.Errorf("Match() = %v, want %v", got, tt.match)
+			}
+		})
+	}
+}
+
+func TestParseFilter(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		err   bool
+	}{
+		{"empty", "", false},
+		{"all", "source=metric&service=api.*&host=h&tag=prod&attribute=code=5*", false},
+		{"invalid source", "source=log", true},
+		{"invalid attribute", "attribute=code", true},
+		{"invalid pattern", "service=[", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values, err := url.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = ParseFilter(values)
+			if (err != nil) != tt.err {
+				t.Errorf("ParseFilter() error = %v, want error %v", err, tt.err)
+			}
+		})
+	}
+}
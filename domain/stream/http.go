@@ -0,0 +1,187 @@
+package stream
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/render"
+	"github.com/gorilla/websocket"
+)
+
+// writeTimeout limits every websocket write, a stalled client is disconnected
+const writeTimeout = 10 * time.Second
+
+// ErrForbidden is returned to the users without allowed prefixes
+var ErrForbidden = errors.New("The user is not allowed to stream events")
+
+// Dropped is sent before the next event when the buffer of the subscriber
+// was full and events were lost
+type Dropped struct {
+	Dropped uint64 `json:"dropped"`
+}
+
+type HttpTransport interface {
+	Events(w http.ResponseWriter, r *http.Request)
+	WebSocket(w http.ResponseWriter, r *http.Request)
+}
+
+type httpTransport struct {
+	hub       *Hub
+	keepalive time.Duration
+	allow     map[string][]string
+	upgrader  websocket.Upgrader
+}
+
+// NewHTTP streams the events of the hub, a comment or a ping is sent to the
+// idle clients every keepalive. Every user only gets the services starting
+// with its allowed prefixes, like the queries.
+func NewHTTP(hub *Hub, keepalive time.Duration, allow map[string][]string) HttpTransport {
+	return &httpTransport{
+		hub:       hub,
+		keepalive: keepalive,
+		allow:     allow,
+	}
+}
+
+// subscribe parses the filter of the request, limits it to the prefixes of
+// the user and subscribes to the hub, rendering the error if it fails
+func (h *httpTransport) subscribe(w http.ResponseWriter, r *http.Request) *Subscriber {
+	user, _, _ := r.BasicAuth()
+	prefixes := h.allow[user]
+	if len(prefixes) == 0 {
+		render.Render(w, r, ErrForbiddenRequest(ErrForbidden))
+		return nil
+	}
+	filter, err := ParseFilter(r.URL.Query())
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return nil
+	}
+	filter.Prefixes = prefixes
+	sub, err := h.hub.Subscribe(filter)
+	if err != nil {
+		render.Render(w, r, ErrUnavailable(err))
+		return nil
+	}
+	return sub
+}
+
+// Events streams the events as Server-Sent Events
+func (h *httpTransport) Events(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		render.Render(w, r, ErrUnavailable(errors.New("Streaming is not supported")))
+		return
+	}
+	sub := h.subscribe(w, r)
+	if sub == nil {
+		return
+	}
+	defer sub.Close()
+	log.Print("event stream opened")
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	ticker := time.NewTicker(h.keepalive)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-sub.Done():
+			return
+		case <-ticker.C:
+			if _, err := fmt.Fprint(w, ": keepalive\n\n"); err != nil {
+				return
+			}
+		case e := <-sub.Events():
+			if dropped := sub.Dropped(); dropped > 0 {
+				if err := writeSSE(w, "dropped", Dropped{Dropped: dropped}); err != nil {
+					return
+				}
+			}
+			if err := writeSSE(w, "", e); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+func writeSSE(w http.ResponseWriter, event string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if event != "" {
+		if _, err := fmt.Fprintf(w, "event: %s\n", event); err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(w, "data: %s\n\n", data)
+	return err
+}
+
+// WebSocket streams the events as JSON text messages. The messages of the
+// client are discarded.
+func (h *httpTransport) WebSocket(w http.ResponseWriter, r *http.Request) {
+	sub := h.subscribe(w, r)
+	if sub == nil {
+		return
+	}
+	defer sub.Close()
+
+	conn, err := h.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// The upgrader already answered the error
+		log.Printf("Error upgrading websocket: %s", err)
+		return
+	}
+	defer conn.Close()
+	log.Print("websocket stream opened")
+
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		conn.SetReadLimit(512)
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(h.keepalive)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-closed:
+			return
+		case <-sub.Done():
+			conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, ""), time.Now().Add(writeTimeout))
+			return
+		case <-ticker.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeTimeout)); err != nil {
+				return
+			}
+		case e := <-sub.Events():
+			conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+			if dropped := sub.Dropped(); dropped > 0 {
+				if err := conn.WriteJSON(Dropped{Dropped: dropped}); err != nil {
+					return
+				}
+			}
+			if err := conn.WriteJSON(e); err != nil {
+				return
+			}
+		}
+	}
+}
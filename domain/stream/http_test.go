@@ -0,0 +1,26 @@
+package stream
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestEventsForbidden(t *testing.T) {
+	hub := NewHub(Options{BufferSize: 1, MaxSubscribers: 1})
+	defer hub.Close()
+	h := NewHTTP(hub, time.Second, map[string][]string{"team-a": {"core_api."}, "none": {}})
+
+	for _, user := range []string{"", "none", "unknown"} {
+		r := httptest.NewRequest(http.MethodGet, "/stream", nil)
+		if user != "" {
+			r.SetBasicAuth(user, "password")
+		}
+		w := httptest.NewRecorder()
+		h.Events(w, r)
+		if w.Code != http.StatusForbidden {
+			t.Errorf("user %q: status = %d, want %d", user, w.Code, http.StatusForbidden)
+		}
+	}
+}
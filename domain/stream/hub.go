@@ -0,0 +1,199 @@
+package stream
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	riemann "github.com/riemann/riemann-go-client"
+)
+
+// Sources of the streamed events
+const (
+	SourceMetric = "metric"
+	SourceAlert  = "alert"
+)
+
+// ErrTooManySubscribers is returned when the hub has MaxSubscribers
+var ErrTooManySubscribers = errors.New("Too many stream subscribers")
+
+// ErrClosed is returned by the hubs closed on shutdown
+var ErrClosed = errors.New("The stream is closed")
+
+// Event is an event streamed to the subscribers
+type Event struct {
+	Source      string            `json:"source"`
+	Time        time.Time         `json:"time"`
+	Service     string            `json:"service"`
+	Host        string            `json:"host"`
+	State       string            `json:"state,omitempty"`
+	Description string            `json:"description,omitempty"`
+	Metric      interface{}       `json:"metric,omitempty"`
+	Tags        []string          `json:"tags,omitempty"`
+	TTL         float64           `json:"ttl,omitempty"`
+	Attributes  map[string]string `json:"attributes,omitempty"`
+}
+
+func NewEvent(source string, e riemann.Event) Event {
+	return Event{
+		Source:      source,
+		Time:        e.Time,
+		Service:     e.Service,
+		Host:        e.Host,
+		State:       e.State,
+		Description: e.Description,
+		Metric:      e.Metric,
+		Tags:        e.Tags,
+		TTL:         e.TTL.Seconds(),
+		Attributes:  e.Attributes,
+	}
+}
+
+type Options struct {
+	// BufferSize is the number of events kept for every subscriber, the
+	// events are dropped while its buffer is full
+	BufferSize int
+	// MaxSubscribers limits the open streams, 0 is unlimited
+	MaxSubscribers int
+}
+
+// Hub copies the events to the subscribers. Publishing never blocks, a slow
+// subscriber loses the events that do not fit in its buffer.
+type Hub struct {
+	opts        Options
+	mu          sync.RWMutex
+	subscribers map[*Subscriber]struct{}
+	closed      bool
+}
+
+func NewHub(opts Options) *Hub {
+	if opts.BufferSize <= 0 {
+		opts.BufferSize = 1
+	}
+	return &Hub{
+		opts:        opts,
+		subscribers: make(map[*Subscriber]struct{}),
+	}
+}
+
+// Subscriber receives the events matching its filter until it is closed
+type Subscriber struct {
+	hub     *Hub
+	filter  *Filter
+	events  chan Event
+	done    chan struct{}
+	once    sync.Once
+	dropped uint64
+}
+
+// Events are the events received by the subscriber
+func (s *Subscriber) Events() <-chan Event {
+	return s.events
+}
+
+// Done is closed when the subscriber or the hub is closed
+func (s *Subscriber) Done() <-chan struct{} {
+	return s.done
+}
+
+// Dropped returns and resets the number of events dropped since the last call
+func (s *Subscriber) Dropped() uint64 {
+	return atomic.SwapUint64(&s.dropped, 0)
+}
+
+// Close removes the subscriber from the hub
+func (s *Subscriber) Close() {
+	s.hub.mu.Lock()
+	delete(s.hub.subscribers, s)
+	s.hub.mu.Unlock()
+	s.close()
+}
+
+func (s *Subscriber) close() {
+	s.once.Do(func() {
+		close(s.done)
+	})
+}
+
+// Subscribe adds a subscriber of the events matching the filter
+func (h *Hub) Subscribe(filter *Filter) (*Subscriber, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return nil, ErrClosed
+	}
+	if h.opts.MaxSubscribers > 0 && len(h.subscribers) >= h.opts.MaxSubscribers {
+		return nil, ErrTooManySubscribers
+	}
+	s := &Subscriber{
+		hub:    h,
+		filter: filter,
+		events: make(chan Event, h.opts.BufferSize),
+		done:   make(chan struct{}),
+	}
+	h.subscribers[s] = struct{}{}
+	return s, nil
+}
+
+// Publish streams the events accepted by the metric service. It implements
+// metric.Publisher and never fails.
+func (h *Hub) Publish(events ...riemann.Event) error {
+	h.publish(SourceMetric, events)
+	return nil
+}
+
+func (h *Hub) publish(source string, events []riemann.Event) {
+	if h == nil {
+		return
+	}
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if len(h.subscribers) == 0 {
+		return
+	}
+	for _, e := range events {
+		event := NewEvent(source, e)
+		for s := range h.subscribers {
+			if !s.filter.Match(event) {
+				continue
+			}
+			select {
+			case s.events <- event:
+			default:
+				atomic.AddUint64(&s.dropped, 1)
+			}
+		}
+	}
+}
+
+// Close ends every stream, the hub does not accept new subscribers
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
+	for s := range h.subscribers {
+		delete(h.subscribers, s)
+		s.close()
+	}
+}
+
+// Sender delivers events to riemann, like the cerberus actions client
+type Sender interface {
+	Send(events []riemann.Event) error
+}
+
+type alertSender struct {
+	sender Sender
+	hub    *Hub
+}
+
+// Alerts returns a sender that streams the alerts and sends them with sender
+func (h *Hub) Alerts(sender Sender) Sender {
+	return &alertSender{sender: sender, hub: h}
+}
+
+func (a *alertSender) Send(events []riemann.Event) error {
+	a.hub.publish(SourceAlert, events)
+	return a.sender.Send(events)
+}
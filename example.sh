@@ -13,7 +13,7 @@ do
       "state": "ok",
       "attributes": {
         "ip": "152.207.243.130",
-        "statusCode": "200",
+        "status_code": "200",
         "method": "POST",
         "url": "/api/countries",
         "country": "CU"
@@ -3,13 +3,20 @@ module riemannhttp
 go 1.16
 
 require (
-	github.com/go-chi/chi/v5 v5.0.1 // indirect
-	github.com/go-chi/render v1.0.1 // indirect
+	github.com/go-chi/chi/v5 v5.0.1
+	github.com/go-chi/render v1.0.1
 	github.com/go-playground/universal-translator v0.18.0 // indirect
-	github.com/go-redis/redis/v8 v8.11.5 // indirect
-	github.com/golang/protobuf v1.5.2 // indirect
+	github.com/go-redis/redis/v8 v8.11.5
+	github.com/golang/protobuf v1.5.2
+	github.com/golang/snappy v0.0.4
+	github.com/gorilla/websocket v1.5.0
 	github.com/leodido/go-urn v1.2.1 // indirect
-	github.com/patrickmn/go-cache v2.1.0+incompatible // indirect
-	github.com/riemann/riemann-go-client v0.5.0 // indirect
-	gopkg.in/go-playground/validator.v9 v9.31.0 // indirect
+	github.com/mssola/user_agent v0.6.0
+	github.com/oschwald/maxminddb-golang v1.8.0
+	github.com/patrickmn/go-cache v2.1.0+incompatible
+	github.com/riemann/riemann-go-client v0.5.0
+	google.golang.org/protobuf v1.26.0
+	gopkg.in/go-playground/assert.v1 v1.2.1 // indirect
+	gopkg.in/go-playground/validator.v9 v9.31.0
+	gopkg.in/yaml.v3 v3.0.1
 )
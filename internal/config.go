@@ -1,106 +1,559 @@
 package config
 
 import (
-	"os"
 	"time"
 )
 
 type ApiConfig struct {
-	User     string
-	Password string
-	Port     int
+	User     string `yaml:"user"`
+	Password string `yaml:"password"`
+	// Users are more basic auth users by name, with their password
+	Users map[string]string `yaml:"users"`
+	Port  int               `yaml:"port"`
+}
+
+type BackendConfig struct {
+	Name    string `yaml:"name"`
+	Address string `yaml:"address"`
+}
+
+type TLSConfig struct {
+	Enabled    bool   `yaml:"enabled"`
+	CAFile     string `yaml:"ca_file"`
+	CertFile   string `yaml:"cert_file"`
+	KeyFile    string `yaml:"key_file"`
+	ServerName string `yaml:"server_name"`
 }
 
 type RiemannConfig struct {
-	Address        string
-	ConnectTimeout time.Duration
+	// Address is the only backend when Backends is empty
+	Address             string          `yaml:"address"`
+	Backends            []BackendConfig `yaml:"backends"`
+	Mode                string          `yaml:"mode"`
+	ConnectTimeout      time.Duration   `yaml:"connect_timeout"`
+	PoolSize            int             `yaml:"pool_size"`
+	PoolSelection       string          `yaml:"pool_selection"`
+	HealthCheckInterval time.Duration   `yaml:"health_check_interval"`
+	TLS                 TLSConfig       `yaml:"tls"`
+	// Transport is the default transport of the events: tcp or udp
+	Transport   string   `yaml:"transport"`
+	UDPServices []string `yaml:"udp_services"`
 }
 
 type RedisConfig struct {
-	Address  string
-	Password string
-	DB       int
+	Address  string `yaml:"address"`
+	Password string `yaml:"password"`
+	DB       int    `yaml:"db"`
 }
 
 type JenkinsConfig struct {
-	BaseUrl  string
-	Token    string
-	Username string
-	Password string
+	BaseUrl  string `yaml:"base_url"`
+	Token    string `yaml:"token"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+}
+
+type CerberusConfig struct {
+	RulesFile          string        `yaml:"rules_file"`
+	RulesWatchInterval time.Duration `yaml:"rules_watch_interval"`
+	// RejectIncomplete answers 422 to the metrics Cerberus can not analyze
+	RejectIncomplete bool `yaml:"reject_incomplete"`
+}
+
+type DeliveryConfig struct {
+	QueueSize     int           `yaml:"queue_size"`
+	BatchSize     int           `yaml:"batch_size"`
+	FlushInterval time.Duration `yaml:"flush_interval"`
+	FullPolicy    string        `yaml:"full_policy"`
+	BackoffMin    time.Duration `yaml:"backoff_min"`
+	BackoffMax    time.Duration `yaml:"backoff_max"`
+	// Empty disables the spool
+	SpoolDir            string `yaml:"spool_dir"`
+	SpoolMaxSegmentSize int64  `yaml:"spool_max_segment_size"`
+	SpoolMaxSize        int64  `yaml:"spool_max_size"`
+}
+
+type MetricConfig struct {
+	// 0 accepts any time
+	MaxPast   time.Duration `yaml:"max_past"`
+	MaxFuture time.Duration `yaml:"max_future"`
+	// Empty accepts any state
+	States []string `yaml:"states"`
+	// 0 disables the limit
+	MaxTags                 int `yaml:"max_tags"`
+	MaxTagLength            int `yaml:"max_tag_length"`
+	MaxAttributes           int `yaml:"max_attributes"`
+	MaxAttributeKeyLength   int `yaml:"max_attribute_key_length"`
+	MaxAttributeValueLength int `yaml:"max_attribute_value_length"`
+}
+
+type AttributesConfig struct {
+	// Names are matched ignoring the case
+	Names []string `yaml:"names"`
+	// Aliases maps alternate names to the attribute name, ignoring the case
+	Aliases       map[string]string `yaml:"aliases"`
+	LowercaseKeys bool              `yaml:"lowercase_keys"`
+}
+
+type EnrichConfig struct {
+	// Empty uses the default enrichers
+	File string `yaml:"file"`
+}
+
+type TransformConfig struct {
+	// Empty sends the metrics unchanged
+	File string `yaml:"file"`
+}
+
+type ThresholdConfig struct {
+	// Empty keeps the state sent by the clients
+	File string `yaml:"file"`
+}
+
+type AggregateConfig struct {
+	// Empty sends every metric
+	File string `yaml:"file"`
+}
+
+type PrometheusConfig struct {
+	// Label used as the host of the events
+	HostLabel string `yaml:"host_label"`
+}
+
+type StatsdConfig struct {
+	// Address of the UDP listener, empty disables it
+	Address       string        `yaml:"address"`
+	FlushInterval time.Duration `yaml:"flush_interval"`
+	// Host of the metrics without a host tag, the hostname if empty
+	Host string `yaml:"host"`
+}
+
+type OtlpConfig struct {
+	// Resource attributes used as the host, the first one found
+	HostAttributes []string `yaml:"host_attributes"`
+	// Resource attributes copied to the metrics, all of them if empty
+	ResourceAttributes []string `yaml:"resource_attributes"`
+	// Logs enables POST /v1/logs
+	Logs       bool   `yaml:"logs"`
+	LogService string `yaml:"log_service"`
+}
+
+type GraphiteConfig struct {
+	// Address of the TCP listener, empty disables it
+	Address string `yaml:"address"`
+	// Host of the metrics without a host tag, the hostname if empty
+	Host string `yaml:"host"`
+	// ReadTimeout closes the connections without a line in that time
+	ReadTimeout time.Duration `yaml:"read_timeout"`
+	// MaxConnections limits the open connections, 0 is unlimited
+	MaxConnections int `yaml:"max_connections"`
+}
+
+type InfluxConfig struct {
+	// Enabled accepts the line protocol in POST /influx/write
+	Enabled bool `yaml:"enabled"`
+	// Host of the metrics without a host tag, the hostname if empty
+	Host string `yaml:"host"`
+}
+
+type QueryConfig struct {
+	// Allow maps every api user to the service prefixes it can query in
+	// GET /query, the users without prefixes can not query riemann
+	Allow map[string][]string `yaml:"allow"`
+}
+
+type StreamConfig struct {
+	// BufferSize is the number of events kept for every stream client, the
+	// events are dropped while its buffer is full
+	BufferSize int `yaml:"buffer_size"`
+	// MaxSubscribers limits the open streams, 0 is unlimited
+	MaxSubscribers int `yaml:"max_subscribers"`
+	// Keepalive is the interval of the keepalive comments and pings
+	Keepalive time.Duration `yaml:"keepalive"`
 }
 
 type Config struct {
-	apiConfig     ApiConfig
-	riemannConfig RiemannConfig
-	redisConfig   RedisConfig
-	jenkinsConfig JenkinsConfig
+	Api        ApiConfig        `yaml:"api"`
+	Riemann    RiemannConfig    `yaml:"riemann"`
+	Redis      RedisConfig      `yaml:"redis"`
+	Jenkins    JenkinsConfig    `yaml:"jenkins"`
+	Cerberus   CerberusConfig   `yaml:"cerberus"`
+	Delivery   DeliveryConfig   `yaml:"delivery"`
+	Metric     MetricConfig     `yaml:"metric"`
+	Enrich     EnrichConfig     `yaml:"enrich"`
+	Transform  TransformConfig  `yaml:"transform"`
+	Threshold  ThresholdConfig  `yaml:"threshold"`
+	Aggregate  AggregateConfig  `yaml:"aggregate"`
+	Prometheus PrometheusConfig `yaml:"prometheus"`
+	Statsd     StatsdConfig     `yaml:"statsd"`
+	Otlp       OtlpConfig       `yaml:"otlp"`
+	Graphite   GraphiteConfig   `yaml:"graphite"`
+	Influx     InfluxConfig     `yaml:"influx"`
+	Query      QueryConfig      `yaml:"query"`
+	Stream     StreamConfig     `yaml:"stream"`
+	Attributes AttributesConfig `yaml:"attributes"`
 }
 
+// GetApiCredential returns the password of every api user
 func (c *Config) GetApiCredential() map[string]string {
-	return map[string]string{c.apiConfig.User: c.apiConfig.Password}
+	creds := make(map[string]string, len(c.Api.Users)+1)
+	for user, password := range c.Api.Users {
+		creds[user] = password
+	}
+	if c.Api.User != "" {
+		creds[c.Api.User] = c.Api.Password
+	}
+	return creds
 }
 
 func (c *Config) GetApiPort() int {
-	return c.apiConfig.Port
+	return c.Api.Port
 }
 
 func (c *Config) GetRiemannAddress() string {
-	return c.riemannConfig.Address
+	return c.Riemann.Address
+}
+
+// GetRiemannBackends returns the configured backends, or a single backend
+// with the riemann address.
+func (c *Config) GetRiemannBackends() []BackendConfig {
+	if len(c.Riemann.Backends) == 0 {
+		return []BackendConfig{{Name: "default", Address: c.Riemann.Address}}
+	}
+	return c.Riemann.Backends
+}
+
+func (c *Config) GetRiemannMode() string {
+	return c.Riemann.Mode
 }
 
 func (c *Config) GetRiemannConnectTimeout() time.Duration {
-	return c.riemannConfig.ConnectTimeout
+	return c.Riemann.ConnectTimeout
+}
+
+func (c *Config) GetRiemannPoolSize() int {
+	return c.Riemann.PoolSize
+}
+
+func (c *Config) GetRiemannPoolSelection() string {
+	return c.Riemann.PoolSelection
+}
+
+func (c *Config) GetRiemannHealthCheckInterval() time.Duration {
+	return c.Riemann.HealthCheckInterval
+}
+
+func (c *Config) GetRiemannTLSEnabled() bool {
+	return c.Riemann.TLS.Enabled
+}
+
+func (c *Config) GetRiemannTLSCAFile() string {
+	return c.Riemann.TLS.CAFile
+}
+
+func (c *Config) GetRiemannTLSCertFile() string {
+	return c.Riemann.TLS.CertFile
+}
+
+func (c *Config) GetRiemannTLSKeyFile() string {
+	return c.Riemann.TLS.KeyFile
+}
+
+func (c *Config) GetRiemannTLSServerName() string {
+	return c.Riemann.TLS.ServerName
+}
+
+func (c *Config) GetRiemannTransport() string {
+	return c.Riemann.Transport
+}
+
+func (c *Config) GetRiemannUDPServices() []string {
+	return c.Riemann.UDPServices
 }
 
 func (c *Config) GetRedisAddress() string {
-	return c.redisConfig.Address
+	return c.Redis.Address
 }
 
 func (c *Config) GetRedisPassword() string {
-	return c.redisConfig.Password
+	return c.Redis.Password
 }
 
 func (c *Config) GetRedisDB() int {
-	return c.redisConfig.DB
+	return c.Redis.DB
 }
 
 func (c *Config) GetJenkinsBaseUrl() string {
-	return c.jenkinsConfig.BaseUrl
+	return c.Jenkins.BaseUrl
 }
 
 func (c *Config) GetJenkinsToken() string {
-	return c.jenkinsConfig.Token
+	return c.Jenkins.Token
 }
 
 func (c *Config) GetJenkinsUsername() string {
-	return c.jenkinsConfig.Username
+	return c.Jenkins.Username
 }
 
 func (c *Config) GetJenkinsPassword() string {
-	return c.jenkinsConfig.Password
+	return c.Jenkins.Password
+}
+
+func (c *Config) GetCerberusRulesFile() string {
+	return c.Cerberus.RulesFile
+}
+
+func (c *Config) GetCerberusRulesWatchInterval() time.Duration {
+	return c.Cerberus.RulesWatchInterval
+}
+
+func (c *Config) GetDeliveryQueueSize() int {
+	return c.Delivery.QueueSize
+}
+
+func (c *Config) GetDeliveryBatchSize() int {
+	return c.Delivery.BatchSize
+}
+
+func (c *Config) GetDeliveryFlushInterval() time.Duration {
+	return c.Delivery.FlushInterval
+}
+
+func (c *Config) GetDeliveryFullPolicy() string {
+	return c.Delivery.FullPolicy
+}
+
+func (c *Config) GetDeliveryBackoffMin() time.Duration {
+	return c.Delivery.BackoffMin
+}
+
+func (c *Config) GetDeliveryBackoffMax() time.Duration {
+	return c.Delivery.BackoffMax
+}
+
+func (c *Config) GetDeliverySpoolDir() string {
+	return c.Delivery.SpoolDir
+}
+
+func (c *Config) GetDeliverySpoolMaxSegmentSize() int64 {
+	return c.Delivery.SpoolMaxSegmentSize
 }
 
-func GetConfig() *Config {
+func (c *Config) GetDeliverySpoolMaxSize() int64 {
+	return c.Delivery.SpoolMaxSize
+}
+
+func (c *Config) GetMetricMaxPast() time.Duration {
+	return c.Metric.MaxPast
+}
+
+func (c *Config) GetMetricMaxFuture() time.Duration {
+	return c.Metric.MaxFuture
+}
+
+func (c *Config) GetMetricStates() []string {
+	return c.Metric.States
+}
+
+func (c *Config) GetMetricMaxTags() int {
+	return c.Metric.MaxTags
+}
+
+func (c *Config) GetMetricMaxTagLength() int {
+	return c.Metric.MaxTagLength
+}
+
+func (c *Config) GetMetricMaxAttributes() int {
+	return c.Metric.MaxAttributes
+}
+
+func (c *Config) GetMetricMaxAttributeKeyLength() int {
+	return c.Metric.MaxAttributeKeyLength
+}
+
+func (c *Config) GetMetricMaxAttributeValueLength() int {
+	return c.Metric.MaxAttributeValueLength
+}
+
+func (c *Config) GetEnrichFile() string {
+	return c.Enrich.File
+}
+
+func (c *Config) GetTransformFile() string {
+	return c.Transform.File
+}
+
+func (c *Config) GetThresholdFile() string {
+	return c.Threshold.File
+}
+
+func (c *Config) GetAggregateFile() string {
+	return c.Aggregate.File
+}
+
+func (c *Config) GetPrometheusHostLabel() string {
+	return c.Prometheus.HostLabel
+}
+
+func (c *Config) GetStatsdAddress() string {
+	return c.Statsd.Address
+}
+
+func (c *Config) GetStatsdFlushInterval() time.Duration {
+	return c.Statsd.FlushInterval
+}
+
+func (c *Config) GetStatsdHost() string {
+	return c.Statsd.Host
+}
+
+func (c *Config) GetOtlpHostAttributes() []string {
+	return c.Otlp.HostAttributes
+}
+
+func (c *Config) GetOtlpResourceAttributes() []string {
+	return c.Otlp.ResourceAttributes
+}
+
+func (c *Config) GetOtlpLogs() bool {
+	return c.Otlp.Logs
+}
+
+func (c *Config) GetOtlpLogService() string {
+	return c.Otlp.LogService
+}
+
+func (c *Config) GetGraphiteAddress() string {
+	return c.Graphite.Address
+}
+
+func (c *Config) GetGraphiteHost() string {
+	return c.Graphite.Host
+}
+
+func (c *Config) GetGraphiteReadTimeout() time.Duration {
+	return c.Graphite.ReadTimeout
+}
+
+func (c *Config) GetGraphiteMaxConnections() int {
+	return c.Graphite.MaxConnections
+}
+
+func (c *Config) GetInfluxEnabled() bool {
+	return c.Influx.Enabled
+}
+
+func (c *Config) GetInfluxHost() string {
+	return c.Influx.Host
+}
+
+func (c *Config) GetQueryAllow() map[string][]string {
+	return c.Query.Allow
+}
+
+func (c *Config) GetStreamBufferSize() int {
+	return c.Stream.BufferSize
+}
+
+func (c *Config) GetStreamMaxSubscribers() int {
+	return c.Stream.MaxSubscribers
+}
+
+func (c *Config) GetStreamKeepalive() time.Duration {
+	return c.Stream.Keepalive
+}
+
+func (c *Config) GetCerberusRejectIncomplete() bool {
+	return c.Cerberus.RejectIncomplete
+}
+
+func (c *Config) GetAttributeNames() []string {
+	return c.Attributes.Names
+}
+
+func (c *Config) GetAttributeAliases() map[string]string {
+	return c.Attributes.Aliases
+}
+
+func (c *Config) GetAttributeLowercaseKeys() bool {
+	return c.Attributes.LowercaseKeys
+}
+
+func defaultConfig() *Config {
 	return &Config{
-		apiConfig: ApiConfig{
-			User:     os.Getenv("AUTH_USER"),
-			Password: os.Getenv("AUTH_PASSWORD"),
-			Port:     8080,
+		Api: ApiConfig{
+			Port: 8080,
 		},
-		riemannConfig: RiemannConfig{
-			Address:        "127.0.0.1:5555",
-			ConnectTimeout: 10 * time.Second,
+		Riemann: RiemannConfig{
+			Address:             "127.0.0.1:5555",
+			Mode:                "failover",
+			ConnectTimeout:      10 * time.Second,
+			PoolSize:            2,
+			PoolSelection:       "round-robin",
+			HealthCheckInterval: 10 * time.Second,
+			Transport:           "tcp",
 		},
-		redisConfig: RedisConfig{
+		Redis: RedisConfig{
 			Address:  "127.0.0.1:6379",
 			Password: "",
 			DB:       0,
 		},
-		jenkinsConfig: JenkinsConfig{
-			BaseUrl:  "https://jenkins.tropipay.com",
-			Token:    os.Getenv("JENKINS_TOKEN"),
-			Username: os.Getenv("JENKINS_USER"),
-			Password: os.Getenv("JENKINS_PASSWORD"),
+		Jenkins: JenkinsConfig{
+			BaseUrl: "https://jenkins.tropipay.com",
+		},
+		Cerberus: CerberusConfig{
+			RulesFile:          "rules.yaml",
+			RulesWatchInterval: 10 * time.Second,
+		},
+		Attributes: AttributesConfig{
+			Names: []string{"ip", "asn", "url", "status_code", "method"},
+			Aliases: map[string]string{
+				"statusCode": "status_code",
+				"clientIp":   "ip",
+				"httpMethod": "method",
+			},
+		},
+		Delivery: DeliveryConfig{
+			QueueSize:     10000,
+			BatchSize:     100,
+			FlushInterval: time.Second,
+			FullPolicy:    "block",
+			BackoffMin:    100 * time.Millisecond,
+			BackoffMax:    30 * time.Second,
+
+			SpoolMaxSegmentSize: 64 << 20,
+			SpoolMaxSize:        1 << 30,
+		},
+		Metric: MetricConfig{
+			MaxPast:   24 * time.Hour,
+			MaxFuture: 10 * time.Minute,
+			States:    []string{"ok", "warning", "error", "critical"},
+
+			MaxTags:                 32,
+			MaxTagLength:            128,
+			MaxAttributes:           32,
+			MaxAttributeKeyLength:   128,
+			MaxAttributeValueLength: 1024,
+		},
+		Prometheus: PrometheusConfig{
+			HostLabel: "instance",
+		},
+		Statsd: StatsdConfig{
+			FlushInterval: 10 * time.Second,
+		},
+		Otlp: OtlpConfig{
+			HostAttributes:     []string{"host.name", "service.instance.id"},
+			ResourceAttributes: []string{"service.name", "service.namespace", "service.version", "deployment.environment"},
+			LogService:         "log",
+		},
+		Graphite: GraphiteConfig{
+			ReadTimeout:    time.Minute,
+			MaxConnections: 100,
+		},
+		Stream: StreamConfig{
+			BufferSize:     100,
+			MaxSubscribers: 100,
+			Keepalive:      15 * time.Second,
 		},
 	}
 }
@@ -0,0 +1,489 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// binding links a config field with its environment variable and its
+// command line flag. The secrets have no flag, the arguments of a process
+// can be read by every user of the host.
+type binding struct {
+	env   string
+	flag  string
+	usage string
+	set   func(string) error
+}
+
+func stringVar(p *string) func(string) error {
+	return func(value string) error {
+		*p = value
+		return nil
+	}
+}
+
+func intVar(p *int) func(string) error {
+	return func(value string) error {
+		v, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", value)
+		}
+		*p = v
+		return nil
+	}
+}
+
+func int64Var(p *int64) func(string) error {
+	return func(value string) error {
+		v, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", value)
+		}
+		*p = v
+		return nil
+	}
+}
+
+func boolVar(p *bool) func(string) error {
+	return func(value string) error {
+		v, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", value)
+		}
+		*p = v
+		return nil
+	}
+}
+
+func durationVar(p *time.Duration) func(string) error {
+	return func(value string) error {
+		v, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q", value)
+		}
+		*p = v
+		return nil
+	}
+}
+
+// stringsVar parses a comma separated list
+func stringsVar(p *[]string) func(string) error {
+	return func(value string) error {
+		items := []string{}
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		*p = items
+		return nil
+	}
+}
+
+// aliasesVar parses a comma separated list of alias=name pairs
+func aliasesVar(p *map[string]string) func(string) error {
+	return func(value string) error {
+		aliases := make(map[string]string)
+		for _, item := range strings.Split(value, ",") {
+			item = strings.TrimSpace(item)
+			if item == "" {
+				continue
+			}
+			parts := strings.SplitN(item, "=", 2)
+			if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+				return fmt.Errorf("invalid alias %q, alias=name is required", item)
+			}
+			aliases[parts[0]] = parts[1]
+		}
+		*p = aliases
+		return nil
+	}
+}
+
+// credentialsVar parses a comma separated list of user=password pairs, the
+// passwords can not contain commas
+func credentialsVar(p *map[string]string) func(string) error {
+	return func(value string) error {
+		creds := make(map[string]string)
+		for _, item := range strings.Split(value, ",") {
+			item = strings.TrimSpace(item)
+			if item == "" {
+				continue
+			}
+			parts := strings.SplitN(item, "=", 2)
+			if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+				return fmt.Errorf("invalid api user %q, user=password is required", parts[0])
+			}
+			creds[parts[0]] = parts[1]
+		}
+		*p = creds
+		return nil
+	}
+}
+
+// prefixesVar parses a comma separated list of user=prefix pairs, the
+// prefixes of a user are separated by |: team-a=api.|web.,team-b=db.
+func prefixesVar(p *map[string][]string) func(string) error {
+	return func(value string) error {
+		prefixes := make(map[string][]string)
+		for _, item := range strings.Split(value, ",") {
+			item = strings.TrimSpace(item)
+			if item == "" {
+				continue
+			}
+			parts := strings.SplitN(item, "=", 2)
+			if len(parts) != 2 || parts[0] == "" {
+				return fmt.Errorf("invalid query prefixes %q, user=prefix is required", item)
+			}
+			prefixes[parts[0]] = append(prefixes[parts[0]], strings.Split(parts[1], "|")...)
+		}
+		*p = prefixes
+		return nil
+	}
+}
+
+// backendsVar parses a comma separated list of addresses, every address can
+// be prefixed by a name: primary=10.0.0.1:5555,secondary=10.0.0.2:5555
+func backendsVar(p *[]BackendConfig) func(string) error {
+	return func(value string) error {
+		backends := []BackendConfig{}
+		for i, item := range strings.Split(value, ",") {
+			item = strings.TrimSpace(item)
+			if item == "" {
+				continue
+			}
+			backend := BackendConfig{Name: fmt.Sprintf("riemann-%d", i), Address: item}
+			if parts := strings.SplitN(item, "=", 2); len(parts) == 2 {
+				backend.Name = parts[0]
+				backend.Address = parts[1]
+			}
+			backends = append(backends, backend)
+		}
+		*p = backends
+		return nil
+	}
+}
+
+func (c *Config) bindings() []binding {
+	return []binding{
+		{"AUTH_USER", "api-user", "user of the API basic auth", stringVar(&c.Api.User)},
+		{"AUTH_PASSWORD", "", "password of the API basic auth", stringVar(&c.Api.Password)},
+		{"API_USERS", "", "comma separated list of user=password of more API basic auth users", credentialsVar(&c.Api.Users)},
+		{"API_PORT", "api-port", "port of the HTTP server", intVar(&c.Api.Port)},
+		{"RIEMANN_ADDRESS", "riemann-address", "address of the Riemann server", stringVar(&c.Riemann.Address)},
+		{"RIEMANN_BACKENDS", "riemann-backends", "comma separated list of [name=]address of Riemann servers, overrides the address", backendsVar(&c.Riemann.Backends)},
+		{"RIEMANN_MODE", "riemann-mode", "how events are sent to the backends: fan-out, failover or shard", stringVar(&c.Riemann.Mode)},
+		{"RIEMANN_CONNECT_TIMEOUT", "riemann-connect-timeout", "timeout of the Riemann connection", durationVar(&c.Riemann.ConnectTimeout)},
+		{"RIEMANN_POOL_SIZE", "riemann-pool-size", "number of connections to Riemann", intVar(&c.Riemann.PoolSize)},
+		{"RIEMANN_POOL_SELECTION", "riemann-pool-selection", "how a connection is selected: round-robin or least-busy", stringVar(&c.Riemann.PoolSelection)},
+		{"RIEMANN_HEALTH_CHECK_INTERVAL", "riemann-health-check-interval", "interval of the Riemann connections health checks (0 disables them)", durationVar(&c.Riemann.HealthCheckInterval)},
+		{"RIEMANN_TLS", "riemann-tls", "connect to Riemann with TLS", boolVar(&c.Riemann.TLS.Enabled)},
+		{"RIEMANN_TLS_CA_FILE", "riemann-tls-ca-file", "CA bundle to verify the Riemann server (system roots if empty)", stringVar(&c.Riemann.TLS.CAFile)},
+		{"RIEMANN_TLS_CERT_FILE", "riemann-tls-cert-file", "client certificate for Riemann", stringVar(&c.Riemann.TLS.CertFile)},
+		{"RIEMANN_TLS_KEY_FILE", "riemann-tls-key-file", "client certificate key for Riemann", stringVar(&c.Riemann.TLS.KeyFile)},
+		{"RIEMANN_TLS_SERVER_NAME", "riemann-tls-server-name", "name to verify the Riemann server certificate (host of the address if empty)", stringVar(&c.Riemann.TLS.ServerName)},
+		{"RIEMANN_TRANSPORT", "riemann-transport", "default transport of the events: tcp or udp", stringVar(&c.Riemann.Transport)},
+		{"RIEMANN_UDP_SERVICES", "riemann-udp-services", "comma separated list of services always sent over UDP", stringsVar(&c.Riemann.UDPServices)},
+		{"REDIS_ADDRESS", "redis-address", "address of the Redis server", stringVar(&c.Redis.Address)},
+		{"REDIS_PASSWORD", "", "password of the Redis server", stringVar(&c.Redis.Password)},
+		{"REDIS_DB", "redis-db", "Redis database", intVar(&c.Redis.DB)},
+		{"JENKINS_BASE_URL", "jenkins-base-url", "base URL of Jenkins", stringVar(&c.Jenkins.BaseUrl)},
+		{"JENKINS_TOKEN", "", "token of the Jenkins jobs", stringVar(&c.Jenkins.Token)},
+		{"JENKINS_USER", "jenkins-user", "user of Jenkins", stringVar(&c.Jenkins.Username)},
+		{"JENKINS_PASSWORD", "", "password of Jenkins", stringVar(&c.Jenkins.Password)},
+		{"CERBERUS_RULES_FILE", "cerberus-rules-file", "path of the Cerberus rules file", stringVar(&c.Cerberus.RulesFile)},
+		{"CERBERUS_RULES_WATCH_INTERVAL", "cerberus-rules-watch-interval", "interval to check the rules file for changes (0 disables it)", durationVar(&c.Cerberus.RulesWatchInterval)},
+		{"CERBERUS_REJECT_INCOMPLETE", "cerberus-reject-incomplete", "answer 422 to the metrics of the Cerberus services that can not be analyzed", boolVar(&c.Cerberus.RejectIncomplete)},
+		{"DELIVERY_QUEUE_SIZE", "delivery-queue-size", "max events waiting to be sent to Riemann", intVar(&c.Delivery.QueueSize)},
+		{"DELIVERY_BATCH_SIZE", "delivery-batch-size", "max events sent to Riemann in a single message", intVar(&c.Delivery.BatchSize)},
+		{"DELIVERY_FLUSH_INTERVAL", "delivery-flush-interval", "max time an event waits to be sent", durationVar(&c.Delivery.FlushInterval)},
+		{"DELIVERY_FULL_POLICY", "delivery-full-policy", "what to do when the queue is full: block, drop-oldest or reject", stringVar(&c.Delivery.FullPolicy)},
+		{"DELIVERY_BACKOFF_MIN", "delivery-backoff-min", "first retry delay after a failed send", durationVar(&c.Delivery.BackoffMin)},
+		{"DELIVERY_BACKOFF_MAX", "delivery-backoff-max", "max retry delay after failed sends", durationVar(&c.Delivery.BackoffMax)},
+		{"DELIVERY_SPOOL_DIR", "delivery-spool-dir", "directory of the disk spool for undelivered events (empty disables it)", stringVar(&c.Delivery.SpoolDir)},
+		{"DELIVERY_SPOOL_MAX_SEGMENT_SIZE", "delivery-spool-max-segment-size", "max bytes of a spool segment file", int64Var(&c.Delivery.SpoolMaxSegmentSize)},
+		{"DELIVERY_SPOOL_MAX_SIZE", "delivery-spool-max-size", "max bytes of the spool, the oldest segments are dropped over it", int64Var(&c.Delivery.SpoolMaxSize)},
+		{"METRIC_MAX_PAST", "metric-max-past", "how old the time of a metric can be (0 accepts any)", durationVar(&c.Metric.MaxPast)},
+		{"METRIC_MAX_FUTURE", "metric-max-future", "how far in the future the time of a metric can be (0 accepts any)", durationVar(&c.Metric.MaxFuture)},
+		{"METRIC_STATES", "metric-states", "comma separated list of the accepted states (empty accepts any)", stringsVar(&c.Metric.States)},
+		{"METRIC_MAX_TAGS", "metric-max-tags", "max tags of a metric (0 disables the limit)", intVar(&c.Metric.MaxTags)},
+		{"METRIC_MAX_TAG_LENGTH", "metric-max-tag-length", "max bytes of a tag (0 disables the limit)", intVar(&c.Metric.MaxTagLength)},
+		{"METRIC_MAX_ATTRIBUTES", "metric-max-attributes", "max attributes of a metric (0 disables the limit)", intVar(&c.Metric.MaxAttributes)},
+		{"METRIC_MAX_ATTRIBUTE_KEY_LENGTH", "metric-max-attribute-key-length", "max bytes of an attribute key (0 disables the limit)", intVar(&c.Metric.MaxAttributeKeyLength)},
+		{"METRIC_MAX_ATTRIBUTE_VALUE_LENGTH", "metric-max-attribute-value-length", "max bytes of an attribute value (0 disables the limit)", intVar(&c.Metric.MaxAttributeValueLength)},
+		{"ATTRIBUTE_NAMES", "attribute-names", "comma separated list of metric attributes matched ignoring the case", stringsVar(&c.Attributes.Names)},
+		{"ATTRIBUTE_ALIASES", "attribute-aliases", "comma separated list of alias=name of the metric attributes, the case is ignored", aliasesVar(&c.Attributes.Aliases)},
+		{"ATTRIBUTE_LOWERCASE_KEYS", "attribute-lowercase-keys", "lowercase the keys of the metric attributes", boolVar(&c.Attributes.LowercaseKeys)},
+		{"ENRICH_FILE", "enrich-file", "file of the metric enrichers (the asn of core_api.response_time if empty)", stringVar(&c.Enrich.File)},
+		{"TRANSFORM_FILE", "transform-file", "file of the metric transformation rules", stringVar(&c.Transform.File)},
+		{"THRESHOLD_FILE", "threshold-file", "file of the per service state thresholds", stringVar(&c.Threshold.File)},
+		{"AGGREGATE_FILE", "aggregate-file", "file of the aggregated services", stringVar(&c.Aggregate.File)},
+		{"PROMETHEUS_HOST_LABEL", "prometheus-host-label", "label of the Prometheus samples used as the host", stringVar(&c.Prometheus.HostLabel)},
+		{"STATSD_ADDRESS", "statsd-address", "address of the StatsD UDP listener, e.g. :8125 (empty disables it)", stringVar(&c.Statsd.Address)},
+		{"STATSD_FLUSH_INTERVAL", "statsd-flush-interval", "interval of the StatsD aggregation", durationVar(&c.Statsd.FlushInterval)},
+		{"STATSD_HOST", "statsd-host", "host of the StatsD metrics without a host tag (the hostname if empty)", stringVar(&c.Statsd.Host)},
+		{"OTLP_HOST_ATTRIBUTES", "otlp-host-attributes", "comma separated list of the OTLP resource attributes used as the host, the first one found", stringsVar(&c.Otlp.HostAttributes)},
+		{"OTLP_RESOURCE_ATTRIBUTES", "otlp-resource-attributes", "comma separated list of the OTLP resource attributes copied to the metrics (empty copies all)", stringsVar(&c.Otlp.ResourceAttributes)},
+		{"OTLP_LOGS", "otlp-logs", "accept OTLP logs in POST /v1/logs", boolVar(&c.Otlp.Logs)},
+		{"OTLP_LOG_SERVICE", "otlp-log-service", "service of the OTLP log records", stringVar(&c.Otlp.LogService)},
+		{"GRAPHITE_ADDRESS", "graphite-address", "address of the Graphite plaintext TCP listener, e.g. :2003 (empty disables it)", stringVar(&c.Graphite.Address)},
+		{"GRAPHITE_HOST", "graphite-host", "host of the Graphite metrics without a host tag (the hostname if empty)", stringVar(&c.Graphite.Host)},
+		{"GRAPHITE_READ_TIMEOUT", "graphite-read-timeout", "time to wait for the next line of a Graphite connection before closing it", durationVar(&c.Graphite.ReadTimeout)},
+		{"GRAPHITE_MAX_CONNECTIONS", "graphite-max-connections", "maximum number of open Graphite connections (0 is unlimited)", intVar(&c.Graphite.MaxConnections)},
+		{"INFLUX_ENABLED", "influx-enabled", "accept the InfluxDB line protocol in POST /influx/write", boolVar(&c.Influx.Enabled)},
+		{"INFLUX_HOST", "influx-host", "host of the InfluxDB metrics without a host tag (the hostname if empty)", stringVar(&c.Influx.Host)},
+		{"QUERY_ALLOW", "query-allow", "comma separated list of user=prefix of the services every user can query in GET /query, several prefixes are separated by |", prefixesVar(&c.Query.Allow)},
+		{"STREAM_BUFFER_SIZE", "stream-buffer-size", "events kept for every stream client, the events are dropped while it is full", intVar(&c.Stream.BufferSize)},
+		{"STREAM_MAX_SUBSCRIBERS", "stream-max-subscribers", "maximum number of open streams (0 is unlimited)", intVar(&c.Stream.MaxSubscribers)},
+		{"STREAM_KEEPALIVE", "stream-keepalive", "interval of the stream keepalive comments and pings", durationVar(&c.Stream.Keepalive)},
+	}
+}
+
+// GetConfig loads the configuration from the process arguments and
+// environment.
+func GetConfig() (*Config, error) {
+	return Load(os.Args[1:], os.LookupEnv)
+}
+
+// Load builds the configuration. Every layer overrides the previous one:
+// defaults, config file (-config flag or CONFIG_FILE), environment variables
+// and command line flags.
+func Load(args []string, lookupEnv func(string) (string, bool)) (*Config, error) {
+	c := defaultConfig()
+	bindings := c.bindings()
+
+	fs := flag.NewFlagSet("riemann-http", flag.ContinueOnError)
+	configFile := fs.String("config", "", "path of the YAML config file (env CONFIG_FILE)")
+	flagValues := make(map[string]string)
+	for _, b := range bindings {
+		name := b.flag
+		if name == "" {
+			continue
+		}
+		fs.Func(name, fmt.Sprintf("%s (env %s)", b.usage, b.env), func(value string) error {
+			flagValues[name] = value
+			return nil
+		})
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	path := *configFile
+	if path == "" {
+		path, _ = lookupEnv("CONFIG_FILE")
+	}
+	if path != "" {
+		if err := c.readFile(path); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, b := range bindings {
+		value, ok := lookupEnv(b.env)
+		if !ok {
+			continue
+		}
+		if err := b.set(value); err != nil {
+			return nil, fmt.Errorf("Invalid value for %s: %s", b.env, err)
+		}
+	}
+
+	for _, b := range bindings {
+		value, ok := flagValues[b.flag]
+		if !ok || b.flag == "" {
+			continue
+		}
+		if err := b.set(value); err != nil {
+			return nil, fmt.Errorf("Invalid value for -%s: %s", b.flag, err)
+		}
+	}
+
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *Config) readFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("Cannot open config file: %s", err)
+	}
+	defer f.Close()
+
+	decoder := yaml.NewDecoder(f)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(c); err != nil {
+		return fmt.Errorf("Invalid config file %s: %s", path, err)
+	}
+	return nil
+}
+
+// Validate checks the whole configuration and reports all the errors at once.
+func (c *Config) Validate() error {
+	var errs []string
+	if c.Api.User == "" && len(c.Api.Users) == 0 {
+		errs = append(errs, "api user is required (AUTH_USER or API_USERS)")
+	}
+	if c.Api.User != "" && c.Api.Password == "" {
+		errs = append(errs, "api password is required (AUTH_PASSWORD)")
+	}
+	users := make([]string, 0, len(c.Api.Users))
+	for user := range c.Api.Users {
+		users = append(users, user)
+	}
+	sort.Strings(users)
+	for _, user := range users {
+		if user == "" || c.Api.Users[user] == "" {
+			errs = append(errs, fmt.Sprintf("api user %q requires a name and a password", user))
+		}
+	}
+	if c.Api.Port <= 0 || c.Api.Port > 65535 {
+		errs = append(errs, fmt.Sprintf("api port %d is not valid", c.Api.Port))
+	}
+	if c.Riemann.Address == "" && len(c.Riemann.Backends) == 0 {
+		errs = append(errs, "riemann address is required")
+	}
+	names := make(map[string]bool)
+	for i, backend := range c.Riemann.Backends {
+		if backend.Name == "" || backend.Address == "" {
+			errs = append(errs, fmt.Sprintf("riemann backend #%d requires a name and an address", i))
+		} else if names[backend.Name] {
+			errs = append(errs, fmt.Sprintf("riemann backend %s is duplicated", backend.Name))
+		}
+		names[backend.Name] = true
+	}
+	switch c.Riemann.Mode {
+	case "fan-out", "failover", "shard":
+	default:
+		errs = append(errs, fmt.Sprintf("riemann mode %q is not valid", c.Riemann.Mode))
+	}
+	if c.Riemann.ConnectTimeout <= 0 {
+		errs = append(errs, "riemann connect timeout must be greater than 0")
+	}
+	if c.Riemann.PoolSize <= 0 {
+		errs = append(errs, "riemann pool size must be greater than 0")
+	}
+	switch c.Riemann.PoolSelection {
+	case "round-robin", "least-busy":
+	default:
+		errs = append(errs, fmt.Sprintf("riemann pool selection %q is not valid", c.Riemann.PoolSelection))
+	}
+	if c.Riemann.HealthCheckInterval < 0 {
+		errs = append(errs, "riemann health check interval can not be negative")
+	}
+	if (c.Riemann.TLS.CertFile == "") != (c.Riemann.TLS.KeyFile == "") {
+		errs = append(errs, "riemann tls cert file and key file must be set together")
+	}
+	switch c.Riemann.Transport {
+	case "tcp", "udp":
+	default:
+		errs = append(errs, fmt.Sprintf("riemann transport %q is not valid", c.Riemann.Transport))
+	}
+	if c.Riemann.TLS.Enabled && (c.Riemann.Transport == "udp" || len(c.Riemann.UDPServices) > 0) {
+		errs = append(errs, "riemann udp transport can not be used with tls")
+	}
+	if c.Redis.Address == "" {
+		errs = append(errs, "redis address is required")
+	}
+	if c.Redis.DB < 0 {
+		errs = append(errs, "redis db can not be negative")
+	}
+	if u, err := url.Parse(c.Jenkins.BaseUrl); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		errs = append(errs, fmt.Sprintf("jenkins base url %q is not valid", c.Jenkins.BaseUrl))
+	}
+	if c.Cerberus.RulesFile == "" {
+		errs = append(errs, "cerberus rules file is required")
+	}
+	if c.Cerberus.RulesWatchInterval < 0 {
+		errs = append(errs, "cerberus rules watch interval can not be negative")
+	}
+
+	if c.Delivery.QueueSize <= 0 {
+		errs = append(errs, "delivery queue size must be greater than 0")
+	}
+	if c.Delivery.BatchSize <= 0 {
+		errs = append(errs, "delivery batch size must be greater than 0")
+	}
+	if c.Delivery.FlushInterval <= 0 {
+		errs = append(errs, "delivery flush interval must be greater than 0")
+	}
+	switch c.Delivery.FullPolicy {
+	case "block", "drop-oldest", "reject":
+	default:
+		errs = append(errs, fmt.Sprintf("delivery full policy %q is not valid", c.Delivery.FullPolicy))
+	}
+	if c.Delivery.BackoffMin <= 0 || c.Delivery.BackoffMax < c.Delivery.BackoffMin {
+		errs = append(errs, "delivery backoff min must be greater than 0 and not greater than backoff max")
+	}
+	if c.Delivery.SpoolDir != "" {
+		if c.Delivery.SpoolMaxSegmentSize <= 0 {
+			errs = append(errs, "delivery spool max segment size must be greater than 0")
+		}
+		if c.Delivery.SpoolMaxSize < c.Delivery.SpoolMaxSegmentSize {
+			errs = append(errs, "delivery spool max size must be greater or equal than the max segment size")
+		}
+	}
+	if c.Metric.MaxPast < 0 || c.Metric.MaxFuture < 0 {
+		errs = append(errs, "metric max past and max future can not be negative")
+	}
+	if c.Metric.MaxTags < 0 || c.Metric.MaxTagLength < 0 || c.Metric.MaxAttributes < 0 ||
+		c.Metric.MaxAttributeKeyLength < 0 || c.Metric.MaxAttributeValueLength < 0 {
+		errs = append(errs, "metric tags and attributes limits can not be negative")
+	}
+	if c.Prometheus.HostLabel == "" {
+		errs = append(errs, "prometheus host label is required (PROMETHEUS_HOST_LABEL)")
+	}
+	if c.Statsd.Address != "" && c.Statsd.FlushInterval <= 0 {
+		errs = append(errs, "statsd flush interval must be greater than 0")
+	}
+	if c.Graphite.Address != "" && c.Graphite.ReadTimeout <= 0 {
+		errs = append(errs, "graphite read timeout must be greater than 0")
+	}
+	if c.Graphite.MaxConnections < 0 {
+		errs = append(errs, "graphite max connections can not be negative")
+	}
+	if len(c.Otlp.HostAttributes) == 0 {
+		errs = append(errs, "otlp host attributes are required (OTLP_HOST_ATTRIBUTES)")
+	}
+	if c.Otlp.Logs && c.Otlp.LogService == "" {
+		errs = append(errs, "otlp log service is required (OTLP_LOG_SERVICE)")
+	}
+	if c.Stream.BufferSize <= 0 || c.Stream.Keepalive <= 0 {
+		errs = append(errs, "stream buffer size and keepalive must be greater than 0")
+	}
+	if c.Stream.MaxSubscribers < 0 {
+		errs = append(errs, "stream max subscribers can not be negative")
+	}
+	creds := c.GetApiCredential()
+	queryUsers := make([]string, 0, len(c.Query.Allow))
+	for user := range c.Query.Allow {
+		queryUsers = append(queryUsers, user)
+	}
+	sort.Strings(queryUsers)
+	for _, user := range queryUsers {
+		if _, ok := creds[user]; !ok {
+			errs = append(errs, fmt.Sprintf("query user %s is not an api user", user))
+		}
+		for _, prefix := range c.Query.Allow[user] {
+			// The % of a prefix would be a wildcard of the =~ query
+			if strings.Contains(prefix, "%") {
+				errs = append(errs, fmt.Sprintf("query prefix %q of %s can not contain %%", prefix, user))
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("Invalid config: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
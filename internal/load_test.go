@@ -0,0 +1,128 @@
+package config
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("WriteFile: %s", err)
+	}
+	return path
+}
+
+func envOf(env map[string]string) func(string) (string, bool) {
+	return func(name string) (string, bool) {
+		value, ok := env[name]
+		return value, ok
+	}
+}
+
+func TestLoadLayers(t *testing.T) {
+	file := writeConfig(t, "api:\n  user: file\n  password: secret\n  port: 9000\nredis:\n  password: redis-secret\n")
+	other := writeConfig(t, "api:\n  user: other\n  password: secret\n  port: 9100\n")
+	auth := map[string]string{"AUTH_USER": "user", "AUTH_PASSWORD": "password"}
+	tests := []struct {
+		name string
+		args []string
+		env  map[string]string
+		user string
+		port int
+	}{
+		{"defaults", nil, auth, "user", 8080},
+		{"file", nil, map[string]string{"CONFIG_FILE": file}, "file", 9000},
+		{"config flag", []string{"-config", other}, map[string]string{"CONFIG_FILE": file}, "other", 9100},
+		{"env over file", nil, map[string]string{"CONFIG_FILE": file, "API_PORT": "9001", "AUTH_USER": "env"}, "env", 9001},
+		{"flag over env", []string{"-api-port", "9002", "-api-user", "flag"}, map[string]string{"CONFIG_FILE": file, "API_PORT": "9001"}, "flag", 9002},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := Load(tt.args, envOf(tt.env))
+			if err != nil {
+				t.Fatalf("Load: %s", err)
+			}
+			if c.Api.User != tt.user || c.Api.Port != tt.port {
+				t.Fatalf("user %q and port %d, want %q and %d", c.Api.User, c.Api.Port, tt.user, tt.port)
+			}
+		})
+	}
+}
+
+func TestLoadSecrets(t *testing.T) {
+	env := map[string]string{
+		"AUTH_USER":        "user",
+		"AUTH_PASSWORD":    "password",
+		"API_USERS":        "team-a=a-secret,ops=ops-secret",
+		"REDIS_PASSWORD":   "redis-secret",
+		"JENKINS_TOKEN":    "token",
+		"JENKINS_PASSWORD": "jenkins-secret",
+	}
+	c, err := Load(nil, envOf(env))
+	if err != nil {
+		t.Fatalf("Load: %s", err)
+	}
+	creds := c.GetApiCredential()
+	if creds["user"] != "password" || creds["team-a"] != "a-secret" || creds["ops"] != "ops-secret" {
+		t.Fatalf("api credentials %v", creds)
+	}
+	if c.Redis.Password != "redis-secret" || c.Jenkins.Token != "token" || c.Jenkins.Password != "jenkins-secret" {
+		t.Fatalf("secrets not read from the environment: %+v %+v", c.Redis, c.Jenkins)
+	}
+
+	for _, flag := range []string{"-api-password", "-api-users", "-redis-password", "-jenkins-token", "-jenkins-password"} {
+		if _, err := Load([]string{flag, "secret"}, envOf(env)); err == nil {
+			t.Errorf("secret flag %s accepted", flag)
+		}
+	}
+}
+
+func TestLoadInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		env  map[string]string
+		err  string
+	}{
+		{"no user", nil, map[string]string{}, "api user is required"},
+		{"no password", nil, map[string]string{"AUTH_USER": "user"}, "api password is required"},
+		{"only api users", nil, map[string]string{"API_USERS": "team-a=secret"}, ""},
+		{"api user without password", nil, map[string]string{"API_USERS": "team-a="}, "Invalid value for API_USERS"},
+		{"invalid integer", nil, map[string]string{"AUTH_USER": "u", "AUTH_PASSWORD": "p", "API_PORT": "port"}, "Invalid value for API_PORT"},
+		{"invalid flag", []string{"-api-port", "port"}, map[string]string{"AUTH_USER": "u", "AUTH_PASSWORD": "p"}, "Invalid value for -api-port"},
+		{"unknown flag", []string{"-unknown", "1"}, map[string]string{"AUTH_USER": "u", "AUTH_PASSWORD": "p"}, "not defined"},
+		{"invalid port", nil, map[string]string{"AUTH_USER": "u", "AUTH_PASSWORD": "p", "API_PORT": "70000"}, "api port 70000 is not valid"},
+		{"invalid mode", nil, map[string]string{"AUTH_USER": "u", "AUTH_PASSWORD": "p", "RIEMANN_MODE": "all"}, `riemann mode "all" is not valid`},
+		{"graphite read timeout", nil, map[string]string{"AUTH_USER": "u", "AUTH_PASSWORD": "p", "GRAPHITE_ADDRESS": ":2003", "GRAPHITE_READ_TIMEOUT": "0s"}, "graphite read timeout must be greater than 0"},
+		{"graphite max connections", nil, map[string]string{"AUTH_USER": "u", "AUTH_PASSWORD": "p", "GRAPHITE_MAX_CONNECTIONS": "-1"}, "graphite max connections can not be negative"},
+		{"unknown query user", nil, map[string]string{"AUTH_USER": "u", "AUTH_PASSWORD": "p", "QUERY_ALLOW": "ghost=api."}, "query user ghost is not an api user"},
+		{"query prefix wildcard", nil, map[string]string{"AUTH_USER": "u", "AUTH_PASSWORD": "p", "QUERY_ALLOW": "u=api%"}, "can not contain %"},
+		{"every error", nil, map[string]string{"API_PORT": "0", "REDIS_ADDRESS": ""}, "api user is required (AUTH_USER or API_USERS); api port 0 is not valid; redis address is required"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Load(tt.args, envOf(tt.env))
+			if tt.err == "" {
+				if err != nil {
+					t.Fatalf("Load: %s", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("Load() error = %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestLoadUnknownFileField(t *testing.T) {
+	path := writeConfig(t, "api:\n  user: u\n  password: p\n  prot: 9000\n")
+	_, err := Load([]string{"-config", path}, envOf(nil))
+	if err == nil || !strings.Contains(err.Error(), "prot") {
+		t.Fatalf("Load() error = %v, want the unknown field rejected", err)
+	}
+}
@@ -0,0 +1,66 @@
+// Package protofield walks the fields of protobuf messages without generated
+// types. It decodes the fields the receivers need, the rest are skipped.
+package protofield
+
+import (
+	"math"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Field is a decoded protobuf field, the value of the length delimited
+// fields is in Bytes and the rest in Number
+type Field struct {
+	Num    protowire.Number
+	Type   protowire.Type
+	Bytes  []byte
+	Number uint64
+}
+
+// Message reports whether the field is length delimited, a message, a
+// string or bytes
+func (f Field) Message() bool {
+	return f.Type == protowire.BytesType
+}
+
+// Double is the value of a fixed64 double field
+func (f Field) Double() float64 {
+	return math.Float64frombits(f.Number)
+}
+
+// Each calls fn with every field of the message in data, it stops at the
+// first error
+func Each(data []byte, fn func(f Field) error) error {
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+
+		f := Field{Num: num, Type: typ}
+		switch typ {
+		case protowire.BytesType:
+			f.Bytes, n = protowire.ConsumeBytes(data)
+		case protowire.VarintType:
+			f.Number, n = protowire.ConsumeVarint(data)
+		case protowire.Fixed64Type:
+			f.Number, n = protowire.ConsumeFixed64(data)
+		case protowire.Fixed32Type:
+			var v uint32
+			v, n = protowire.ConsumeFixed32(data)
+			f.Number = uint64(v)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, data)
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+
+		if err := fn(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package protofield
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+var errStop = errors.New("stop")
+
+func TestEach(t *testing.T) {
+	var data []byte
+	data = protowire.AppendTag(data, 1, protowire.BytesType)
+	data = protowire.AppendString(data, "name")
+	data = protowire.AppendTag(data, 2, protowire.VarintType)
+	data = protowire.AppendVarint(data, 300)
+	data = protowire.AppendTag(data, 3, protowire.Fixed64Type)
+	data = protowire.AppendFixed64(data, math.Float64bits(1.5))
+	data = protowire.AppendTag(data, 4, protowire.Fixed32Type)
+	data = protowire.AppendFixed32(data, 7)
+	data = protowire.AppendTag(data, 5, protowire.StartGroupType)
+	data = protowire.AppendTag(data, 5, protowire.EndGroupType)
+
+	var fields []Field
+	err := Each(data, func(f Field) error {
+		fields = append(fields, f)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Each() = %s", err)
+	}
+	want := []Field{
+		{Num: 1, Type: protowire.BytesType, Bytes: []byte("name")},
+		{Num: 2, Type: protowire.VarintType, Number: 300},
+		{Num: 3, Type: protowire.Fixed64Type, Number: math.Float64bits(1.5)},
+		{Num: 4, Type: protowire.Fixed32Type, Number: 7},
+		{Num: 5, Type: protowire.StartGroupType},
+	}
+	if !reflect.DeepEqual(fields, want) {
+		t.Fatalf("Each() fields = %+v, want %+v", fields, want)
+	}
+	if !fields[0].Message() || fields[1].Message() {
+		t.Fatal("Message() is not true only for the length delimited fields")
+	}
+	if fields[2].Double() != 1.5 {
+		t.Fatalf("Double() = %v, want 1.5", fields[2].Double())
+	}
+}
+
+func TestEachErrors(t *testing.T) {
+	truncated := protowire.AppendTag(nil, 1, protowire.BytesType)
+	truncated = protowire.AppendVarint(truncated, 10)
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"invalid tag", []byte{0xff}},
+		{"truncated bytes", append(truncated, "abc"...)},
+		{"truncated fixed64", append(protowire.AppendTag(nil, 1, protowire.Fixed64Type), 1, 2)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			err := Each(tt.data, func(f Field) error {
+				calls++
+				return nil
+			})
+			if err == nil || calls != 0 {
+				t.Fatalf("Each() = %v after %d fields, want an error", err, calls)
+			}
+		})
+	}
+
+	stop := protowire.AppendTag(nil, 1, protowire.VarintType)
+	stop = protowire.AppendVarint(stop, 1)
+	stop = append(stop, stop...)
+	calls := 0
+	err := Each(stop, func(f Field) error {
+		calls++
+		return errStop
+	})
+	if err != errStop || calls != 1 {
+		t.Fatalf("Each() = %v after %d fields, want the error of the first field", err, calls)
+	}
+}